@@ -5,14 +5,26 @@ package main
 */
 
 import (
+	_ "github.com/facebookincubator/go2chef/plugin/config/chain"
+	_ "github.com/facebookincubator/go2chef/plugin/config/env"
 	_ "github.com/facebookincubator/go2chef/plugin/config/http"
+	_ "github.com/facebookincubator/go2chef/plugin/config/imds"
 	_ "github.com/facebookincubator/go2chef/plugin/config/local"
+	_ "github.com/facebookincubator/go2chef/plugin/config/s3"
+	_ "github.com/facebookincubator/go2chef/plugin/config/stdin"
+	_ "github.com/facebookincubator/go2chef/plugin/lib/certs"
 	_ "github.com/facebookincubator/go2chef/plugin/logger/stdlib"
+	_ "github.com/facebookincubator/go2chef/plugin/source/git"
 	_ "github.com/facebookincubator/go2chef/plugin/source/http"
+	_ "github.com/facebookincubator/go2chef/plugin/source/inline"
 	_ "github.com/facebookincubator/go2chef/plugin/source/local"
 	_ "github.com/facebookincubator/go2chef/plugin/source/multi"
+	_ "github.com/facebookincubator/go2chef/plugin/source/oci"
+	_ "github.com/facebookincubator/go2chef/plugin/source/omnitruck"
 	_ "github.com/facebookincubator/go2chef/plugin/source/s3"
 	_ "github.com/facebookincubator/go2chef/plugin/source/secretsmanager"
+	_ "github.com/facebookincubator/go2chef/plugin/source/sftp"
+	_ "github.com/facebookincubator/go2chef/plugin/source/vault"
 	_ "github.com/facebookincubator/go2chef/plugin/step/bundle"
 	_ "github.com/facebookincubator/go2chef/plugin/step/command"
 	_ "github.com/facebookincubator/go2chef/plugin/step/depnotify"
@@ -0,0 +1,207 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/facebookincubator/go2chef/util/hashfile"
+	"github.com/mitchellh/mapstructure"
+)
+
+// ChecksumVerifier verifies a downloaded file. filename is the name the file
+// will be saved under and path is where it currently is on disk.
+type ChecksumVerifier interface {
+	VerifyChecksum(filename, path string) error
+}
+
+// ChecksumSource is implemented by sources which fetch a single file and can
+// verify it before it is extracted or moved into place. The `checksum`
+// option is only accepted for these sources.
+type ChecksumSource interface {
+	Source
+	AddChecksumVerifier(v ChecksumVerifier)
+}
+
+// ChecksumFetcher is implemented by sources which fetch checksum manifests
+// and their signatures themselves, so that the source's own credentials are
+// used for them
+type ChecksumFetcher interface {
+	FetchChecksumResource(loc string) ([]byte, error)
+}
+
+// ChecksumVerifiers is a list of verifiers which must all pass
+type ChecksumVerifiers []ChecksumVerifier
+
+// VerifyChecksum runs every verifier against the file
+func (c ChecksumVerifiers) VerifyChecksum(filename, path string) error {
+	for _, v := range c {
+		if err := v.VerifyChecksum(filename, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checksum is an expected file digest
+type Checksum struct {
+	Algorithm string
+	Digest    string
+}
+
+// ParseChecksum parses a checksum in `<algorithm>:<hex digest>` form, i.e.
+// `sha256:2cf24dba…`. Supported algorithms are sha256, sha512 and blake2b,
+// and the digest must be the full length for the algorithm.
+func ParseChecksum(s string) (*Checksum, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid checksum %q: expected <algorithm>:<digest>", s)
+	}
+	c := &Checksum{
+		Algorithm: strings.ToLower(parts[0]),
+		Digest:    strings.ToLower(parts[1]),
+	}
+	if !hashfile.Supported(c.Algorithm) {
+		return nil, fmt.Errorf("invalid checksum %q: unsupported algorithm %s", s, c.Algorithm)
+	}
+	// digests end up in cache paths, so anything but hex is rejected
+	if _, err := hex.DecodeString(c.Digest); err != nil || len(c.Digest) != 2*hashfile.Size(c.Algorithm) {
+		return nil, fmt.Errorf("invalid checksum %q: expected a %d character hex %s digest", s, 2*hashfile.Size(c.Algorithm), c.Algorithm)
+	}
+	return c, nil
+}
+
+// String returns the checksum in `<algorithm>:<hex digest>` form
+func (c *Checksum) String() string {
+	return c.Algorithm + ":" + c.Digest
+}
+
+// VerifyChecksum hashes the file at path and compares it to this checksum
+func (c *Checksum) VerifyChecksum(filename, path string) error {
+	sum, err := hashfile.Sum(c.Algorithm, path)
+	if err != nil {
+		return err
+	}
+	GetGlobalLogger().Debugf(1, "%s: calculated %s %s, expected %s", filename, c.Algorithm, sum, c.Digest)
+	if sum != c.Digest {
+		return &ErrChecksumMismatch{File: filename, Algorithm: c.Algorithm, Expected: c.Digest, Actual: sum}
+	}
+	return nil
+}
+
+// ErrChecksumMismatch is returned when a file doesn't match its checksum
+type ErrChecksumMismatch struct {
+	File      string
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+// Error returns the error string
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("%s checksum mismatch for %s: expected %s, got %s", e.Algorithm, e.File, e.Expected, e.Actual)
+}
+
+// sourceChecksumConfig holds the checksum options accepted by every source
+type sourceChecksumConfig struct {
+	Checksum  string            `mapstructure:"checksum"`
+	Checksums map[string]string `mapstructure:"checksums"`
+	// SHA256 is the HTTP source's older spelling of `checksum: sha256:…`
+	SHA256 string `mapstructure:"sha256"`
+
+	ChecksumURL          string   `mapstructure:"checksum_url"`
+	ChecksumAlgorithm    string   `mapstructure:"checksum_algorithm"`
+	ChecksumSignatureURL string   `mapstructure:"checksum_signature_url"`
+	ChecksumTrustedKeys  []string `mapstructure:"checksum_trusted_keys"`
+}
+
+// applySourceChecksums configures checksum verification for a source. The
+// `checksum` and `checksum_url` options are handed to sources implementing
+// ChecksumSource so the fetched file is verified before extraction, and a
+// file with a known `checksum` is cached in and served from the
+// DownloadCache; `checksums` maps paths relative to the download directory
+// to checksums verified afterwards.
+func applySourceChecksums(name string, src Source, config map[string]interface{}) (Source, error) {
+	parse := sourceChecksumConfig{}
+	if err := mapstructure.Decode(config, &parse); err != nil {
+		return nil, err
+	}
+	if parse.SHA256 != "" {
+		if parse.Checksum != "" {
+			return nil, fmt.Errorf("source %s: `sha256` and `checksum` can't both be set", name)
+		}
+		parse.Checksum = hashfile.AlgorithmSHA256 + ":" + parse.SHA256
+	}
+
+	if parse.Checksum != "" || parse.ChecksumURL != "" {
+		cs, ok := src.(ChecksumSource)
+		if !ok {
+			return nil, fmt.Errorf("source %s does not support `checksum` or `checksum_url`, use `checksums` instead", name)
+		}
+		var sum *Checksum
+		if parse.Checksum != "" {
+			c, err := ParseChecksum(parse.Checksum)
+			if err != nil {
+				return nil, err
+			}
+			cs.AddChecksumVerifier(&cachingChecksum{Checksum: c, source: cs})
+			sum = c
+		}
+		if parse.ChecksumURL != "" {
+			if parse.ChecksumAlgorithm != "" && !hashfile.Supported(parse.ChecksumAlgorithm) {
+				return nil, fmt.Errorf("unsupported checksum_algorithm %s", parse.ChecksumAlgorithm)
+			}
+			m := &ChecksumManifest{
+				URL:          parse.ChecksumURL,
+				Algorithm:    parse.ChecksumAlgorithm,
+				SignatureURL: parse.ChecksumSignatureURL,
+				TrustedKeys:  parse.ChecksumTrustedKeys,
+			}
+			if f, ok := src.(ChecksumFetcher); ok {
+				m.Fetch = f.FetchChecksumResource
+			}
+			cs.AddChecksumVerifier(m)
+		}
+		if fi, ok := src.(FileInstaller); ok && sum != nil {
+			src = &cachedSource{Source: src, installer: fi, sum: sum}
+		}
+	}
+
+	if len(parse.Checksums) == 0 {
+		return src, nil
+	}
+	files := make(map[string]*Checksum, len(parse.Checksums))
+	for file, sum := range parse.Checksums {
+		c, err := ParseChecksum(sum)
+		if err != nil {
+			return nil, fmt.Errorf("checksums[%s]: %s", file, err)
+		}
+		files[file] = c
+	}
+	return &checksummedSource{Source: src, files: files}, nil
+}
+
+// checksummedSource verifies files within the download directory after the
+// wrapped source has finished
+type checksummedSource struct {
+	Source
+	files map[string]*Checksum
+}
+
+// DownloadToPath downloads using the wrapped source then verifies files
+func (c *checksummedSource) DownloadToPath(path string) error {
+	if err := c.Source.DownloadToPath(path); err != nil {
+		return err
+	}
+	for file, sum := range c.files {
+		if err := sum.VerifyChecksum(file, filepath.Join(path, filepath.FromSlash(file))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/facebookincubator/go2chef/util/hashfile"
+	"github.com/facebookincubator/go2chef/util/signature"
+)
+
+// ChecksumManifest verifies files against a checksum manifest such as the
+// `SHA256SUMS` files published alongside releases. The manifest (and its
+// signature, if trusted keys are configured) is fetched on first use.
+type ChecksumManifest struct {
+	// URL is the manifest location: an http(s) or file URL, or a local path
+	URL string
+	// Algorithm overrides the algorithm otherwise inferred from the manifest
+	Algorithm string
+	// SignatureURL is the location of the manifest's detached signature,
+	// by default URL with a `.asc` suffix for OpenPGP keys or `.sig`
+	// otherwise
+	SignatureURL string
+	// TrustedKeys, if set, requires the manifest to carry a valid signature
+	// by one of these keys: armored OpenPGP keys, or ed25519 or minisign
+	// public keys
+	TrustedKeys []string
+	// Fetch, if set, fetches http(s) URLs in place of the shared HTTP
+	// client, i.e. with the credentials of the source being verified
+	Fetch func(loc string) ([]byte, error)
+
+	entries map[string]*Checksum
+}
+
+// VerifyChecksum looks up filename in the manifest and verifies the file at
+// path against it
+func (m *ChecksumManifest) VerifyChecksum(filename, path string) error {
+	if m.entries == nil {
+		if err := m.load(); err != nil {
+			return fmt.Errorf("checksum manifest %s: %s", m.URL, err)
+		}
+	}
+	c, ok := m.entries[filename]
+	if !ok {
+		return fmt.Errorf("checksum manifest %s has no entry for %s", m.URL, filename)
+	}
+	return c.VerifyChecksum(filename, path)
+}
+
+// load fetches, verifies and parses the manifest
+func (m *ChecksumManifest) load() error {
+	data, err := m.fetch(m.URL)
+	if err != nil {
+		return err
+	}
+	if len(m.TrustedKeys) > 0 {
+		keys, err := signature.ParseTrustedKeys(m.TrustedKeys)
+		if err != nil {
+			return err
+		}
+		sigURL := m.SignatureURL
+		switch {
+		case sigURL != "":
+		case signature.IsOpenPGPKey(m.TrustedKeys[0]):
+			sigURL = m.URL + ".asc"
+		default:
+			sigURL = m.URL + ".sig"
+		}
+		sig, err := m.fetch(sigURL)
+		if err != nil {
+			return fmt.Errorf("failed to fetch signature: %s", err)
+		}
+		if err := keys.Verify(data, sig); err != nil {
+			return fmt.Errorf("signature verification failed: %s", err)
+		}
+		GetGlobalLogger().Debugf(1, "checksum manifest %s signature verified", m.URL)
+	}
+	entries, err := ParseChecksumManifest(data, m.Algorithm)
+	if err != nil {
+		return err
+	}
+	m.entries = entries
+	return nil
+}
+
+// ParseChecksumManifest parses a checksum manifest into a map of filename
+// to checksum. Both the coreutils format (`<digest>  <file>`, `<digest>
+// *<file>`) and the BSD tagged format (`SHA256 (<file>) = <digest>`) are
+// accepted. Without an explicit algorithm, tagged lines name their own and
+// untagged digests are taken as sha256 or sha512 by length. Entries are
+// keyed by their base name as well as their full path.
+func ParseChecksumManifest(data []byte, algorithm string) (map[string]*Checksum, error) {
+	entries := make(map[string]*Checksum)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var alg, digest, file string
+		if open, end := strings.Index(line, " ("), strings.LastIndex(line, ") = "); open > 0 && end > open && !strings.Contains(line[:open], " ") {
+			// BSD tagged: ALG (file) = digest
+			alg, file, digest = strings.ToLower(line[:open]), line[open+2:end], line[end+4:]
+			if alg == "blake2b-512" {
+				alg = hashfile.AlgorithmBlake2b
+			}
+		} else {
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: malformed checksum entry", n)
+			}
+			digest, file = fields[0], strings.TrimLeft(fields[1], " *")
+			switch len(digest) {
+			case 64:
+				alg = hashfile.AlgorithmSHA256
+			case 128:
+				alg = hashfile.AlgorithmSHA512
+			}
+		}
+		if algorithm != "" {
+			alg = algorithm
+		}
+		c, err := ParseChecksum(alg + ":" + digest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		file = path.Clean(strings.TrimPrefix(file, "./"))
+		entries[file] = c
+		if base := path.Base(file); base != file {
+			if _, ok := entries[base]; !ok {
+				entries[base] = c
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// fetch reads a manifest or signature, using Fetch for http(s) URLs if set
+func (m *ChecksumManifest) fetch(loc string) ([]byte, error) {
+	if m.Fetch != nil {
+		if u, err := url.Parse(loc); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			return m.Fetch(loc)
+		}
+	}
+	return fetchChecksumResource(loc)
+}
+
+// fetchChecksumResource reads an http(s) or file URL, or a local path
+func fetchChecksumResource(loc string) ([]byte, error) {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "file":
+		return ioutil.ReadFile(u.Path)
+	default:
+		return ioutil.ReadFile(loc)
+	}
+
+	client, err := HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(loc)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %d %s", loc, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,171 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+const (
+	helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	worldSHA256 = "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"
+)
+
+func TestParseChecksumManifest(t *testing.T) {
+	manifest := "# release checksums\n" +
+		helloSHA256 + "  chef-18.0.0.rpm\n" +
+		worldSHA256 + " *./dist/chef-18.0.0.deb\n" +
+		"SHA512 (chef-18.0.0.pkg) = 11853df40f4b2b919d3815f64792e58d08663767a494bcbb38c0b2389d9140bbb170281b4a847be7757bde12c9cd0054ce3652d0ad3a1a0c92babb69798246ee\n"
+	entries, err := ParseChecksumManifest([]byte(manifest), "")
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %s", err)
+	}
+	for file, exp := range map[string]string{
+		"chef-18.0.0.rpm":      "sha256:" + helloSHA256,
+		"dist/chef-18.0.0.deb": "sha256:" + worldSHA256,
+		"chef-18.0.0.deb":      "sha256:" + worldSHA256,
+		"chef-18.0.0.pkg":      "sha512:11853df40f4b2b919d3815f64792e58d08663767a494bcbb38c0b2389d9140bbb170281b4a847be7757bde12c9cd0054ce3652d0ad3a1a0c92babb69798246ee",
+	} {
+		if c, ok := entries[file]; !ok || c.String() != exp {
+			t.Errorf("entry for %s: expected %s, got %v", file, exp, c)
+		}
+	}
+
+	if _, err := ParseChecksumManifest([]byte("nonsense\n"), ""); err == nil {
+		t.Errorf("expected malformed manifest to fail to parse")
+	}
+}
+
+func TestChecksumManifestSigned(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	manifest := []byte(helloSHA256 + "  hello.txt\n" + worldSHA256 + "  world.txt\n")
+	sig := ed25519.Sign(priv, manifest)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/SHA256SUMS", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(manifest) })
+	mux.HandleFunc("/SHA256SUMS.sig", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(sig) })
+	mux.HandleFunc("/SHA256SUMS.bad.sig", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(make([]byte, ed25519.SignatureSize)) })
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fn := dir + "/hello.txt"
+	if err := ioutil.WriteFile(fn, []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	keys := []string{base64.StdEncoding.EncodeToString(pub)}
+
+	m := &ChecksumManifest{URL: ts.URL + "/SHA256SUMS", TrustedKeys: keys}
+	if err := m.VerifyChecksum("hello.txt", fn); err != nil {
+		t.Errorf("verification against signed manifest failed: %s", err)
+	}
+	if err := m.VerifyChecksum("world.txt", fn); err == nil {
+		t.Errorf("expected verification against the wrong entry to fail")
+	}
+	if err := m.VerifyChecksum("other.txt", fn); err == nil {
+		t.Errorf("expected verification of a file missing from the manifest to fail")
+	}
+
+	m = &ChecksumManifest{URL: ts.URL + "/SHA256SUMS", SignatureURL: ts.URL + "/SHA256SUMS.bad.sig", TrustedKeys: keys}
+	if err := m.VerifyChecksum("hello.txt", fn); err == nil {
+		t.Errorf("expected verification with a bad manifest signature to fail")
+	}
+
+	src, err := GetSource("go2chef.source.dummy_checksum", map[string]interface{}{"checksum_url": ts.URL + "/SHA256SUMS"})
+	if err != nil {
+		t.Fatalf("failed to get source: %s", err)
+	}
+	if err := src.DownloadToPath(dir); err == nil {
+		t.Errorf("expected sub/world.txt to fail verification against the manifest")
+	}
+}
+
+func TestChecksumManifestOpenPGP(t *testing.T) {
+	entity, err := openpgp.NewEntity("release", "", "release@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to generate OpenPGP key: %s", err)
+	}
+	pubkey := &bytes.Buffer{}
+	w, err := armor.Encode(pubkey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("failed to armor public key: %s", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("failed to serialize public key: %s", err)
+	}
+	w.Close()
+
+	manifest := []byte(helloSHA256 + "  hello.txt\n")
+	armored, binary := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(armored, entity, bytes.NewReader(manifest), nil); err != nil {
+		t.Fatalf("failed to sign manifest: %s", err)
+	}
+	if err := openpgp.DetachSign(binary, entity, bytes.NewReader(manifest), nil); err != nil {
+		t.Fatalf("failed to sign manifest: %s", err)
+	}
+
+	var fetched []string
+	fetch := func(loc string) ([]byte, error) {
+		fetched = append(fetched, loc)
+		switch loc {
+		case "https://example.com/SHA256SUMS":
+			return manifest, nil
+		case "https://example.com/SHA256SUMS.asc":
+			return armored.Bytes(), nil
+		case "https://example.com/SHA256SUMS.gpg":
+			return binary.Bytes(), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fn := dir + "/hello.txt"
+	if err := ioutil.WriteFile(fn, []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	keys := []string{pubkey.String()}
+	for _, sigURL := range []string{"", "https://example.com/SHA256SUMS.gpg"} {
+		fetched = nil
+		m := &ChecksumManifest{URL: "https://example.com/SHA256SUMS", SignatureURL: sigURL, TrustedKeys: keys, Fetch: fetch}
+		if err := m.VerifyChecksum("hello.txt", fn); err != nil {
+			t.Errorf("%s: verification against OpenPGP signed manifest failed: %s", sigURL, err)
+		}
+		if len(fetched) != 2 {
+			t.Errorf("%s: expected the manifest and signature to be fetched with Fetch, got %v", sigURL, fetched)
+		}
+	}
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	m := &ChecksumManifest{URL: "https://example.com/SHA256SUMS", TrustedKeys: []string{keys[0], base64.StdEncoding.EncodeToString(pub)}, Fetch: fetch}
+	if err := m.VerifyChecksum("hello.txt", fn); err == nil {
+		t.Errorf("expected mixing OpenPGP and ed25519 keys to fail")
+	}
+}
@@ -0,0 +1,128 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// DummyFileSource writes a fixed set of files, verifying each against any
+// configured checksum verifiers first
+type DummyFileSource struct {
+	files     map[string]string
+	checksums ChecksumVerifiers
+}
+
+func (d *DummyFileSource) String() string      { return "dummy" }
+func (d *DummyFileSource) Name() string        { return "dummy" }
+func (d *DummyFileSource) Type() string        { return "dummy" }
+func (d *DummyFileSource) SetName(name string) {}
+func (d *DummyFileSource) AddChecksumVerifier(v ChecksumVerifier) {
+	d.checksums = append(d.checksums, v)
+}
+func (d *DummyFileSource) DownloadToPath(path string) error {
+	for name, content := range d.files {
+		fn := filepath.Join(path, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			return err
+		}
+		if err := d.checksums.VerifyChecksum(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ ChecksumSource = &DummyFileSource{}
+
+func init() {
+	RegisterSource("go2chef.source.dummy_checksum", func(config map[string]interface{}) (Source, error) {
+		return &DummyFileSource{files: map[string]string{"hello.txt": "hello", "sub/world.txt": "world"}}, nil
+	})
+}
+
+func TestParseChecksum(t *testing.T) {
+	for in, ok := range map[string]bool{
+		"sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824": true,
+		"SHA512:" + strings.Repeat("AB", 64):                                      true,
+		"blake2b:" + strings.Repeat("ab", 64):                                     true,
+		"blake2b:abcdef":                                                          false,
+		"sha256:../../x":                                                          false,
+		"sha256:" + strings.Repeat("zz", 32):                                      false,
+		"md5:abcdef":                                                              false,
+		"abcdef":                                                                  false,
+		"sha256:":                                                                 false,
+	} {
+		c, err := ParseChecksum(in)
+		if ok && err != nil {
+			t.Errorf("failed to parse %q: %s", in, err)
+		} else if !ok && err == nil {
+			t.Errorf("expected %q to fail to parse, got %s", in, c)
+		}
+	}
+}
+
+func TestGetSourceChecksums(t *testing.T) {
+	const (
+		helloSHA256  = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+		worldSHA512  = "sha512:11853df40f4b2b919d3815f64792e58d08663767a494bcbb38c0b2389d9140bbb170281b4a847be7757bde12c9cd0054ce3652d0ad3a1a0c92babb69798246ee"
+		helloBlake2b = "blake2b:e4cfa39a3d37be31c59609e807970799caa68a19bfaa15135f165085e01d41a65ba1e1b146aeb6bd0092b49eac214c103ccfa3a365954bbbe52f74a2b3620c94"
+	)
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		ok     bool
+	}{
+		{"checksum", map[string]interface{}{"checksum": helloSHA256}, false},
+		{"checksum blake2b", map[string]interface{}{"checksum": helloBlake2b}, false},
+		{"checksums", map[string]interface{}{"checksums": map[string]interface{}{
+			"hello.txt":     helloSHA256,
+			"sub/world.txt": worldSHA512,
+		}}, true},
+		{"checksums mismatch", map[string]interface{}{"checksums": map[string]interface{}{
+			"sub/world.txt": helloBlake2b,
+		}}, false},
+		{"checksums missing file", map[string]interface{}{"checksums": map[string]interface{}{
+			"missing.txt": helloSHA256,
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatalf("failed to create temporary directory: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			src, err := GetSource("go2chef.source.dummy_checksum", tt.config)
+			if err != nil {
+				t.Fatalf("failed to get source: %s", err)
+			}
+			err = src.DownloadToPath(dir)
+			if tt.ok && err != nil {
+				t.Errorf("download failed: %s", err)
+			} else if !tt.ok && err == nil {
+				t.Errorf("expected download to fail verification")
+			}
+		})
+	}
+
+	// a single-file checksum matches only the file it was computed for
+	src, _ := GetSource("go2chef.source.dummy_checksum", map[string]interface{}{"checksum": helloSHA256})
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	var mismatch *ErrChecksumMismatch
+	if err := src.DownloadToPath(dir); !errors.As(err, &mismatch) || mismatch.File != "sub/world.txt" {
+		t.Errorf("expected a checksum mismatch for sub/world.txt, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package cli
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/facebookincubator/go2chef/plugin/lib/cache"
+	"github.com/facebookincubator/go2chef/util"
+	"github.com/spf13/pflag"
+)
+
+const cacheUsage = `usage: go2chef cache <list|prune> [flags]
+
+  list    show cached downloads, most recently used first
+  prune   evict least-recently-used downloads down to --max-size
+
+`
+
+// runCache implements the `go2chef cache` subcommand
+func runCache(args []string, out io.Writer) int {
+	flags := pflag.NewFlagSet("go2chef cache", pflag.ContinueOnError)
+	dir := flags.String("cache-dir", cache.DefaultPath, "download cache directory")
+	maxSize := flags.String("max-size", "", "size to prune the cache down to (i.e. 10GiB); 0 empties it. Required for prune")
+	flags.Usage = func() {
+		_, _ = fmt.Fprint(os.Stderr, cacheUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	c := cache.New(*dir, 0)
+	switch flags.Arg(0) {
+	case "list":
+		entries, err := c.List()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to list cache %s: %s\n", *dir, err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "KEY\tSIZE\tLAST USED\tSOURCE")
+		var total int64
+		for _, e := range entries {
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", e.Key, e.Size, e.LastUsed.Format(time.RFC3339), e.Source)
+			total += e.Size
+		}
+		_ = tw.Flush()
+		_, _ = fmt.Fprintf(out, "%d entries, %d bytes\n", len(entries), total)
+	case "prune":
+		if *maxSize == "" {
+			_, _ = fmt.Fprintln(os.Stderr, "--max-size is required to prune the cache")
+			return 1
+		}
+		size, err := util.ParseSize(*maxSize)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "--max-size: %s\n", err)
+			return 1
+		}
+		evicted, err := c.Prune(size)
+		for _, e := range evicted {
+			_, _ = fmt.Fprintf(out, "evicted %s (%d bytes) %s\n", e.Key, e.Size, e.Source)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to prune cache %s: %s\n", *dir, err)
+			return 1
+		}
+	default:
+		flags.Usage()
+		return 1
+	}
+	return 0
+}
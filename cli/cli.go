@@ -5,6 +5,8 @@ package cli
 */
 
 import (
+	"io/ioutil"
+	"os"
 	"strconv"
 	"time"
 
@@ -30,9 +32,12 @@ func init() {
 type Go2ChefCLI struct {
 	flags            *pflag.FlagSet
 	configSourceName string
+	configURI        string
 	logLevel         string
 	logDebugLevel    int
 	preserveTemp     bool
+	trustedKeys      []string
+	trustedKeyFiles  []string
 }
 
 // Option defines the interface for CLI option functions
@@ -59,13 +64,21 @@ func NewGo2ChefCLI(opts ...Option) *Go2ChefCLI {
 		panic("invalid go2chef.cli.DefaultLogLevel compiled in")
 	}
 	cli.flags.StringVarP(&cli.configSourceName, "config-source", "C", DefaultConfigSource, "name of the configuration source to use")
+	cli.flags.StringVarP(&cli.configURI, "config", "c", "", "configuration URI (file://, https://, s3://bucket/key, env://VAR or - for stdin); overrides --config-source")
 	cli.flags.StringVarP(&cli.logLevel, "log-level", "l", logLevel, "log level")
 	cli.flags.BoolVar(&cli.preserveTemp, "preserve-temp", false, "preserve temporary directories from this run")
+	cli.flags.StringArrayVar(&cli.trustedKeys, "config-trusted-key", nil, "public key trusted to sign configuration (repeatable)")
+	cli.flags.StringVar(&go2chef.ConfigKeyFile, "config-key-file", "", "file containing the private key for decrypting encrypted configuration values")
+	cli.flags.StringArrayVar(&cli.trustedKeyFiles, "config-trusted-key-file", nil, "file containing a public key trusted to sign configuration (repeatable)")
 	return cli
 }
 
 // Run kicks off the execution of go2chef
 func (g *Go2ChefCLI) Run(argv []string) int {
+	if len(argv) > 1 && argv[1] == "cache" {
+		return runCache(argv[2:], os.Stdout)
+	}
+
 	// Set early config flags and parse. As we build our
 	// own pflag.FlagSet plugins using pflag.*Var() functions
 	// won't be able to pollute this.
@@ -84,10 +97,28 @@ func (g *Go2ChefCLI) Run(argv []string) int {
 	// Add stdlib early logger
 	early := stdlib.NewFromLogger(go2chef.EarlyLogger, logLevel, g.logDebugLevel)
 
+	// Extend the compiled-in configuration trust root with keys from flags
+	go2chef.TrustedConfigKeys = append(go2chef.TrustedConfigKeys, g.trustedKeys...)
+	for _, kf := range g.trustedKeyFiles {
+		key, err := ioutil.ReadFile(kf)
+		if err != nil {
+			early.Errorf("failed to read --config-trusted-key-file %s: %s", kf, err)
+			return 1
+		}
+		go2chef.TrustedConfigKeys = append(go2chef.TrustedConfigKeys, string(key))
+	}
+
 	// Load actual configuration
-	cfg, err := go2chef.GetConfig(g.configSourceName, early)
+	var cfg *go2chef.Config
+	if g.configURI != "" {
+		cfg, err = go2chef.GetConfigFromURI(g.configURI, early)
+	} else {
+		cfg, err = go2chef.GetConfig(g.configSourceName, early)
+	}
 	if err != nil {
-		early.Errorf("config error: %s", err)
+		// the configuration may have been decrypted before failing, and
+		// the early logger doesn't redact on its own
+		early.Errorf("config error: %s", go2chef.Redact(err.Error()))
 		return 1
 	}
 
@@ -100,6 +131,7 @@ func (g *Go2ChefCLI) Run(argv []string) int {
 		Component: "go2chef.cli",
 	})
 
+	temp.Preserve = g.preserveTemp
 	defer temp.Cleanup(g.preserveTemp)
 	defer go2chef.ShutdownGlobalLogger()
 
@@ -5,6 +5,12 @@ package go2chef
 */
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/pflag"
 )
@@ -17,6 +23,26 @@ type ConfigSource interface {
 	ReadConfig() (map[string]interface{}, error)
 }
 
+// ConfigValidators are HTTP-style cache validators for fetched configuration
+type ConfigValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// ErrConfigNotModified is returned by ConditionalConfigSource implementations
+// when the configuration hasn't changed since the provided validators.
+var ErrConfigNotModified = errors.New("configuration not modified")
+
+// ConditionalConfigSource is implemented by configuration sources which support
+// conditional fetches, so unchanged configuration can be served from a cache.
+type ConditionalConfigSource interface {
+	SignedConfigSource
+	// ReadConfigIfModified behaves like ReadSignedConfig, but returns
+	// ErrConfigNotModified if the configuration matches the validators. Empty
+	// validators always fetch. The returned validators describe the new data.
+	ReadConfigIfModified(v ConfigValidators) (data []byte, sig []byte, nv ConfigValidators, err error)
+}
+
 var configSourceRegistry = make(map[string]ConfigSource)
 
 // RegisterConfigSource registers a new configuration source plugin
@@ -43,25 +69,94 @@ func GetConfigSource(name string) ConfigSource {
 	return nil
 }
 
+// ReadRawConfig reads the raw configuration document and signature from a
+// ConfigSource. Sources which don't implement SignedConfigSource have their
+// configuration re-serialized and never return a signature.
+func ReadRawConfig(cs ConfigSource) ([]byte, []byte, error) {
+	if scs, ok := cs.(SignedConfigSource); ok {
+		return scs.ReadSignedConfig()
+	}
+	config, err := cs.ReadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, nil, nil
+}
+
+// ConfigSourceURILoader returns a ConfigSource configured from a URI
+type ConfigSourceURILoader func(uri *url.URL) (ConfigSource, error)
+
+var configSourceSchemeRegistry = make(map[string]ConfigSourceURILoader)
+
+// RegisterConfigSourceScheme registers a ConfigSource plugin as the handler
+// for configuration URIs with the given scheme
+func RegisterConfigSourceScheme(scheme string, l ConfigSourceURILoader) {
+	scheme = strings.ToLower(scheme)
+	if _, ok := configSourceSchemeRegistry[scheme]; ok {
+		panic("ConfigSource URI scheme " + scheme + " is already registered")
+	}
+	configSourceSchemeRegistry[scheme] = l
+}
+
+// GetConfigSourceForURI gets a ConfigSource configured for a URI. A bare
+// `-` is treated as `stdin:` and paths without a scheme as `file:`.
+func GetConfigSourceForURI(uri string) (ConfigSource, error) {
+	if uri == "-" {
+		uri = "stdin:"
+	}
+	u, err := url.Parse(uri)
+	// single-letter schemes are Windows drive letters
+	if err != nil || len(u.Scheme) < 2 {
+		u = &url.URL{Scheme: "file", Path: uri}
+	}
+	l, ok := configSourceSchemeRegistry[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, &ErrComponentDoesNotExist{Component: "ConfigSource URI scheme " + u.Scheme}
+	}
+	return l(u)
+}
+
 // Config defines the configuration for all of go2chef
 type Config struct {
 	Loggers []Logger
 	Steps   []Step
 }
 
-// GetConfig loads and resolves the configuration
+// GetConfig loads and resolves the configuration from a named ConfigSource
 func GetConfig(configSourceName string, earlyLogger Logger) (*Config, error) {
-	EarlyLogger.Printf("loading config from source %s", configSourceName)
-
-	// Get the chosen configuration source and read
 	configSource := GetConfigSource(configSourceName)
 	if configSource == nil {
 		return nil, &ErrComponentDoesNotExist{Component: "ConfigSource::" + configSourceName}
 	}
-	config, err := configSource.ReadConfig()
+	return GetConfigFromSource(configSourceName, configSource, earlyLogger)
+}
+
+// GetConfigFromURI loads and resolves the configuration from a URI
+func GetConfigFromURI(uri string, earlyLogger Logger) (*Config, error) {
+	configSource, err := GetConfigSourceForURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	return GetConfigFromSource(uri, configSource, earlyLogger)
+}
+
+// GetConfigFromSource loads and resolves the configuration from a
+// ConfigSource, using name to identify it in logs and errors
+func GetConfigFromSource(name string, configSource ConfigSource, earlyLogger Logger) (*Config, error) {
+	EarlyLogger.Printf("loading config from source %s", name)
+
+	// Read from the chosen configuration source
+	config, err := readConfig(name, configSource)
 	if err != nil {
 		return nil, err
 	}
+	if err := DecryptConfig(config); err != nil {
+		return nil, fmt.Errorf("failed to decrypt configuration: %s", err)
+	}
 
 	cfg := &Config{}
 
@@ -0,0 +1,246 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// EncryptedValueKey marks an encrypted configuration value. A map with this
+// as its only key is replaced by the decrypted value, i.e.:
+//
+//	{"$encrypted": "<base64 sealed box>"}
+//
+// Values are NaCl anonymous sealed boxes (compatible with libsodium's
+// crypto_box_seal) of JSON documents, sealed to an X25519 public key.
+const EncryptedValueKey = "$encrypted"
+
+// ConfigKeyProvider returns a base64-encoded X25519 private key for
+// decrypting configuration values, or "" if it has none to offer.
+type ConfigKeyProvider func() (string, error)
+
+var (
+	// ConfigKeyFile is the path to a file holding a base64 X25519 private key
+	// for decrypting configuration values
+	ConfigKeyFile string
+	// ConfigKeyEnv is the environment variable holding a base64 X25519
+	// private key for decrypting configuration values
+	ConfigKeyEnv = "GO2CHEF_CONFIG_KEY"
+
+	configKeyProviderRegistry = map[string]ConfigKeyProvider{
+		"file": configKeyFromFile,
+		"env":  configKeyFromEnv,
+	}
+)
+
+var (
+	// ErrNoConfigKeys is returned when encrypted configuration values are
+	// found but no key provider supplied a key
+	ErrNoConfigKeys = errors.New("configuration contains encrypted values but no decryption keys are available")
+)
+
+// RegisterConfigKeyProvider registers a new source of configuration
+// decryption keys
+func RegisterConfigKeyProvider(name string, p ConfigKeyProvider) {
+	if _, ok := configKeyProviderRegistry[name]; ok {
+		panic("ConfigKeyProvider " + name + " is already registered")
+	}
+	configKeyProviderRegistry[name] = p
+}
+
+func configKeyFromFile() (string, error) {
+	if ConfigKeyFile == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(ConfigKeyFile)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func configKeyFromEnv() (string, error) {
+	return os.Getenv(ConfigKeyEnv), nil
+}
+
+// configKey is an X25519 key pair
+type configKey struct {
+	public, private [32]byte
+}
+
+func parseConfigKey(s string) (*configKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("key is %d bytes, expected 32", len(raw))
+	}
+	k := &configKey{}
+	copy(k.private[:], raw)
+	curve25519.ScalarBaseMult(&k.public, &k.private)
+	return k, nil
+}
+
+// loadConfigKeys collects keys from all registered key providers
+func loadConfigKeys() ([]*configKey, error) {
+	var keys []*configKey
+	for name, p := range configKeyProviderRegistry {
+		s, err := p()
+		if err != nil {
+			return nil, fmt.Errorf("config key provider %s: %s", name, err)
+		}
+		if s == "" {
+			continue
+		}
+		k, err := parseConfigKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("config key provider %s: %s", name, err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoConfigKeys
+	}
+	return keys, nil
+}
+
+// DecryptConfig replaces all encrypted values in a configuration map with
+// their decrypted contents. A wholly encrypted configuration must decrypt to
+// an object, which replaces the map's contents. Decrypted strings and
+// numbers are registered for redaction. Keys are only loaded if encrypted
+// values are present.
+func DecryptConfig(config map[string]interface{}) error {
+	d := &decrypter{}
+	out, err := d.walk(config)
+	if err != nil {
+		return err
+	}
+	if _, whole := config[EncryptedValueKey]; whole && len(config) == 1 {
+		doc, ok := out.(map[string]interface{})
+		if !ok {
+			return errors.New("encrypted configuration must decrypt to an object")
+		}
+		delete(config, EncryptedValueKey)
+		for k, v := range doc {
+			config[k] = v
+		}
+	}
+	return nil
+}
+
+type decrypter struct {
+	keys []*configKey
+}
+
+func (d *decrypter) walk(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if enc, ok := val[EncryptedValueKey]; ok && len(val) == 1 {
+			return d.decrypt(enc)
+		}
+		for k, child := range val {
+			nv, err := d.walk(child)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			val[k] = nv
+		}
+	case []interface{}:
+		for i, child := range val {
+			nv, err := d.walk(child)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			val[i] = nv
+		}
+	}
+	return v, nil
+}
+
+func (d *decrypter) decrypt(enc interface{}) (interface{}, error) {
+	s, ok := enc.(string)
+	if !ok {
+		return nil, errors.New(EncryptedValueKey + " value must be a string")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted value: %s", err)
+	}
+	if d.keys == nil {
+		if d.keys, err = loadConfigKeys(); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range d.keys {
+		plain, ok := box.OpenAnonymous(nil, sealed, &k.public, &k.private)
+		if !ok {
+			continue
+		}
+		var out interface{}
+		if err := json.Unmarshal(plain, &out); err != nil {
+			return nil, fmt.Errorf("decrypted value is not valid JSON: %s", err)
+		}
+		registerRedactions(out)
+		return out, nil
+	}
+	return nil, errors.New("failed to decrypt value with any available key")
+}
+
+// registerRedactions registers every string and number within a decoded
+// JSON value. Booleans and nulls can't usefully be redacted.
+func registerRedactions(v interface{}) {
+	switch val := v.(type) {
+	case string:
+		RegisterRedaction(val)
+	case float64:
+		RegisterRedaction(strconv.FormatFloat(val, 'f', -1, 64))
+	case map[string]interface{}:
+		for _, child := range val {
+			registerRedactions(child)
+		}
+	case []interface{}:
+		for _, child := range val {
+			registerRedactions(child)
+		}
+	}
+}
+
+// EncryptConfigValue seals a value to a base64 X25519 public key, returning
+// the encrypted configuration value which decrypts to it.
+func EncryptConfigValue(publicKey string, value interface{}) (map[string]interface{}, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("public key is %d bytes, expected 32", len(raw))
+	}
+	var pub [32]byte
+	copy(pub[:], raw)
+
+	plain, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := box.SealAnonymous(nil, plain, &pub, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		EncryptedValueKey: base64.StdEncoding.EncodeToString(sealed),
+	}, nil
+}
@@ -0,0 +1,115 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestDecryptConfig(t *testing.T) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	os.Setenv(ConfigKeyEnv, base64.StdEncoding.EncodeToString(priv[:]))
+	defer os.Unsetenv(ConfigKeyEnv)
+
+	pubStr := base64.StdEncoding.EncodeToString(pub[:])
+	secret, err := EncryptConfigValue(pubStr, "s3cr3t-access-key")
+	if err != nil {
+		t.Fatalf("failed to encrypt value: %s", err)
+	}
+	section, err := EncryptConfigValue(pubStr, map[string]interface{}{"token": "t0k3n-value"})
+	if err != nil {
+		t.Fatalf("failed to encrypt section: %s", err)
+	}
+
+	config := map[string]interface{}{
+		"steps": []interface{}{
+			map[string]interface{}{
+				"name": "step",
+				"source": map[string]interface{}{
+					"secret_access_key": secret,
+				},
+			},
+		},
+		"global": section,
+	}
+	if err := DecryptConfig(config); err != nil {
+		t.Fatalf("failed to decrypt config: %s", err)
+	}
+
+	src := config["steps"].([]interface{})[0].(map[string]interface{})["source"].(map[string]interface{})
+	if src["secret_access_key"] != "s3cr3t-access-key" {
+		t.Errorf("nested value not decrypted: %#v", src["secret_access_key"])
+	}
+	if g, ok := config["global"].(map[string]interface{}); !ok || g["token"] != "t0k3n-value" {
+		t.Errorf("section not decrypted: %#v", config["global"])
+	}
+
+	if out := Redact("key is s3cr3t-access-key, token t0k3n-value"); strings.Contains(out, "s3cr3t") || strings.Contains(out, "t0k3n") {
+		t.Errorf("decrypted values not redacted: %s", out)
+	}
+}
+
+func TestDecryptConfigWhole(t *testing.T) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	os.Setenv(ConfigKeyEnv, base64.StdEncoding.EncodeToString(priv[:]))
+	defer os.Unsetenv(ConfigKeyEnv)
+	pubStr := base64.StdEncoding.EncodeToString(pub[:])
+
+	config, err := EncryptConfigValue(pubStr, map[string]interface{}{"steps": []interface{}{}, "pin": 73195846})
+	if err != nil {
+		t.Fatalf("failed to encrypt config: %s", err)
+	}
+	if err := DecryptConfig(config); err != nil {
+		t.Fatalf("failed to decrypt config: %s", err)
+	}
+	if _, ok := config[EncryptedValueKey]; ok {
+		t.Errorf("config is still encrypted: %#v", config)
+	}
+	if _, ok := config["steps"]; !ok || config["pin"] != float64(73195846) {
+		t.Errorf("config not decrypted in place: %#v", config)
+	}
+	if out := Redact("pin 73195846"); strings.Contains(out, "73195846") {
+		t.Errorf("decrypted number not redacted: %s", out)
+	}
+
+	config, err = EncryptConfigValue(pubStr, "not an object")
+	if err != nil {
+		t.Fatalf("failed to encrypt config: %s", err)
+	}
+	if err := DecryptConfig(config); err == nil {
+		t.Errorf("expected a config decrypting to a string to fail")
+	}
+}
+
+func TestDecryptConfigNoKeys(t *testing.T) {
+	pub, _, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	enc, err := EncryptConfigValue(base64.StdEncoding.EncodeToString(pub[:]), "value")
+	if err != nil {
+		t.Fatalf("failed to encrypt value: %s", err)
+	}
+	if err := DecryptConfig(map[string]interface{}{"a": enc}); !errors.Is(err, ErrNoConfigKeys) {
+		t.Errorf("expected ErrNoConfigKeys, got %v", err)
+	}
+	// plain configs never need keys
+	if err := DecryptConfig(map[string]interface{}{"a": "b"}); err != nil {
+		t.Errorf("plain config failed to decrypt: %s", err)
+	}
+}
@@ -0,0 +1,83 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/facebookincubator/go2chef/util/signature"
+)
+
+// ConfigSignatureSuffix is appended to a configuration's location to find
+// its detached signature (i.e. `config.json` => `config.json.sig`)
+const ConfigSignatureSuffix = ".sig"
+
+// SignedConfigSource is implemented by configuration sources which can provide
+// the raw configuration document along with its detached signature.
+type SignedConfigSource interface {
+	ConfigSource
+	// ReadSignedConfig returns the raw configuration data and its detached
+	// signature. A nil signature means that no signature was found.
+	ReadSignedConfig() (data []byte, sig []byte, err error)
+}
+
+// TrustedConfigKeys is the trust root for configuration signatures. Keys may
+// be raw base64 ed25519 public keys or minisign public keys. Set this from an
+// init() function to compile keys into your binary; the CLI appends any keys
+// passed on the command line. If empty, signatures aren't checked.
+var TrustedConfigKeys []string
+
+var (
+	// ErrConfigNotSigned is returned when a trust root is configured but
+	// the configuration has no signature.
+	ErrConfigNotSigned = errors.New("configuration is not signed")
+)
+
+// ErrConfigSignatureUnsupported is returned when a trust root is configured
+// but the chosen config source can't provide signatures.
+type ErrConfigSignatureUnsupported struct {
+	ConfigSource string
+}
+
+// Error returns the error string
+func (e *ErrConfigSignatureUnsupported) Error() string {
+	return "config source " + e.ConfigSource + " does not support signature verification"
+}
+
+// readConfig reads configuration from a ConfigSource, enforcing signature
+// verification if TrustedConfigKeys is set.
+func readConfig(name string, cs ConfigSource) (map[string]interface{}, error) {
+	if len(TrustedConfigKeys) == 0 {
+		return cs.ReadConfig()
+	}
+
+	keys, err := signature.ParsePublicKeys(TrustedConfigKeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted config key: %s", err)
+	}
+	scs, ok := cs.(SignedConfigSource)
+	if !ok {
+		return nil, &ErrConfigSignatureUnsupported{ConfigSource: name}
+	}
+	data, sig, err := scs.ReadSignedConfig()
+	if err != nil {
+		return nil, err
+	}
+	if sig == nil {
+		return nil, ErrConfigNotSigned
+	}
+	if err := keys.Verify(data, sig); err != nil {
+		return nil, fmt.Errorf("configuration signature verification failed: %s", err)
+	}
+	EarlyLogger.Printf("configuration signature verified")
+
+	config := make(map[string]interface{})
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
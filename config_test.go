@@ -5,8 +5,13 @@ package go2chef
 */
 
 import (
-	"github.com/spf13/pflag"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/url"
 	"testing"
+
+	"github.com/spf13/pflag"
 )
 
 type DummyConfigSource struct{}
@@ -30,3 +35,79 @@ func TestConfigSourceRegistry(t *testing.T) {
 		t.Errorf("failed to get config source `dupe` despite it being registered")
 	}
 }
+
+type DummySignedConfigSource struct {
+	DummyConfigSource
+	data []byte
+	sig  []byte
+}
+
+func (d *DummySignedConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	return d.data, d.sig, nil
+}
+
+var _ SignedConfigSource = &DummySignedConfigSource{}
+
+func TestReadConfigSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	data := []byte(`{"key":"value"}`)
+
+	TrustedConfigKeys = []string{base64.StdEncoding.EncodeToString(pub)}
+	defer func() { TrustedConfigKeys = nil }()
+
+	good := &DummySignedConfigSource{data: data, sig: ed25519.Sign(priv, data)}
+	if cfg, err := readConfig("good", good); err != nil {
+		t.Errorf("failed to read correctly signed config: %s", err)
+	} else if cfg["key"] != "value" {
+		t.Errorf("config[key] != value")
+	}
+
+	unsigned := &DummySignedConfigSource{data: data}
+	if _, err := readConfig("unsigned", unsigned); err != ErrConfigNotSigned {
+		t.Errorf("expected ErrConfigNotSigned for unsigned config, got %v", err)
+	}
+
+	bad := &DummySignedConfigSource{data: []byte(`{"key":"evil"}`), sig: good.sig}
+	if _, err := readConfig("bad", bad); err == nil {
+		t.Errorf("badly signed config should be refused")
+	}
+
+	if _, err := readConfig("dummy", &DummyConfigSource{}); err == nil {
+		t.Errorf("config source without signature support should be refused")
+	}
+}
+
+func TestGetConfigSourceForURI(t *testing.T) {
+	var got *url.URL
+	RegisterConfigSourceScheme("dummy", func(u *url.URL) (ConfigSource, error) {
+		got = u
+		return &DummyConfigSource{}, nil
+	})
+	if !doesFunctionPanic(func() {
+		RegisterConfigSourceScheme("DUMMY", nil)
+	}) {
+		t.Fatalf("RegisterConfigSourceScheme does not panic on duplicate")
+	}
+
+	if _, err := GetConfigSourceForURI("dummy://host/path?x=1"); err != nil {
+		t.Fatalf("failed to get config source for registered scheme: %s", err)
+	}
+	if got.Host != "host" || got.Path != "/path" || got.Query().Get("x") != "1" {
+		t.Errorf("URI not passed through to loader: %#v", got)
+	}
+
+	if _, err := GetConfigSourceForURI("unknown://x"); err == nil {
+		t.Errorf("expected error for unregistered scheme")
+	}
+	// stdin and bare paths dispatch to their default schemes
+	for _, uri := range []string{"-", "config.json", "C:\\go2chef\\config.json"} {
+		if _, err := GetConfigSourceForURI(uri); err == nil {
+			t.Errorf("expected missing-scheme error for %s with no plugins registered", uri)
+		} else if e, ok := err.(*ErrComponentDoesNotExist); !ok || (e.Component != "ConfigSource URI scheme stdin" && e.Component != "ConfigSource URI scheme file") {
+			t.Errorf("unexpected error for %s: %s", uri, err)
+		}
+	}
+}
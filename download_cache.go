@@ -0,0 +1,117 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"io"
+
+	"github.com/facebookincubator/go2chef/util/temp"
+)
+
+// DownloadCache is a persistent cache of fetched files with known checksums,
+// shared between runs. plugin/lib/cache registers one when `global.cache` is
+// configured.
+type DownloadCache interface {
+	// Fetch copies the file with checksum c to w, returning the filename it
+	// was originally fetched as
+	Fetch(c *Checksum, w io.Writer) (string, error)
+	// Store adds the file at path, already verified against c, recording
+	// the source and filename it was fetched from
+	Store(c *Checksum, source, filename, path string) error
+}
+
+// FileInstaller is implemented by ChecksumSources which can put a file
+// fetched earlier in place as though they had just fetched it. Sources with
+// a known `checksum` which implement it are served from the DownloadCache
+// without fetching anything.
+type FileInstaller interface {
+	// InstallFile extracts or moves the file at path, originally fetched as
+	// filename, into dlPath
+	InstallFile(filename, path, dlPath string) error
+}
+
+var downloadCache DownloadCache
+
+// SetDownloadCache sets the cache used for sources with a known checksum. A
+// nil cache disables caching.
+func SetDownloadCache(c DownloadCache) {
+	downloadCache = c
+}
+
+// KnownChecksum returns the first literal checksum among a source's
+// verifiers, or nil if the expected content isn't known up front
+func KnownChecksum(v ChecksumVerifier) *Checksum {
+	switch c := v.(type) {
+	case *Checksum:
+		return c
+	case *cachingChecksum:
+		return c.Checksum
+	case ChecksumVerifiers:
+		for _, v := range c {
+			if sum := KnownChecksum(v); sum != nil {
+				return sum
+			}
+		}
+	}
+	return nil
+}
+
+// cachingChecksum verifies a fetched file against the source's `checksum`,
+// then stores it in the download cache
+type cachingChecksum struct {
+	*Checksum
+	source Source
+}
+
+// VerifyChecksum verifies the file and caches it if it matches
+func (c *cachingChecksum) VerifyChecksum(filename, path string) error {
+	if err := c.Checksum.VerifyChecksum(filename, path); err != nil {
+		return err
+	}
+	if downloadCache != nil {
+		if err := downloadCache.Store(c.Checksum, c.source.String(), filename, path); err != nil {
+			GetGlobalLogger().Errorf("%s: failed to cache %s: %s", c.source.Name(), filename, err)
+		}
+	}
+	return nil
+}
+
+// cachedSource installs the wrapped source's file from the download cache
+// when it's there, falling back to fetching it
+type cachedSource struct {
+	Source
+	installer FileInstaller
+	sum       *Checksum
+}
+
+// DownloadToPath installs the cached file, or downloads using the wrapped
+// source if it isn't cached
+func (c *cachedSource) DownloadToPath(dlPath string) error {
+	if downloadCache == nil {
+		return c.Source.DownloadToPath(dlPath)
+	}
+	tmpfile, err := temp.File("", "go2chef-cache-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = temp.Remove(tmpfile.Name()) }()
+
+	filename, err := downloadCache.Fetch(c.sum, tmpfile)
+	if cerr := tmpfile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		GetGlobalLogger().Debugf(1, "%s: %s isn't cached: %s", c.Name(), c.sum, err)
+		return c.Source.DownloadToPath(dlPath)
+	}
+	// the cache is on local disk, so the entry is checked rather than trusted
+	if err := c.sum.VerifyChecksum(filename, tmpfile.Name()); err != nil {
+		GetGlobalLogger().Errorf("%s: ignoring cache entry for %s: %s", c.Name(), c.sum, err)
+		return c.Source.DownloadToPath(dlPath)
+	}
+	GetGlobalLogger().WriteEvent(NewEvent("DOWNLOAD_CACHE_HIT", c.Type(), filename))
+	GetGlobalLogger().Debugf(1, "%s: using cached %s for %s", c.Name(), c.sum, filename)
+	return c.installer.InstallFile(filename, tmpfile.Name(), dlPath)
+}
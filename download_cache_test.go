@@ -0,0 +1,147 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// memoryCache is a DownloadCache held in memory
+type memoryCache map[string][2]string
+
+func (m memoryCache) Fetch(c *Checksum, w io.Writer) (string, error) {
+	e, ok := m[c.String()]
+	if !ok {
+		return "", fmt.Errorf("%s not cached", c)
+	}
+	_, err := io.WriteString(w, e[1])
+	return e[0], err
+}
+
+func (m memoryCache) Store(c *Checksum, source, filename, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	m[c.String()] = [2]string{filename, string(data)}
+	return nil
+}
+
+// DummySingleFileSource "fetches" one file into a temp file, verifies it
+// and moves it into place, counting fetches
+type DummySingleFileSource struct {
+	DummyFileSource
+	fetches int
+}
+
+func (d *DummySingleFileSource) DownloadToPath(dlPath string) error {
+	d.fetches++
+	tmp, err := ioutil.TempFile("", "")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, _ = tmp.WriteString(d.files["hello.txt"])
+	_ = tmp.Close()
+	if err := d.checksums.VerifyChecksum("hello.txt", tmp.Name()); err != nil {
+		return err
+	}
+	return d.InstallFile("hello.txt", tmp.Name(), dlPath)
+}
+
+func (d *DummySingleFileSource) InstallFile(filename, path, dlPath string) error {
+	return os.Rename(path, filepath.Join(dlPath, filename))
+}
+
+var _ FileInstaller = &DummySingleFileSource{}
+
+func init() {
+	RegisterSource("go2chef.source.dummy_single", func(config map[string]interface{}) (Source, error) {
+		return &DummySingleFileSource{DummyFileSource: DummyFileSource{files: map[string]string{"hello.txt": "hello"}}}, nil
+	})
+}
+
+func TestGetSourceDownloadCache(t *testing.T) {
+	const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	mc := memoryCache{}
+	SetDownloadCache(mc)
+	defer SetDownloadCache(nil)
+
+	download := func(src Source) string {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+		if err := src.DownloadToPath(dir); err != nil {
+			t.Fatalf("download failed: %s", err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "hello.txt"))
+		if err != nil {
+			t.Fatalf("failed to read downloaded file: %s", err)
+		}
+		return string(data)
+	}
+	fetches := func(src Source) int {
+		if c, ok := src.(*cachedSource); ok {
+			src = c.Source
+		}
+		return src.(*DummySingleFileSource).fetches
+	}
+
+	for _, config := range []map[string]interface{}{
+		{"checksum": "sha256:" + helloSHA256},
+		// the older `sha256` option is a known checksum too
+		{"sha256": helloSHA256},
+	} {
+		for k := range mc {
+			delete(mc, k)
+		}
+		src, err := GetSource("go2chef.source.dummy_single", config)
+		if err != nil {
+			t.Fatalf("failed to get source: %s", err)
+		}
+		if data := download(src); data != "hello" {
+			t.Errorf("unexpected content %q", data)
+		}
+		if len(mc) != 1 {
+			t.Errorf("expected the verified file to be cached, got %v", mc)
+		}
+		if data := download(src); data != "hello" || fetches(src) != 1 {
+			t.Errorf("expected cached content without fetching, got %q after %d fetches", data, fetches(src))
+		}
+	}
+
+	// a corrupted entry is ignored in favour of fetching
+	mc["sha256:"+helloSHA256] = [2]string{"hello.txt", "tampered"}
+	src, _ := GetSource("go2chef.source.dummy_single", map[string]interface{}{"checksum": "sha256:" + helloSHA256})
+	if data := download(src); data != "hello" || fetches(src) != 1 {
+		t.Errorf("expected a fresh fetch past the corrupted entry, got %q after %d fetches", data, fetches(src))
+	}
+
+	if _, err := GetSource("go2chef.source.dummy_single", map[string]interface{}{
+		"checksum": "sha256:" + helloSHA256,
+		"sha256":   helloSHA256,
+	}); err == nil || !strings.Contains(err.Error(), "both") {
+		t.Errorf("expected `sha256` and `checksum` together to be rejected, got %v", err)
+	}
+}
+
+func TestKnownChecksum(t *testing.T) {
+	sum := &Checksum{Algorithm: "sha256", Digest: "abcd"}
+	vs := ChecksumVerifiers{&ChecksumManifest{URL: "x"}, &cachingChecksum{Checksum: sum}}
+	if KnownChecksum(vs) != sum {
+		t.Errorf("expected to find the literal checksum among verifiers")
+	}
+	if KnownChecksum(ChecksumVerifiers{&ChecksumManifest{URL: "x"}}) != nil {
+		t.Errorf("a manifest alone shouldn't count as a known checksum")
+	}
+}
@@ -11,6 +11,9 @@ import (
 )
 
 var (
+	// Version is the go2chef version, set at build time with
+	// -ldflags "-X github.com/facebookincubator/go2chef.Version=..."
+	Version = "dev"
 	// AutoRegisterPlugins is a central place for plugins to check
 	// whether they should auto-register. Normally they should.
 	AutoRegisterPlugins = true
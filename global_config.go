@@ -20,5 +20,9 @@ func LoadGlobalConfiguration(config map[string]interface{}) error {
 	if err := mapstructure.Decode(gc, &gcmap); err != nil {
 		return err
 	}
-	return GlobalConfiguration.Process(gcmap)
+	if err := GlobalConfiguration.Process(gcmap); err != nil {
+		return err
+	}
+	resetHTTPClient()
+	return nil
 }
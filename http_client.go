@@ -0,0 +1,210 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// HTTPConfiguration is the shared configuration for HTTP clients, loaded from
+// the `global.http` configuration section.
+type HTTPConfiguration struct {
+	// Proxy is the proxy URL for all requests. If empty, the standard
+	// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables are used.
+	Proxy string `mapstructure:"proxy"`
+	// NoProxy lists hosts, domains (`.example.com`), IPs and CIDRs which
+	// bypass Proxy. `*` bypasses it for everything.
+	NoProxy []string `mapstructure:"no_proxy"`
+	// UserAgentPrefix is prepended to the go2chef User-Agent
+	UserAgentPrefix string `mapstructure:"user_agent"`
+
+	ConnectTimeoutSeconds int `mapstructure:"connect_timeout_seconds"`
+	ReadTimeoutSeconds    int `mapstructure:"read_timeout_seconds"`
+	MaxIdleConns          int `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost   int `mapstructure:"max_idle_conns_per_host"`
+
+	// Retries and RetryDelaySeconds are defaults for plugins which retry
+	Retries           int `mapstructure:"retries"`
+	RetryDelaySeconds int `mapstructure:"retry_delay_seconds"`
+}
+
+// NewHTTPConfiguration returns the default HTTP configuration
+func NewHTTPConfiguration() *HTTPConfiguration {
+	return &HTTPConfiguration{
+		ConnectTimeoutSeconds: 30,
+		ReadTimeoutSeconds:    60,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   4,
+		Retries:               3,
+		RetryDelaySeconds:     1,
+	}
+}
+
+// HTTP is the global HTTP configuration
+var HTTP = NewHTTPConfiguration()
+
+// TLSClientConfig provides the TLS configuration for HTTP clients. It's
+// overridden by plugin/lib/certs to apply the `global.tls` configuration.
+var TLSClientConfig = func() (*tls.Config, error) {
+	return &tls.Config{}, nil
+}
+
+var sharedHTTPClient struct {
+	sync.Mutex
+	client *http.Client
+}
+
+// HTTPClient returns the shared HTTP client configured from `global.http`
+// and `global.tls`. Plugins should use this rather than building their own
+// so that proxy, timeout and TLS settings apply everywhere.
+func HTTPClient() (*http.Client, error) {
+	sharedHTTPClient.Lock()
+	defer sharedHTTPClient.Unlock()
+	if sharedHTTPClient.client == nil {
+		c, err := HTTP.Client()
+		if err != nil {
+			return nil, err
+		}
+		sharedHTTPClient.client = c
+	}
+	return sharedHTTPClient.client, nil
+}
+
+// HTTPClientForSDK returns a new client using a copy of the shared client's
+// transport, without the go2chef User-Agent. SDKs such as the AWS SDK set
+// their own User-Agent and may modify the transport they're given (i.e. to
+// apply AWS_CA_BUNDLE), so they need a plain *http.Transport of their own.
+func HTTPClientForSDK() (*http.Client, error) {
+	c, err := HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	t := c.Transport
+	if ua, ok := t.(*userAgentTransport); ok {
+		t = ua.next
+	}
+	if ht, ok := t.(*http.Transport); ok {
+		t = ht.Clone()
+	}
+	return &http.Client{Transport: t, Timeout: c.Timeout}, nil
+}
+
+// resetHTTPClient drops the shared client so the next HTTPClient() call
+// picks up newly loaded configuration
+func resetHTTPClient() {
+	sharedHTTPClient.Lock()
+	defer sharedHTTPClient.Unlock()
+	sharedHTTPClient.client = nil
+}
+
+// UserAgent returns the User-Agent header value for go2chef requests
+func (h *HTTPConfiguration) UserAgent() string {
+	ua := "go2chef/" + Version + " (" + runtime.GOOS + "/" + runtime.GOARCH + ")"
+	if h.UserAgentPrefix != "" {
+		ua = h.UserAgentPrefix + " " + ua
+	}
+	return ua
+}
+
+// Client builds a new HTTP client from this configuration
+func (h *HTTPConfiguration) Client() (*http.Client, error) {
+	tlsConf, err := TLSClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if h.Proxy != "" {
+		proxyURL, err := url.Parse(h.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = func(req *http.Request) (*url.URL, error) {
+			if bypassProxy(req.URL.Hostname(), h.NoProxy) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+	connectTimeout := time.Duration(h.ConnectTimeoutSeconds) * time.Second
+	return &http.Client{
+		Transport: &userAgentTransport{
+			userAgent: h.UserAgent(),
+			next: &http.Transport{
+				Proxy:                 proxy,
+				DialContext:           (&net.Dialer{Timeout: connectTimeout}).DialContext,
+				TLSHandshakeTimeout:   connectTimeout,
+				ResponseHeaderTimeout: time.Duration(h.ReadTimeoutSeconds) * time.Second,
+				MaxIdleConns:          h.MaxIdleConns,
+				MaxIdleConnsPerHost:   h.MaxIdleConnsPerHost,
+				IdleConnTimeout:       90 * time.Second,
+				TLSClientConfig:       tlsConf,
+			},
+		},
+	}, nil
+}
+
+// bypassProxy returns whether host matches any no_proxy entry
+func bypassProxy(host string, noProxy []string) bool {
+	ip := net.ParseIP(host)
+	for _, np := range noProxy {
+		np = strings.ToLower(strings.TrimSpace(np))
+		switch {
+		case np == "":
+		case np == "*":
+			return true
+		case ip != nil && strings.Contains(np, "/"):
+			if _, cidr, err := net.ParseCIDR(np); err == nil && cidr.Contains(ip) {
+				return true
+			}
+		case ip != nil:
+			if ip.Equal(net.ParseIP(np)) {
+				return true
+			}
+		default:
+			h := strings.ToLower(host)
+			d := strings.TrimPrefix(np, ".")
+			if h == d || strings.HasSuffix(h, "."+d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// userAgentTransport sets the User-Agent on requests which don't have one
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+func (u *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", u.userAgent)
+	}
+	return u.next.RoundTrip(req)
+}
+
+func httpProcessor(f string, data interface{}) error {
+	h := NewHTTPConfiguration()
+	if err := mapstructure.Decode(data, h); err != nil {
+		return err
+	}
+	HTTP = h
+	return nil
+}
+
+func init() {
+	GlobalConfiguration.MustRegister("http", httpProcessor)
+}
@@ -0,0 +1,88 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHTTPProcessor(t *testing.T) {
+	defer func() { HTTP = NewHTTPConfiguration() }()
+
+	if err := httpProcessor("http", map[string]interface{}{
+		"proxy":      "http://proxy.example.com:3128",
+		"no_proxy":   []string{".internal.example.com", "10.0.0.0/8"},
+		"user_agent": "fleet-bootstrap/1.0",
+		"retries":    5,
+	}); err != nil {
+		t.Fatalf("failed to process http configuration: %s", err)
+	}
+	if HTTP.Proxy != "http://proxy.example.com:3128" || len(HTTP.NoProxy) != 2 || HTTP.Retries != 5 {
+		t.Errorf("unexpected http configuration: %#v", HTTP)
+	}
+	if HTTP.ConnectTimeoutSeconds != NewHTTPConfiguration().ConnectTimeoutSeconds {
+		t.Errorf("unset fields should keep their defaults: %#v", HTTP)
+	}
+
+	c, err := HTTP.Client()
+	if err != nil {
+		t.Fatalf("failed to build client: %s", err)
+	}
+	proxy := c.Transport.(*userAgentTransport).next.(*http.Transport).Proxy
+	for target, exp := range map[string]string{
+		"https://artifacts.example.com/chef.rpm":  "http://proxy.example.com:3128",
+		"https://a.internal.example.com/chef.rpm": "",
+		"https://internal.example.com/chef.rpm":   "",
+		"http://10.1.2.3/chef.rpm":                "",
+		"http://notinternal.example.com/chef.rpm": "http://proxy.example.com:3128",
+		"http://192.168.0.1/chef.rpm":             "http://proxy.example.com:3128",
+	} {
+		u, _ := url.Parse(target)
+		p, err := proxy(&http.Request{URL: u})
+		if err != nil {
+			t.Fatalf("proxy func failed for %s: %s", target, err)
+		}
+		if got := ""; p != nil {
+			got = p.String()
+			if got != exp {
+				t.Errorf("proxy for %s: expected %q, got %q", target, exp, got)
+			}
+		} else if exp != "" {
+			t.Errorf("proxy for %s: expected %q, got none", target, exp)
+		}
+	}
+}
+
+func TestHTTPClientUserAgent(t *testing.T) {
+	defer func() { HTTP = NewHTTPConfiguration(); resetHTTPClient() }()
+	HTTP.UserAgentPrefix = "fleet-bootstrap/1.0"
+	resetHTTPClient()
+
+	var ua string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+	}))
+	defer ts.Close()
+
+	c, err := HTTPClient()
+	if err != nil {
+		t.Fatalf("failed to get shared client: %s", err)
+	}
+	if c2, _ := HTTPClient(); c2 != c {
+		t.Errorf("HTTPClient should return the shared client")
+	}
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(ua, "fleet-bootstrap/1.0 go2chef/"+Version) {
+		t.Errorf("unexpected User-Agent: %q", ua)
+	}
+}
@@ -125,12 +125,18 @@ func GetLogger(name string, config map[string]interface{}) (Logger, error) {
 //
 // Provide a single central point-of-logging
 
-var globalLogger Logger
+var (
+	globalLogger Logger
+	// earlyEvents holds events written before the global logger is
+	// initialized (i.e. by configuration sources) so they aren't lost.
+	earlyEvents = &eventBuffer{}
+)
 
-// GetGlobalLogger gets an instance of the global logger
+// GetGlobalLogger gets an instance of the global logger. Before the global
+// logger is initialized, events are buffered and replayed on initialization.
 func GetGlobalLogger() Logger {
 	if globalLogger == nil {
-		return NewMultiLogger([]Logger{})
+		return NewMultiLogger([]Logger{earlyEvents})
 	}
 	return globalLogger
 }
@@ -138,9 +144,37 @@ func GetGlobalLogger() Logger {
 // InitGlobalLogger initializes the global logger
 func InitGlobalLogger(loggers []Logger) {
 	globalLogger = NewMultiLogger(loggers)
+	earlyEvents.replay(globalLogger)
 }
 
 // ShutdownGlobalLogger shuts down the global logger
 func ShutdownGlobalLogger() {
 	globalLogger.Shutdown()
 }
+
+// eventBuffer is a Logger which discards messages but keeps events
+type eventBuffer struct {
+	events []*Event
+}
+
+func (b *eventBuffer) String() string                     { return "eventBuffer" }
+func (b *eventBuffer) Name() string                       { return "eventBuffer" }
+func (b *eventBuffer) SetName(string)                     {}
+func (b *eventBuffer) Type() string                       { return "go2chef.logger.event_buffer" }
+func (b *eventBuffer) SetLevel(int)                       {}
+func (b *eventBuffer) SetDebug(int)                       {}
+func (b *eventBuffer) Debugf(int, string, ...interface{}) {}
+func (b *eventBuffer) Infof(string, ...interface{})       {}
+func (b *eventBuffer) Errorf(string, ...interface{})      {}
+func (b *eventBuffer) Shutdown()                          {}
+func (b *eventBuffer) WriteEvent(e *Event)                { b.events = append(b.events, e) }
+
+// replay writes all buffered events to l and empties the buffer
+func (b *eventBuffer) replay(l Logger) {
+	for _, e := range b.events {
+		l.WriteEvent(e)
+	}
+	b.events = nil
+}
+
+var _ Logger = &eventBuffer{}
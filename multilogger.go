@@ -46,22 +46,25 @@ func (m *MultiLogger) Type() string {
 
 // Errorf logs a formatted message at ERROR level
 func (m *MultiLogger) Errorf(s string, v ...interface{}) {
+	msg := Redact(fmt.Sprintf(stack2()+s, v...))
 	for _, l := range m.loggers {
-		l.Errorf(stack2()+s, v...)
+		l.Errorf("%s", msg)
 	}
 }
 
 // Infof logs a formatted message at INFO level
 func (m *MultiLogger) Infof(s string, v ...interface{}) {
+	msg := Redact(fmt.Sprintf(stack2()+s, v...))
 	for _, l := range m.loggers {
-		l.Infof(stack2()+s, v...)
+		l.Infof("%s", msg)
 	}
 }
 
 // Debugf logs a formatted message at DEBUG level
 func (m *MultiLogger) Debugf(dbg int, s string, v ...interface{}) {
+	msg := Redact(fmt.Sprintf(stack2()+s, v...))
 	for _, l := range m.loggers {
-		l.Debugf(dbg, stack2()+s, v...)
+		l.Debugf(dbg, "%s", msg)
 	}
 }
 
@@ -75,10 +78,19 @@ func (m *MultiLogger) SetDebug(d int) {
 	m.debug = d
 }
 
-// WriteEvent writes an event to all loggers on this MultiLogger
+// WriteEvent writes an event to all loggers on this MultiLogger, with
+// registered secrets redacted from its message and extra fields
 func (m *MultiLogger) WriteEvent(e *Event) {
+	redacted := *e
+	redacted.Message = Redact(e.Message)
+	if e.ExtraFields != nil {
+		extra := *e.ExtraFields
+		extra.StepName = Redact(extra.StepName)
+		extra.StepType = Redact(extra.StepType)
+		redacted.ExtraFields = &extra
+	}
 	for _, l := range m.loggers {
-		l.WriteEvent(e)
+		l.WriteEvent(&redacted)
 	}
 }
 
@@ -0,0 +1,185 @@
+// Package chain is a configuration source which tries several other
+// configuration sources in order, optionally caching the last configuration
+// fetched so it can be used when every source fails.
+package chain
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/spf13/pflag"
+)
+
+// TypeName is the name of this configuration source
+const TypeName = "go2chef.config_source.chain"
+
+// ConfigSource tries each configuration source in Sources in order and uses
+// the first which succeeds. If CachePath is set, the winning configuration is
+// cached there and used as a last resort when all sources fail.
+type ConfigSource struct {
+	Sources   []string
+	CachePath string
+}
+
+// cacheEntry is the on-disk format of the configuration cache
+type cacheEntry struct {
+	Source     string                   `json:"source"`
+	Validators go2chef.ConfigValidators `json:"validators"`
+	Config     []byte                   `json:"config"`
+	Signature  []byte                   `json:"signature,omitempty"`
+	Fetched    time.Time                `json:"fetched"`
+}
+
+// InitFlags sets the command-line flags for chained configuration sources
+func (c *ConfigSource) InitFlags(set *pflag.FlagSet) {
+	set.StringSliceVar(&c.Sources, "chain-config-sources", nil, "configuration sources to try in order (comma-separated)")
+	set.StringVar(&c.CachePath, "chain-config-cache", "", "path to cache the last successfully fetched configuration")
+}
+
+// ReadConfig loads the configuration from the first working source
+func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
+	data, _, err := c.ReadSignedConfig()
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[string]interface{})
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// ReadSignedConfig loads the configuration and signature from the first
+// working source, falling back to the cache
+func (c *ConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	if len(c.Sources) == 0 {
+		return nil, nil, errors.New("no configuration sources in chain (set --chain-config-sources)")
+	}
+	cache := c.readCache()
+
+	var failures []string
+	for _, name := range c.Sources {
+		data, sig, err := c.try(name, cache)
+		if err == nil {
+			return data, sig, nil
+		}
+		go2chef.EarlyLogger.Printf("config source %s failed: %s", name, err)
+		failures = append(failures, name+": "+err.Error())
+	}
+
+	if cache != nil {
+		go2chef.EarlyLogger.Printf("all config sources failed, using cached config from %s fetched %s", cache.Source, cache.Fetched)
+		go2chef.GetGlobalLogger().WriteEvent(go2chef.NewEvent("CONFIG_SOURCE_SELECTED", TypeName,
+			"cache ("+c.CachePath+") from "+cache.Source+" fetched "+cache.Fetched.Format(time.RFC3339)))
+		return cache.Config, cache.Signature, nil
+	}
+	return nil, nil, fmt.Errorf("all configuration sources failed: %s", strings.Join(failures, "; "))
+}
+
+// try reads configuration from a single source, updating the cache
+func (c *ConfigSource) try(name string, cache *cacheEntry) ([]byte, []byte, error) {
+	if name == TypeName {
+		return nil, nil, errors.New("chain cannot contain itself")
+	}
+	cs := go2chef.GetConfigSource(name)
+	if cs == nil {
+		return nil, nil, &go2chef.ErrComponentDoesNotExist{Component: "ConfigSource::" + name}
+	}
+
+	var (
+		data, sig []byte
+		v         go2chef.ConfigValidators
+		err       error
+	)
+	if ccs, ok := cs.(go2chef.ConditionalConfigSource); ok {
+		prev := go2chef.ConfigValidators{}
+		if cache != nil && cache.Source == name {
+			prev = cache.Validators
+		}
+		data, sig, v, err = ccs.ReadConfigIfModified(prev)
+		if err == go2chef.ErrConfigNotModified {
+			go2chef.GetGlobalLogger().WriteEvent(go2chef.NewEvent("CONFIG_SOURCE_SELECTED", TypeName, name+" (not modified, using cache)"))
+			return cache.Config, cache.Signature, nil
+		}
+	} else {
+		data, sig, err = go2chef.ReadRawConfig(cs)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	go2chef.GetGlobalLogger().WriteEvent(go2chef.NewEvent("CONFIG_SOURCE_SELECTED", TypeName, name))
+	c.writeCache(&cacheEntry{
+		Source:     name,
+		Validators: v,
+		Config:     data,
+		Signature:  sig,
+		Fetched:    time.Now(),
+	})
+	return data, sig, nil
+}
+
+// readCache loads the cache, returning nil if caching is disabled or the
+// cache can't be read
+func (c *ConfigSource) readCache() *cacheEntry {
+	if c.CachePath == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(c.CachePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			go2chef.EarlyLogger.Printf("failed to read config cache %s: %s", c.CachePath, err)
+		}
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		go2chef.EarlyLogger.Printf("ignoring corrupt config cache %s: %s", c.CachePath, err)
+		return nil
+	}
+	return entry
+}
+
+// writeCache atomically replaces the cache. Failures are logged but not
+// fatal since the configuration itself was fetched successfully.
+func (c *ConfigSource) writeCache(entry *cacheEntry) {
+	if c.CachePath == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		go2chef.EarlyLogger.Printf("failed to serialize config cache: %s", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.CachePath), 0700); err != nil {
+		go2chef.EarlyLogger.Printf("failed to create config cache directory: %s", err)
+		return
+	}
+	tmp := c.CachePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		go2chef.EarlyLogger.Printf("failed to write config cache %s: %s", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, c.CachePath); err != nil {
+		go2chef.EarlyLogger.Printf("failed to replace config cache %s: %s", c.CachePath, err)
+	}
+}
+
+var _ go2chef.SignedConfigSource = &ConfigSource{}
+
+func init() {
+	if go2chef.AutoRegisterPlugins {
+		go2chef.RegisterConfigSource(TypeName, &ConfigSource{})
+	}
+}
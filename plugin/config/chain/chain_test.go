@@ -0,0 +1,92 @@
+package chain
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/spf13/pflag"
+)
+
+type testConfigSource struct {
+	data  []byte
+	etag  string
+	err   error
+	calls int
+}
+
+func (t *testConfigSource) InitFlags(set *pflag.FlagSet) {}
+func (t *testConfigSource) ReadConfig() (map[string]interface{}, error) {
+	return nil, errors.New("unused")
+}
+func (t *testConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	data, sig, _, err := t.ReadConfigIfModified(go2chef.ConfigValidators{})
+	return data, sig, err
+}
+func (t *testConfigSource) ReadConfigIfModified(v go2chef.ConfigValidators) ([]byte, []byte, go2chef.ConfigValidators, error) {
+	t.calls++
+	if t.err != nil {
+		return nil, nil, v, t.err
+	}
+	if v.ETag != "" && v.ETag == t.etag {
+		return nil, nil, v, go2chef.ErrConfigNotModified
+	}
+	return t.data, nil, go2chef.ConfigValidators{ETag: t.etag}, nil
+}
+
+func TestConfigSource(t *testing.T) {
+	down := &testConfigSource{err: errors.New("connection refused")}
+	up := &testConfigSource{data: []byte(`{"key":"value"}`), etag: `"v1"`}
+	go2chef.RegisterConfigSource("chain-test-down", down)
+	go2chef.RegisterConfigSource("chain-test-up", up)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cs := &ConfigSource{
+		Sources:   []string{"chain-test-down", "chain-test-up"},
+		CachePath: filepath.Join(dir, "config.cache"),
+	}
+
+	// first read falls through to the working source and fills the cache
+	if cr, err := cs.ReadConfig(); err != nil {
+		t.Fatalf("failed to read config: %s", err)
+	} else if cr["key"] != "value" {
+		t.Errorf("config[key] != value")
+	}
+	if _, err := os.Stat(cs.CachePath); err != nil {
+		t.Errorf("cache was not written: %s", err)
+	}
+
+	// unchanged remote config is served from the cache
+	up.data = nil
+	if cr, err := cs.ReadConfig(); err != nil {
+		t.Fatalf("failed to read config via not-modified cache: %s", err)
+	} else if cr["key"] != "value" {
+		t.Errorf("config[key] != value when not modified")
+	}
+
+	// cache is used when every source is down
+	up.err = errors.New("timeout")
+	if cr, err := cs.ReadConfig(); err != nil {
+		t.Fatalf("failed to read config from cache: %s", err)
+	} else if cr["key"] != "value" {
+		t.Errorf("config[key] != value from cache")
+	}
+
+	// ...but not when caching is disabled
+	cs.CachePath = ""
+	if _, err := cs.ReadConfig(); err == nil {
+		t.Errorf("expected error when all sources fail without a cache")
+	}
+}
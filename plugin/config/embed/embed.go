@@ -6,6 +6,8 @@ package embed
 */
 
 import (
+	"encoding/json"
+
 	"github.com/facebookincubator/go2chef"
 	"github.com/spf13/pflag"
 )
@@ -24,12 +26,27 @@ func (c *ConfigSource) InitFlags(set *pflag.FlagSet) {}
 // variable in an init() function in your own package to parse/store it.
 var EmbeddedConfig = make(map[string]interface{})
 
+// EmbeddedConfigSignature holds the detached signature for EmbeddedConfig
+// for use when go2chef.TrustedConfigKeys is set. The signature must cover
+// the output of json.Marshal(EmbeddedConfig).
+var EmbeddedConfigSignature []byte
+
 // ReadConfig reads the configuration source
 func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
 	return EmbeddedConfig, nil
 }
 
-var _ go2chef.ConfigSource = &ConfigSource{}
+// ReadSignedConfig returns the JSON-serialized embedded configuration
+// and its embedded signature
+func (c *ConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	data, err := json.Marshal(EmbeddedConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, EmbeddedConfigSignature, nil
+}
+
+var _ go2chef.SignedConfigSource = &ConfigSource{}
 
 func init() {
 	if go2chef.AutoRegisterPlugins {
@@ -0,0 +1,103 @@
+// Package env is a configuration source that reads configuration from an
+// environment variable
+package env
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/spf13/pflag"
+)
+
+// TypeName is the name of this configuration source
+const TypeName = "go2chef.config_source.env"
+
+// DefaultVariable is the environment variable read by default
+const DefaultVariable = "GO2CHEF_CONFIG"
+
+// ConfigSource loads configuration data from an environment variable holding
+// either JSON or base64-encoded JSON. The detached signature, if any, is read
+// from the same variable name with a `_SIG` suffix.
+type ConfigSource struct {
+	Variable string
+}
+
+// InitFlags sets the command-line flags for environment configuration sources
+func (c *ConfigSource) InitFlags(set *pflag.FlagSet) {
+	set.StringVar(&c.Variable, "env-config", DefaultVariable, "environment variable holding JSON or base64 JSON configuration")
+}
+
+// ReadConfig loads the configuration from the environment
+func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
+	data, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[string]interface{})
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// ReadSignedConfig loads the configuration and its signature from the
+// environment
+func (c *ConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	data, err := c.read()
+	if err != nil {
+		return nil, nil, err
+	}
+	if sig, ok := os.LookupEnv(c.Variable + "_SIG"); ok {
+		return data, []byte(sig), nil
+	}
+	return data, nil, nil
+}
+
+func (c *ConfigSource) read() ([]byte, error) {
+	val, ok := os.LookupEnv(c.Variable)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", c.Variable)
+	}
+	val = strings.TrimSpace(val)
+	if strings.HasPrefix(val, "{") {
+		return []byte(val), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s is neither JSON nor base64: %s", c.Variable, err)
+	}
+	return data, nil
+}
+
+// URILoader configures an environment configuration source from an
+// `env://VARIABLE` (or `env:VARIABLE`) URI
+func URILoader(u *url.URL) (go2chef.ConfigSource, error) {
+	variable := u.Host
+	if u.Opaque != "" {
+		variable = u.Opaque
+	}
+	if variable == "" {
+		return nil, errors.New("env: config URI has no variable name")
+	}
+	return &ConfigSource{Variable: variable}, nil
+}
+
+var _ go2chef.SignedConfigSource = &ConfigSource{}
+var _ go2chef.ConfigSourceURILoader = URILoader
+
+func init() {
+	if go2chef.AutoRegisterPlugins {
+		go2chef.RegisterConfigSource(TypeName, &ConfigSource{Variable: DefaultVariable})
+		go2chef.RegisterConfigSourceScheme("env", URILoader)
+	}
+}
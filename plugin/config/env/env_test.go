@@ -0,0 +1,35 @@
+package env
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+)
+
+func TestConfigSource(t *testing.T) {
+	const variable = "GO2CHEF_TEST_CONFIG"
+	defer os.Unsetenv(variable)
+
+	cs := &ConfigSource{Variable: variable}
+	if _, err := cs.ReadConfig(); err == nil {
+		t.Errorf("expected error reading unset variable")
+	}
+
+	for _, val := range []string{
+		`{"key":"value"}`,
+		base64.StdEncoding.EncodeToString([]byte(`{"key":"value"}`)),
+	} {
+		os.Setenv(variable, val)
+		cr, err := cs.ReadConfig()
+		if err != nil {
+			t.Fatalf("failed to read config from %q: %s", val, err)
+		}
+		if v, ok := cr["key"]; !ok || v != "value" {
+			t.Errorf("config[key] != value for %q", val)
+		}
+	}
+}
@@ -6,7 +6,10 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 
 	"github.com/facebookincubator/go2chef"
 	"github.com/spf13/pflag"
@@ -27,10 +30,15 @@ func (c *ConfigSource) InitFlags(set *pflag.FlagSet) {
 
 // ReadConfig loads the configuration file from http
 func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
-	r, err := http.Get(c.URL)
+	client, err := go2chef.HTTPClient()
 	if err != nil {
 		return nil, err
 	}
+	r, err := client.Get(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
 	output := make(map[string]interface{})
 	if err := json.NewDecoder(r.Body).Decode(&output); err != nil {
 		return nil, err
@@ -38,10 +46,92 @@ func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
 	return output, nil
 }
 
-var _ go2chef.ConfigSource = &ConfigSource{}
+// ReadSignedConfig loads the configuration file and its detached signature
+// (the config URL path with a `.sig` suffix) from http
+func (c *ConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	data, sig, _, err := c.ReadConfigIfModified(go2chef.ConfigValidators{})
+	return data, sig, err
+}
+
+// ReadConfigIfModified loads the configuration file and its signature using
+// a conditional request (If-None-Match/If-Modified-Since)
+func (c *ConfigSource) ReadConfigIfModified(v go2chef.ConfigValidators) ([]byte, []byte, go2chef.ConfigValidators, error) {
+	data, hdr, err := fetch(c.URL, v)
+	if err != nil {
+		return nil, nil, v, err
+	}
+	if data == nil {
+		return nil, nil, v, fmt.Errorf("configuration not found at %s", c.URL)
+	}
+	nv := go2chef.ConfigValidators{
+		ETag:         hdr.Get("ETag"),
+		LastModified: hdr.Get("Last-Modified"),
+	}
+	// only look for a signature if something is going to check it
+	if len(go2chef.TrustedConfigKeys) == 0 {
+		return data, nil, nv, nil
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, nil, v, err
+	}
+	u.Path += go2chef.ConfigSignatureSuffix
+	sig, _, err := fetch(u.String(), go2chef.ConfigValidators{})
+	if err != nil {
+		return nil, nil, v, err
+	}
+	return data, sig, nv, nil
+}
+
+// fetch GETs a URL, returning nil data if the server responds 404 and
+// go2chef.ErrConfigNotModified if the validators match.
+func fetch(u string, v go2chef.ConfigValidators) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+	client, err := go2chef.HTTPClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Body.Close()
+
+	switch {
+	case r.StatusCode == http.StatusNotModified:
+		return nil, r.Header, go2chef.ErrConfigNotModified
+	case r.StatusCode == http.StatusNotFound:
+		return nil, r.Header, nil
+	case r.StatusCode < 200 || r.StatusCode > 299:
+		return nil, nil, fmt.Errorf("GET %s returned %d %s", u, r.StatusCode, http.StatusText(r.StatusCode))
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	return data, r.Header, err
+}
+
+// URILoader configures an http configuration source from an `http:` or
+// `https:` URI
+func URILoader(u *url.URL) (go2chef.ConfigSource, error) {
+	return &ConfigSource{URL: u.String()}, nil
+}
+
+var _ go2chef.ConditionalConfigSource = &ConfigSource{}
+var _ go2chef.ConfigSourceURILoader = URILoader
 
 func init() {
 	if go2chef.AutoRegisterPlugins {
 		go2chef.RegisterConfigSource(TypeName, &ConfigSource{})
+		go2chef.RegisterConfigSourceScheme("http", URILoader)
+		go2chef.RegisterConfigSourceScheme("https", URILoader)
 	}
 }
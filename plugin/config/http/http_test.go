@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/facebookincubator/go2chef"
 )
 
 func TestConfigSource(t *testing.T) {
@@ -32,3 +34,64 @@ func TestConfigSource(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigSource_ReadSignedConfig(t *testing.T) {
+	defer func(keys []string) { go2chef.TrustedConfigKeys = keys }(go2chef.TrustedConfigKeys)
+	go2chef.TrustedConfigKeys = []string{"unused"}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config.json":
+			_, _ = fmt.Fprint(w, `{"key":"value"}`)
+		case "/config.json.sig":
+			_, _ = fmt.Fprint(w, "signature")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	cs := &ConfigSource{URL: ts.URL + "/config.json"}
+	data, sig, err := cs.ReadSignedConfig()
+	if err != nil {
+		t.Fatalf("failed to read signed config: %s", err)
+	}
+	if string(data) != `{"key":"value"}` {
+		t.Errorf("unexpected config data: %s", data)
+	}
+	if string(sig) != "signature" {
+		t.Errorf("unexpected signature data: %s", sig)
+	}
+
+	cs = &ConfigSource{URL: ts.URL + "/missing.json"}
+	if _, _, err := cs.ReadSignedConfig(); err == nil {
+		t.Errorf("expected error reading missing config")
+	}
+}
+
+func TestConfigSource_ReadSignedConfigNoTrustedKeys(t *testing.T) {
+	defer func(keys []string) { go2chef.TrustedConfigKeys = keys }(go2chef.TrustedConfigKeys)
+	go2chef.TrustedConfigKeys = nil
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config.json":
+			_, _ = fmt.Fprint(w, `{"key":"value"}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+
+	cs := &ConfigSource{URL: ts.URL + "/config.json"}
+	data, sig, err := cs.ReadSignedConfig()
+	if err != nil {
+		t.Fatalf("failed to read config: %s", err)
+	}
+	if string(data) != `{"key":"value"}` {
+		t.Errorf("unexpected config data: %s", data)
+	}
+	if sig != nil {
+		t.Errorf("expected no signature without trusted keys, got %s", sig)
+	}
+}
@@ -0,0 +1,193 @@
+// Package imds is a configuration source that reads configuration from cloud
+// instance user-data or metadata served by an IMDS-style HTTP endpoint
+package imds
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/spf13/pflag"
+)
+
+// TypeName is the name of this configuration source
+const TypeName = "go2chef.config_source.imds"
+
+const (
+	// DefaultEndpoint is the link-local instance metadata endpoint
+	DefaultEndpoint = "http://169.254.169.254"
+	// DefaultPath is the user-data path on DefaultEndpoint
+	DefaultPath = "/latest/user-data"
+	// DefaultTokenPath is the IMDSv2 session token path on DefaultEndpoint
+	DefaultTokenPath = "/latest/api/token"
+
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	tokenTTL       = "300"
+)
+
+// ConfigSource loads configuration data from an instance metadata service.
+// If TokenPath is set an IMDSv2 session token is requested first, falling
+// back to unauthenticated (IMDSv1) requests if the endpoint doesn't
+// support tokens.
+type ConfigSource struct {
+	Endpoint      string
+	Path          string
+	TokenPath     string
+	SignaturePath string
+	Timeout       time.Duration
+}
+
+// InitFlags sets the command-line flags for IMDS configuration sources
+func (c *ConfigSource) InitFlags(set *pflag.FlagSet) {
+	set.StringVar(&c.Endpoint, "imds-config-endpoint", DefaultEndpoint, "instance metadata service endpoint")
+	set.StringVar(&c.Path, "imds-config-path", DefaultPath, "path of the configuration on the metadata endpoint")
+	set.StringVar(&c.TokenPath, "imds-config-token-path", DefaultTokenPath, "IMDSv2 token path on the metadata endpoint (empty disables the token handshake)")
+	set.StringVar(&c.SignaturePath, "imds-config-sig-path", "", "path of the configuration signature on the metadata endpoint")
+	set.DurationVar(&c.Timeout, "imds-config-timeout", 10*time.Second, "timeout for instance metadata requests")
+}
+
+// ReadConfig loads the configuration from instance metadata
+func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
+	client := c.client()
+	token, err := c.token(client)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.get(client, token, c.Path)
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[string]interface{})
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// ReadSignedConfig loads the configuration and, if --imds-config-sig-path
+// is set, its signature from instance metadata
+func (c *ConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	client := c.client()
+	token, err := c.token(client)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := c.get(client, token, c.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.SignaturePath == "" {
+		return data, nil, nil
+	}
+	sig, err := c.get(client, token, c.SignaturePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, sig, nil
+}
+
+// client builds a dedicated client rather than using go2chef.HTTPClient():
+// the metadata endpoint is link-local, so global proxy settings must not
+// apply, and the global configuration isn't loaded yet anyway.
+func (c *ConfigSource) client() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{Proxy: nil},
+		Timeout:   c.Timeout,
+	}
+}
+
+func (c *ConfigSource) url(path string) string {
+	return strings.TrimRight(c.Endpoint, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// token performs the IMDSv2 session token handshake. An empty token means
+// IMDSv1 requests should be used.
+func (c *ConfigSource) token(client *http.Client) (string, error) {
+	if c.TokenPath == "" {
+		return "", nil
+	}
+	req, err := http.NewRequest(http.MethodPut, c.url(c.TokenPath), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(tokenTTLHeader, tokenTTL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusNotFound, http.StatusMethodNotAllowed:
+		go2chef.EarlyLogger.Printf("IMDS token request returned %d, falling back to IMDSv1", resp.StatusCode)
+		return "", nil
+	default:
+		return "", fmt.Errorf("IMDS token request returned %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	tok, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(tok)), nil
+}
+
+func (c *ConfigSource) get(client *http.Client, token, path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, c.url(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set(tokenHeader, token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("IMDS GET %s returned %d %s", path, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// URILoader configures an IMDS configuration source from an `imds:` URI.
+// The URI path selects the metadata path and an optional host overrides the
+// default endpoint, i.e. `imds:///latest/user-data`.
+func URILoader(u *url.URL) (go2chef.ConfigSource, error) {
+	c := &ConfigSource{
+		Endpoint:      DefaultEndpoint,
+		Path:          DefaultPath,
+		TokenPath:     DefaultTokenPath,
+		SignaturePath: u.Query().Get("sig"),
+		Timeout:       10 * time.Second,
+	}
+	if u.Host != "" {
+		c.Endpoint = "http://" + u.Host
+	}
+	if u.Path != "" && u.Path != "/" {
+		c.Path = u.Path
+	}
+	return c, nil
+}
+
+var _ go2chef.SignedConfigSource = &ConfigSource{}
+var _ go2chef.ConfigSourceURILoader = URILoader
+
+func init() {
+	if go2chef.AutoRegisterPlugins {
+		go2chef.RegisterConfigSource(TypeName, &ConfigSource{})
+		go2chef.RegisterConfigSourceScheme("imds", URILoader)
+	}
+}
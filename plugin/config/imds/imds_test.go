@@ -0,0 +1,75 @@
+package imds
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConfigSource(t *testing.T) {
+	const token = "t0k3n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == DefaultTokenPath:
+			if r.Header.Get(tokenTTLHeader) == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = fmt.Fprint(w, token)
+		case r.Method == http.MethodGet && r.URL.Path == DefaultPath:
+			if r.Header.Get(tokenHeader) != token {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"key":"value"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	cs := &ConfigSource{
+		Endpoint:  ts.URL,
+		Path:      DefaultPath,
+		TokenPath: DefaultTokenPath,
+		Timeout:   5 * time.Second,
+	}
+	if cr, err := cs.ReadConfig(); err != nil {
+		t.Fatalf("failed to read config: %s", err)
+	} else if v, ok := cr["key"]; !ok || v != "value" {
+		t.Errorf("config[key] != value")
+	}
+
+	// without the token handshake the endpoint refuses the request
+	cs.TokenPath = ""
+	if _, err := cs.ReadConfig(); err == nil {
+		t.Errorf("expected error reading config without IMDSv2 token")
+	}
+}
+
+func TestConfigSourceIMDSv1Fallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == DefaultPath {
+			_, _ = fmt.Fprint(w, `{"key":"value"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	cs := &ConfigSource{
+		Endpoint:  ts.URL,
+		Path:      DefaultPath,
+		TokenPath: DefaultTokenPath,
+		Timeout:   5 * time.Second,
+	}
+	if _, err := cs.ReadConfig(); err != nil {
+		t.Fatalf("failed to read config with IMDSv1 fallback: %s", err)
+	}
+}
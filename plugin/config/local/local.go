@@ -7,6 +7,11 @@ package local
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/facebookincubator/go2chef"
 	"github.com/spf13/pflag"
@@ -38,10 +43,45 @@ func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
 	return output, nil
 }
 
-var _ go2chef.ConfigSource = &ConfigSource{}
+// ReadSignedConfig loads the configuration file and its detached signature
+// (the config path with a `.sig` suffix) from disk
+func (c *ConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := ioutil.ReadFile(c.Path + go2chef.ConfigSignatureSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return data, nil, nil
+		}
+		return nil, nil, err
+	}
+	return data, sig, nil
+}
+
+// URILoader configures a local configuration source from a `file:` URI.
+// Both `file:///abs/path` and `file://relative/path` are accepted.
+func URILoader(u *url.URL) (go2chef.ConfigSource, error) {
+	p := u.Path
+	if u.Opaque != "" {
+		p = u.Opaque
+	} else if u.Host != "" && u.Host != "localhost" {
+		p = u.Host + u.Path
+	}
+	// file:///C:/go2chef.json => C:/go2chef.json
+	if runtime.GOOS == "windows" && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = strings.TrimPrefix(p, "/")
+	}
+	return &ConfigSource{Path: filepath.FromSlash(p)}, nil
+}
+
+var _ go2chef.SignedConfigSource = &ConfigSource{}
+var _ go2chef.ConfigSourceURILoader = URILoader
 
 func init() {
 	if go2chef.AutoRegisterPlugins {
 		go2chef.RegisterConfigSource(TypeName, &ConfigSource{})
+		go2chef.RegisterConfigSourceScheme("file", URILoader)
 	}
 }
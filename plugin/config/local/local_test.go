@@ -6,6 +6,8 @@ package local
 
 import (
 	"io/ioutil"
+	"net/url"
+	"path/filepath"
 	"testing"
 )
 
@@ -37,3 +39,23 @@ func TestConfigSource(t *testing.T) {
 		}
 	}
 }
+
+func TestURILoader(t *testing.T) {
+	for uri, exp := range map[string]string{
+		"file:///etc/go2chef.json": "/etc/go2chef.json",
+		"file://configs/a.json":    "configs/a.json",
+		"file:b.json":              "b.json",
+	} {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", uri, err)
+		}
+		cs, err := URILoader(u)
+		if err != nil {
+			t.Fatalf("failed to load config source from %s: %s", uri, err)
+		}
+		if p := cs.(*ConfigSource).Path; p != filepath.FromSlash(exp) {
+			t.Errorf("%s: expected path %s, got %s", uri, exp, p)
+		}
+	}
+}
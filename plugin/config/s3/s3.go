@@ -0,0 +1,129 @@
+// Package s3 is a configuration source that reads JSON configuration from
+// an AWS S3 object
+package s3
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/facebookincubator/go2chef"
+	"github.com/spf13/pflag"
+)
+
+// TypeName is the name of this configuration source
+const TypeName = "go2chef.config_source.s3"
+
+// ConfigSource loads configuration data from a JSON object in S3. AWS
+// credentials come from the default credential chain.
+type ConfigSource struct {
+	Region string
+	Bucket string
+	Key    string
+}
+
+// InitFlags sets the command-line flags for S3 configuration sources
+func (c *ConfigSource) InitFlags(set *pflag.FlagSet) {
+	set.StringVar(&c.Region, "s3-config-region", "", "AWS region of the configuration bucket")
+	set.StringVar(&c.Bucket, "s3-config-bucket", "", "S3 bucket holding the configuration")
+	set.StringVar(&c.Key, "s3-config-key", "", "S3 key of the configuration")
+}
+
+// ReadConfig loads the configuration object from S3
+func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
+	data, _, err := c.ReadSignedConfig()
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[string]interface{})
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// ReadSignedConfig loads the configuration object and its detached signature
+// (the key with a `.sig` suffix) from S3
+func (c *ConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	if c.Bucket == "" || c.Key == "" {
+		return nil, nil, errors.New("S3 configuration bucket and key must be set")
+	}
+	client, err := go2chef.HTTPClientForSDK()
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := aws.NewConfig().WithHTTPClient(client)
+	if c.Region != "" {
+		cfg = cfg.WithRegion(c.Region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	svc := s3.New(sess)
+
+	data, err := c.get(svc, c.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	// only look for a signature if something is going to check it, so
+	// that buckets without signatures (or without read access to them)
+	// keep working
+	if len(go2chef.TrustedConfigKeys) == 0 {
+		return data, nil, nil
+	}
+	sig, err := c.get(svc, c.Key+go2chef.ConfigSignatureSuffix)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return data, nil, nil
+		}
+		return nil, nil, err
+	}
+	return data, sig, nil
+}
+
+func (c *ConfigSource) get(svc *s3.S3, key string) ([]byte, error) {
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// URILoader configures an S3 configuration source from an `s3://bucket/key`
+// URI. A `region` query parameter sets the bucket region.
+func URILoader(u *url.URL) (go2chef.ConfigSource, error) {
+	c := &ConfigSource{
+		Region: u.Query().Get("region"),
+		Bucket: u.Host,
+		Key:    strings.TrimPrefix(u.Path, "/"),
+	}
+	if c.Bucket == "" || c.Key == "" {
+		return nil, errors.New("s3: config URI must be of the form s3://bucket/key")
+	}
+	return c, nil
+}
+
+var _ go2chef.SignedConfigSource = &ConfigSource{}
+var _ go2chef.ConfigSourceURILoader = URILoader
+
+func init() {
+	if go2chef.AutoRegisterPlugins {
+		go2chef.RegisterConfigSource(TypeName, &ConfigSource{})
+		go2chef.RegisterConfigSourceScheme("s3", URILoader)
+	}
+}
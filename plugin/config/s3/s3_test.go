@@ -0,0 +1,27 @@
+package s3
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestURILoader(t *testing.T) {
+	u, _ := url.Parse("s3://my-bucket/path/to/config.json?region=us-west-2")
+	cs, err := URILoader(u)
+	if err != nil {
+		t.Fatalf("failed to load config source from URI: %s", err)
+	}
+	c := cs.(*ConfigSource)
+	if c.Bucket != "my-bucket" || c.Key != "path/to/config.json" || c.Region != "us-west-2" {
+		t.Errorf("unexpected config source from URI: %#v", c)
+	}
+
+	u, _ = url.Parse("s3://my-bucket")
+	if _, err := URILoader(u); err == nil {
+		t.Errorf("expected error for URI without key")
+	}
+}
@@ -0,0 +1,87 @@
+// Package stdin is a configuration source that reads JSON configuration
+// from standard input
+package stdin
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/spf13/pflag"
+)
+
+// TypeName is the name of this configuration source
+const TypeName = "go2chef.config_source.stdin"
+
+// ConfigSource loads configuration data from JSON on standard input
+type ConfigSource struct {
+	// Reader overrides os.Stdin as the configuration input
+	Reader        io.Reader
+	SignaturePath string
+}
+
+// InitFlags sets the command-line flags for stdin configuration sources
+func (c *ConfigSource) InitFlags(set *pflag.FlagSet) {
+	set.StringVar(&c.SignaturePath, "stdin-config-sig", "", "path to the detached signature for configuration read from stdin")
+}
+
+// ReadConfig loads the configuration from stdin
+func (c *ConfigSource) ReadConfig() (map[string]interface{}, error) {
+	data, err := ioutil.ReadAll(c.reader())
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[string]interface{})
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// ReadSignedConfig loads the configuration from stdin and its detached
+// signature from the path given by --stdin-config-sig
+func (c *ConfigSource) ReadSignedConfig() ([]byte, []byte, error) {
+	data, err := ioutil.ReadAll(c.reader())
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.SignaturePath == "" {
+		return data, nil, nil
+	}
+	sig, err := ioutil.ReadFile(c.SignaturePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, sig, nil
+}
+
+func (c *ConfigSource) reader() io.Reader {
+	if c.Reader != nil {
+		return c.Reader
+	}
+	return os.Stdin
+}
+
+// URILoader configures a stdin configuration source from a `stdin:` URI
+// (which `-` is an alias for). A `sig` query parameter sets the signature
+// path, i.e. `stdin:?sig=config.json.sig`.
+func URILoader(u *url.URL) (go2chef.ConfigSource, error) {
+	return &ConfigSource{SignaturePath: u.Query().Get("sig")}, nil
+}
+
+var _ go2chef.SignedConfigSource = &ConfigSource{}
+var _ go2chef.ConfigSourceURILoader = URILoader
+
+func init() {
+	if go2chef.AutoRegisterPlugins {
+		go2chef.RegisterConfigSource(TypeName, &ConfigSource{})
+		go2chef.RegisterConfigSourceScheme("stdin", URILoader)
+	}
+}
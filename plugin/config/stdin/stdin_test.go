@@ -0,0 +1,26 @@
+package stdin
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigSource(t *testing.T) {
+	cs := &ConfigSource{Reader: strings.NewReader(`{"key":"value"}`)}
+
+	if cr, err := cs.ReadConfig(); err != nil {
+		t.Fatalf("failed to read config: %s", err)
+	} else {
+		if v, ok := cr["key"]; ok {
+			if v != "value" {
+				t.Errorf("config[key] != value")
+			}
+		} else {
+			t.Errorf("config[key] does not exist")
+		}
+	}
+}
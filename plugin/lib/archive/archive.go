@@ -0,0 +1,407 @@
+// Package archive implements safe archive extraction for sources. Entries
+// which would land outside the destination (via `..`, absolute paths or
+// symlinks) are rejected, and total size and file count are limited to
+// guard against decompression bombs. Sources embed Options in their
+// configuration:
+//
+//	{
+//	  "archive": true,
+//	  "archive_format": "tar.gz",
+//	  "strip_components": 1,
+//	  "include": ["chef-*/bin/*"],
+//	  "exclude": ["*/docs"],
+//	  "max_extract_size": "2GiB",
+//	  "max_extract_files": 10000
+//	}
+package archive
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/facebookincubator/go2chef/util"
+	"github.com/mholt/archiver/v3"
+)
+
+const (
+	// DefaultMaxSize is the default limit on total extracted bytes
+	DefaultMaxSize = 16 << 30
+	// DefaultMaxFiles is the default limit on extracted entries
+	DefaultMaxFiles = 1000000
+)
+
+// Options controls archive extraction
+type Options struct {
+	// Format is the archive format as a file extension, i.e. "tar.gz" or
+	// "zip". By default it's detected from the archive filename.
+	Format string `mapstructure:"archive_format"`
+	// StripComponents removes this many leading path elements from each
+	// entry, like `tar --strip-components`
+	StripComponents int `mapstructure:"strip_components"`
+	// Include and Exclude are path.Match globs matched against entry paths
+	// (after stripping) and their parent directories. Entries must match
+	// an Include pattern, if any are given, and no Exclude pattern.
+	Include []string `mapstructure:"include"`
+	Exclude []string `mapstructure:"exclude"`
+	// MaxSize limits the total extracted bytes, as a byte count or a size
+	// string such as "2GiB"
+	MaxSize  interface{} `mapstructure:"max_extract_size"`
+	MaxFiles int         `mapstructure:"max_extract_files"`
+
+	maxSize int64
+}
+
+// Validate checks the options and applies defaults. It should be called by
+// source loaders.
+func (o *Options) Validate() error {
+	if o.Format != "" {
+		if _, err := walker("archive." + strings.TrimPrefix(o.Format, ".")); err != nil {
+			return fmt.Errorf("unsupported archive_format %q", o.Format)
+		}
+	}
+	if o.StripComponents < 0 {
+		return errors.New("strip_components must not be negative")
+	}
+	for _, p := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %s", p, err)
+		}
+	}
+
+	o.maxSize = DefaultMaxSize
+	switch v := o.MaxSize.(type) {
+	case nil:
+	case string:
+		n, err := util.ParseSize(v)
+		if err != nil {
+			return fmt.Errorf("max_extract_size: %s", err)
+		}
+		o.maxSize = n
+	case int:
+		o.maxSize = int64(v)
+	case int64:
+		o.maxSize = v
+	case float64:
+		o.maxSize = int64(v)
+	default:
+		return fmt.Errorf("max_extract_size: unsupported value %v", v)
+	}
+	if o.maxSize <= 0 {
+		return errors.New("max_extract_size must be positive")
+	}
+	if o.MaxFiles == 0 {
+		o.MaxFiles = DefaultMaxFiles
+	}
+	if o.MaxFiles < 0 {
+		return errors.New("max_extract_files must be positive")
+	}
+	return nil
+}
+
+// walker returns the archiver able to walk the named archive
+func walker(filename string) (archiver.Walker, error) {
+	a, err := archiver.ByExtension(filename)
+	if err != nil {
+		return nil, err
+	}
+	w, ok := a.(archiver.Walker)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an archive format", filename)
+	}
+	return w, nil
+}
+
+// Extract safely extracts the archive at src into the directory dest
+func (o *Options) Extract(src, dest string) error {
+	if o.maxSize == 0 {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+	}
+	name := src
+	if o.Format != "" {
+		name = "archive." + strings.TrimPrefix(o.Format, ".")
+	}
+	w, err := walker(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	x := &extraction{Options: o, root: root}
+	return w.Walk(src, x.extract)
+}
+
+// extraction is the state of a single Extract call
+type extraction struct {
+	*Options
+	root  string
+	size  int64
+	files int
+}
+
+// entry is an archive member normalized across formats
+type entry struct {
+	name     string
+	linkname string
+	mode     os.FileMode
+	hardlink bool
+}
+
+func newEntry(f archiver.File) (entry, error) {
+	e := entry{name: f.Name(), mode: f.Mode()}
+	switch h := f.Header.(type) {
+	case *tar.Header:
+		e.name = h.Name
+		e.linkname = h.Linkname
+		switch h.Typeflag {
+		case tar.TypeLink:
+			e.hardlink = true
+		case tar.TypeSymlink:
+			e.mode |= os.ModeSymlink
+		}
+	case zip.FileHeader:
+		e.name = h.Name
+	}
+	if e.mode&os.ModeSymlink != 0 && e.linkname == "" && f.ReadCloser != nil {
+		// zip and rar store symlink targets as the entry content
+		data, err := ioutil.ReadAll(io.LimitReader(f, 4096))
+		if err != nil {
+			return e, err
+		}
+		e.linkname = string(data)
+	}
+	return e, nil
+}
+
+// clean normalizes an archive path and applies StripComponents, returning
+// "" if nothing is left. Absolute paths and `..` elements are errors.
+func (x *extraction) clean(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("archive entry %q escapes the destination", name)
+		}
+	}
+	name = path.Clean(name)
+	if name == "." {
+		return "", nil
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) <= x.StripComponents {
+		return "", nil
+	}
+	return path.Join(parts[x.StripComponents:]...), nil
+}
+
+// selected applies the include and exclude globs to an entry path
+func (x *extraction) selected(name string) bool {
+	if len(x.Include) > 0 && !matchAny(x.Include, name) {
+		return false
+	}
+	return !matchAny(x.Exclude, name)
+}
+
+// matchAny reports whether any pattern matches name or one of its parent
+// directories
+func matchAny(patterns []string, name string) bool {
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pat := range patterns {
+			if ok, _ := path.Match(pat, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxLinkDepth bounds symlink resolution, as the kernel's ELOOP limit does
+const maxLinkDepth = 40
+
+var errEscape = errors.New("escapes the destination")
+
+// target returns the destination path for an entry, checking that its
+// parent directories on disk don't lead outside the root. It also returns
+// the real path of the parent directory.
+func (x *extraction) target(name string) (string, string, error) {
+	parent, err := x.resolve(x.root, path.Dir(name), 0)
+	if err != nil {
+		return "", "", fmt.Errorf("archive entry %q %s", name, err)
+	}
+	return filepath.Join(x.root, filepath.FromSlash(name)), parent, nil
+}
+
+// resolve follows rel from the real directory base as the filesystem
+// would, failing if any step leaves the root. Components which don't exist
+// yet are taken literally, and `..` after one is rejected since it may
+// later be created as a symlink.
+func (x *extraction) resolve(base, rel string, depth int) (string, error) {
+	if depth > maxLinkDepth {
+		return "", errors.New("has too many levels of symlinks")
+	}
+	cur := base
+	missing := false
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if missing {
+				return "", errEscape
+			}
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, elem)
+			if missing {
+				break
+			}
+			fi, err := os.Lstat(cur)
+			if os.IsNotExist(err) {
+				missing = true
+				break
+			} else if err != nil {
+				return "", err
+			}
+			if fi.Mode()&os.ModeSymlink != 0 {
+				link, err := os.Readlink(cur)
+				if err != nil {
+					return "", err
+				}
+				if filepath.IsAbs(link) {
+					return "", errEscape
+				}
+				if cur, err = x.resolve(filepath.Dir(cur), link, depth+1); err != nil {
+					return "", err
+				}
+			}
+		}
+		if !within(x.root, cur) {
+			return "", errEscape
+		}
+	}
+	return cur, nil
+}
+
+// within reports whether p is root or a path beneath it
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (x *extraction) extract(f archiver.File) error {
+	e, err := newEntry(f)
+	if err != nil {
+		return err
+	}
+	name, err := x.clean(e.name)
+	if err != nil || name == "" || !x.selected(name) {
+		return err
+	}
+
+	x.files++
+	if x.files > x.MaxFiles {
+		return fmt.Errorf("archive has more than %d entries", x.MaxFiles)
+	}
+	t, parent, err := x.target(name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case f.IsDir():
+		if err := os.MkdirAll(t, e.mode.Perm()|0700); err != nil {
+			return err
+		}
+		return os.Chmod(t, e.mode.Perm()|0700)
+	case e.hardlink:
+		// hard link targets are archive paths, so are stripped too
+		link, err := x.clean(e.linkname)
+		if err != nil || link == "" {
+			return fmt.Errorf("archive entry %q links outside the destination", e.name)
+		}
+		src, err := x.resolve(x.root, link, 0)
+		if err != nil {
+			return fmt.Errorf("archive entry %q link %s", e.name, err)
+		}
+		if err := x.prepare(t); err != nil {
+			return err
+		}
+		return os.Link(src, t)
+	case e.mode&os.ModeSymlink != 0:
+		if filepath.IsAbs(e.linkname) || strings.HasPrefix(e.linkname, "/") {
+			return fmt.Errorf("archive entry %q links outside the destination", e.name)
+		}
+		if _, err := x.resolve(parent, e.linkname, 0); err != nil {
+			return fmt.Errorf("archive entry %q link %s", e.name, err)
+		}
+		if err := x.prepare(t); err != nil {
+			return err
+		}
+		return os.Symlink(e.linkname, t)
+	case e.mode.IsRegular():
+		if err := x.prepare(t); err != nil {
+			return err
+		}
+		return x.writeFile(t, f, e.mode.Perm())
+	}
+	// devices, fifos etc. are never needed for bootstrapping
+	return nil
+}
+
+// prepare creates an entry's parent directories and removes anything
+// already at its path, so a symlink there can't redirect the write
+func (x *extraction) prepare(t string) error {
+	if err := os.MkdirAll(filepath.Dir(t), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(t); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (x *extraction) writeFile(t string, r io.Reader, mode os.FileMode) error {
+	out, err := os.OpenFile(t, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	remaining := x.maxSize - x.size
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	x.size += n
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if n > remaining {
+		return fmt.Errorf("archive extracts to more than %d bytes", x.maxSize)
+	}
+	// OpenFile's mode is subject to the umask
+	return os.Chmod(t, mode)
+}
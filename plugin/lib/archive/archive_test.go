@@ -0,0 +1,228 @@
+package archive
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarEntry describes an entry for writeTar
+type tarEntry struct {
+	name     string
+	content  string
+	mode     int64
+	typeflag byte
+	linkname string
+}
+
+func writeTar(t *testing.T, dir, name string, entries []tarEntry) string {
+	fn := filepath.Join(dir, name)
+	fh, err := os.Create(fn)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", fn, err)
+	}
+	defer fh.Close()
+	gz := gzip.NewWriter(fh)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: e.mode, Typeflag: e.typeflag, Linkname: e.linkname}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write tar header: %s", err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatalf("failed to write tar content: %s", err)
+		}
+	}
+	return fn
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	return dir
+}
+
+func TestOptions_Extract(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	fn := writeTar(t, dir, "chef.tar.gz", []tarEntry{
+		{name: "chef-17.0/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "chef-17.0/bin/chef-client", content: "#!/bin/sh", mode: 0755},
+		{name: "chef-17.0/README.md", content: "readme"},
+		{name: "chef-17.0/docs/index.html", content: "docs"},
+		{name: "chef-17.0/bin/chef", typeflag: tar.TypeSymlink, linkname: "chef-client"},
+		{name: "chef-17.0/bin/knife", typeflag: tar.TypeLink, linkname: "chef-17.0/bin/chef-client"},
+	})
+
+	dest := filepath.Join(dir, "out")
+	o := &Options{StripComponents: 1, Exclude: []string{"docs"}}
+	if err := o.Validate(); err != nil {
+		t.Fatalf("failed to validate options: %s", err)
+	}
+	if err := o.Extract(fn, dest); err != nil {
+		t.Fatalf("failed to extract: %s", err)
+	}
+
+	st, err := os.Stat(filepath.Join(dest, "bin", "chef-client"))
+	if err != nil {
+		t.Fatalf("chef-client wasn't extracted: %s", err)
+	}
+	if st.Mode().Perm() != 0755 {
+		t.Errorf("unexpected mode %o", st.Mode().Perm())
+	}
+	if link, err := os.Readlink(filepath.Join(dest, "bin", "chef")); err != nil || link != "chef-client" {
+		t.Errorf("unexpected symlink %q: %v", link, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dest, "bin", "knife")); err != nil || string(data) != "#!/bin/sh" {
+		t.Errorf("unexpected hard link content %q: %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "README.md")); err != nil {
+		t.Errorf("README.md wasn't extracted: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "docs")); err == nil {
+		t.Errorf("excluded docs were extracted")
+	}
+
+	// include only matches binaries
+	dest = filepath.Join(dir, "include")
+	o = &Options{Format: "tgz", Include: []string{"*/bin/*"}}
+	if err := o.Extract(fn, dest); err != nil {
+		t.Fatalf("failed to extract: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "chef-17.0", "README.md")); err == nil {
+		t.Errorf("README.md was extracted despite not being included")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "chef-17.0", "bin", "chef-client")); err != nil {
+		t.Errorf("included file wasn't extracted: %s", err)
+	}
+}
+
+func TestOptions_ExtractUnsafe(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for name, entries := range map[string][]tarEntry{
+		"traversal": {{name: "../evil", content: "x"}},
+		"absolute":  {{name: "/etc/evil", content: "x"}},
+		"symlink":   {{name: "link", typeflag: tar.TypeSymlink, linkname: "../../etc"}},
+		"abs-link":  {{name: "link", typeflag: tar.TypeSymlink, linkname: "/etc"}},
+		"hardlink":  {{name: "link", typeflag: tar.TypeLink, linkname: "../outside"}},
+		"chained-symlink": {
+			{name: "sub/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "sub/up", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "sub/out", typeflag: tar.TypeSymlink, linkname: "up/.."},
+		},
+		"dangling-symlink": {
+			{name: "a", typeflag: tar.TypeSymlink, linkname: "missing/.."},
+		},
+	} {
+		fn := writeTar(t, dir, name+".tar.gz", entries)
+		if err := (&Options{}).Extract(fn, filepath.Join(dir, name, "a", "b")); err == nil {
+			t.Errorf("%s: expected extraction to fail", name)
+		}
+	}
+
+	// symlinks already in the destination mustn't be followed out of it
+	dest := filepath.Join(dir, "existing")
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		t.Fatalf("failed to create %s: %s", dest, err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dest, "out")); err != nil {
+		t.Fatalf("failed to create symlink: %s", err)
+	}
+	fn := writeTar(t, dir, "existing.tar.gz", []tarEntry{{name: "out/evil", content: "x"}})
+	if err := (&Options{}).Extract(fn, dest); err == nil {
+		t.Errorf("expected extraction through an existing symlink to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); err == nil {
+		t.Errorf("file was written outside the destination")
+	}
+}
+
+func TestOptions_ExtractLimits(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	fn := writeTar(t, dir, "bomb.tar.gz", []tarEntry{
+		{name: "a", content: strings.Repeat("0", 1024)},
+		{name: "b", content: strings.Repeat("0", 1024)},
+	})
+
+	if err := (&Options{MaxSize: "1KiB"}).Extract(fn, filepath.Join(dir, "size")); err == nil {
+		t.Errorf("expected size limit to be enforced")
+	}
+	if err := (&Options{MaxFiles: 1}).Extract(fn, filepath.Join(dir, "files")); err == nil {
+		t.Errorf("expected file count limit to be enforced")
+	}
+	if err := (&Options{MaxSize: 2048, MaxFiles: 2}).Extract(fn, filepath.Join(dir, "ok")); err != nil {
+		t.Errorf("expected extraction within limits to succeed: %s", err)
+	}
+}
+
+func TestOptions_ExtractZip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "bundle.zip")
+	fh, err := os.Create(fn)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", fn, err)
+	}
+	zw := zip.NewWriter(fh)
+	hdr := &zip.FileHeader{Name: "bundle/chefctl.sh"}
+	hdr.SetMode(0750)
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		t.Fatalf("failed to write zip entry: %s", err)
+	}
+	_, _ = w.Write([]byte("chefctl"))
+	zw.Close()
+	fh.Close()
+
+	dest := filepath.Join(dir, "out")
+	if err := (&Options{StripComponents: 1}).Extract(fn, dest); err != nil {
+		t.Fatalf("failed to extract: %s", err)
+	}
+	st, err := os.Stat(filepath.Join(dest, "chefctl.sh"))
+	if err != nil {
+		t.Fatalf("chefctl.sh wasn't extracted: %s", err)
+	}
+	if st.Mode().Perm() != 0750 {
+		t.Errorf("unexpected mode %o", st.Mode().Perm())
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	for _, o := range []*Options{
+		{Format: "docx"},
+		{Format: "gz"},
+		{StripComponents: -1},
+		{Include: []string{"["}},
+		{MaxSize: "lots"},
+		{MaxFiles: -1},
+	} {
+		if err := o.Validate(); err == nil {
+			t.Errorf("expected options %+v to be invalid", o)
+		}
+	}
+}
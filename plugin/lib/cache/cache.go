@@ -0,0 +1,288 @@
+// Package cache implements a persistent, content-addressed download cache
+// shared across go2chef runs. Entries are keyed by their expected checksum
+// when one is known, which go2chef.GetSource handles for every source
+// implementing go2chef.FileInstaller, or by source URL (revalidated with its
+// ETag) otherwise. The cache is enabled by the `global.cache` configuration:
+//
+//	"global": {
+//	  "cache": {"path": "/var/cache/go2chef", "max_size": "10GiB"}
+//	}
+package cache
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/util"
+	"github.com/mitchellh/mapstructure"
+)
+
+// metaSuffix is appended to an entry's key for its metadata file
+const metaSuffix = ".meta"
+
+// DefaultPath is the cache location used if `global.cache.path` isn't set
+var DefaultPath = defaultPath()
+
+// Global is the cache configured by `global.cache`, or nil if caching is
+// disabled
+var Global *Cache
+
+// Cache is a directory of cached downloads
+type Cache struct {
+	Path string
+	// MaxSize is the total size in bytes beyond which least-recently-used
+	// entries are evicted. Zero means unlimited.
+	MaxSize int64
+}
+
+// Meta describes where a cache entry came from
+type Meta struct {
+	Source   string `json:"source"`
+	ETag     string `json:"etag,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// Entry is a single cached file
+type Entry struct {
+	Meta
+	Key      string
+	Path     string
+	Size     int64
+	LastUsed time.Time
+}
+
+// New returns a cache rooted at path
+func New(path string, maxSize int64) *Cache {
+	return &Cache{Path: path, MaxSize: maxSize}
+}
+
+// ChecksumKey returns the cache key for content with a known checksum
+func ChecksumKey(c *go2chef.Checksum) string {
+	return c.Algorithm + "-" + c.Digest
+}
+
+// URLKey returns the cache key for content identified by its source URL
+func URLKey(u string) string {
+	h := sha256.Sum256([]byte(u))
+	return "url-" + hex.EncodeToString(h[:])
+}
+
+// Get returns the entry for key, marking it as recently used
+func (c *Cache) Get(key string) (*Entry, bool) {
+	e, err := c.entry(key)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(e.Path, now, now)
+	e.LastUsed = now
+	return e, true
+}
+
+// CopyTo copies the cached file for key to w, returning its entry
+func (c *Cache) CopyTo(key string, w io.Writer) (*Entry, error) {
+	e, ok := c.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("cache entry %s not found", key)
+	}
+	f, err := os.Open(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Fetch implements go2chef.DownloadCache, copying the file with checksum
+// sum to w
+func (c *Cache) Fetch(sum *go2chef.Checksum, w io.Writer) (string, error) {
+	e, err := c.CopyTo(ChecksumKey(sum), w)
+	if err != nil {
+		return "", err
+	}
+	return e.Filename, nil
+}
+
+// Store implements go2chef.DownloadCache, caching the file at path under
+// its checksum
+func (c *Cache) Store(sum *go2chef.Checksum, source, filename, path string) error {
+	return c.Put(ChecksumKey(sum), path, Meta{Source: source, Filename: filename})
+}
+
+// Put copies the file at path into the cache under key, then evicts old
+// entries if the cache has grown beyond MaxSize
+func (c *Cache) Put(key, path string, meta Meta) error {
+	if err := os.MkdirAll(c.Path, 0700); err != nil {
+		return err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// write to a temp file and rename so concurrent runs never see a
+	// partial entry
+	tmp, err := ioutil.TempFile(c.Path, ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	m, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(c.Path, key+metaSuffix), m, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.Path, key)); err != nil {
+		return err
+	}
+	go2chef.GetGlobalLogger().Debugf(1, "cached %s as %s", meta.Source, key)
+
+	if c.MaxSize > 0 {
+		_, err = c.Prune(c.MaxSize)
+	}
+	return err
+}
+
+// List returns all cache entries, most recently used first
+func (c *Cache) List() ([]*Entry, error) {
+	files, err := ioutil.ReadDir(c.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []*Entry
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || strings.HasSuffix(f.Name(), metaSuffix) {
+			continue
+		}
+		if e, err := c.entry(f.Name()); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.After(entries[j].LastUsed) })
+	return entries, nil
+}
+
+// Prune evicts least-recently-used entries until the cache is no larger
+// than maxSize bytes, returning the evicted entries. A maxSize of zero
+// empties the cache.
+func (c *Cache) Prune(maxSize int64) ([]*Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	var evicted []*Entry
+	for i := len(entries) - 1; i >= 0 && total > maxSize; i-- {
+		e := entries[i]
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			return evicted, err
+		}
+		_ = os.Remove(e.Path + metaSuffix)
+		total -= e.Size
+		evicted = append(evicted, e)
+		go2chef.GetGlobalLogger().Debugf(1, "evicted %s (%d bytes) from cache", e.Key, e.Size)
+	}
+	return evicted, nil
+}
+
+func (c *Cache) entry(key string) (*Entry, error) {
+	path := filepath.Join(c.Path, key)
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{Key: key, Path: path, Size: st.Size(), LastUsed: st.ModTime()}
+	if m, err := ioutil.ReadFile(path + metaSuffix); err == nil {
+		_ = json.Unmarshal(m, &e.Meta)
+	}
+	return e, nil
+}
+
+func defaultPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		pd := os.Getenv("ProgramData")
+		if pd == "" {
+			pd = `C:\ProgramData`
+		}
+		return filepath.Join(pd, "go2chef", "cache")
+	case "darwin":
+		return "/Library/Caches/go2chef"
+	default:
+		return "/var/cache/go2chef"
+	}
+}
+
+type cacheParse struct {
+	Path    string      `mapstructure:"path"`
+	MaxSize interface{} `mapstructure:"max_size"`
+}
+
+func cacheProcessor(f string, data interface{}) error {
+	if data == nil {
+		Global = nil
+		go2chef.SetDownloadCache(nil)
+		return nil
+	}
+	parse := cacheParse{Path: DefaultPath}
+	if err := mapstructure.Decode(data, &parse); err != nil {
+		return err
+	}
+	var maxSize int64
+	switch ms := parse.MaxSize.(type) {
+	case nil:
+	case string:
+		n, err := util.ParseSize(ms)
+		if err != nil {
+			return fmt.Errorf("global.cache.max_size: %s", err)
+		}
+		maxSize = n
+	default:
+		if err := mapstructure.WeakDecode(ms, &maxSize); err != nil {
+			return fmt.Errorf("global.cache.max_size: %s", err)
+		}
+	}
+	Global = New(parse.Path, maxSize)
+	go2chef.SetDownloadCache(Global)
+	return nil
+}
+
+var _ go2chef.DownloadCache = &Cache{}
+
+func init() {
+	go2chef.GlobalConfiguration.MustRegister("cache", cacheProcessor)
+}
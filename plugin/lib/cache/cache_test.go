@@ -0,0 +1,96 @@
+package cache
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/go2chef"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := New(filepath.Join(dir, "cache"), 10)
+	for i, content := range []string{"aaaa", "bbbb", "cccc"} {
+		fn := filepath.Join(dir, content)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %s", err)
+		}
+		if err := c.Put(content, fn, Meta{Source: "test://" + content}); err != nil {
+			t.Fatalf("failed to put %s: %s", content, err)
+		}
+		// make LRU order deterministic despite coarse mtimes
+		past := time.Now().Add(time.Duration(i-10) * time.Minute)
+		_ = os.Chtimes(filepath.Join(c.Path, content), past, past)
+		if i == 1 {
+			// use aaaa so bbbb is least recently used when cccc arrives
+			if _, ok := c.Get("aaaa"); !ok {
+				t.Fatalf("aaaa should be cached")
+			}
+		}
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		t.Fatalf("failed to list cache: %s", err)
+	}
+	if len(entries) != 2 || entries[0].Key != "aaaa" || entries[1].Key != "cccc" {
+		t.Fatalf("expected bbbb to be evicted, got %v", entries)
+	}
+	if entries[0].Source != "test://aaaa" {
+		t.Errorf("metadata not preserved: %+v", entries[0])
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := c.CopyTo("cccc", buf); err != nil || buf.String() != "cccc" {
+		t.Errorf("unexpected cached content %q: %v", buf.String(), err)
+	}
+
+	if evicted, err := c.Prune(0); err != nil || len(evicted) != 2 {
+		t.Errorf("expected prune to empty the cache, evicted %v: %v", evicted, err)
+	}
+	if entries, _ := c.List(); len(entries) != 0 {
+		t.Errorf("cache should be empty, got %v", entries)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	sum := &go2chef.Checksum{Algorithm: "sha256", Digest: "abcd"}
+	if k := ChecksumKey(sum); k != "sha256-abcd" {
+		t.Errorf("unexpected checksum key %s", k)
+	}
+	if URLKey("https://a/b") == URLKey("https://a/c") {
+		t.Errorf("URL keys should differ")
+	}
+}
+
+func TestCacheProcessor(t *testing.T) {
+	defer func() { Global = nil }()
+	if err := cacheProcessor("cache", map[string]interface{}{"max_size": "2GiB"}); err != nil {
+		t.Fatalf("failed to process cache config: %s", err)
+	}
+	if Global == nil || Global.Path != DefaultPath || Global.MaxSize != 2<<30 {
+		t.Errorf("unexpected cache configuration %+v", Global)
+	}
+	if err := cacheProcessor("cache", map[string]interface{}{"path": "/tmp/c", "max_size": 1024}); err != nil || Global.MaxSize != 1024 {
+		t.Errorf("unexpected cache configuration %+v: %v", Global, err)
+	}
+	if err := cacheProcessor("cache", nil); err != nil || Global != nil {
+		t.Errorf("absent cache config should disable caching")
+	}
+	if err := cacheProcessor("cache", map[string]interface{}{"max_size": "5MB"}); err != nil || Global.MaxSize != 5<<20 {
+		t.Errorf("unexpected cache configuration %+v: %v", Global, err)
+	}
+}
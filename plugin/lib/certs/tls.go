@@ -141,4 +141,7 @@ func toFullCerts(in []*x509.Certificate) []x509.Certificate {
 
 func init() {
 	go2chef.GlobalConfiguration.MustRegister("tls", tlsProcessor)
+	go2chef.TLSClientConfig = func() (*tls.Config, error) {
+		return TLS.GetTLSClientConf()
+	}
 }
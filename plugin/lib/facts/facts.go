@@ -0,0 +1,159 @@
+// Package facts gathers basic facts about the host go2chef is running on,
+// for use by plugins which template content or pick artifacts per platform.
+package facts
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Facts describes the host
+type Facts struct {
+	Hostname string
+	// FQDN is the hostname qualified with the DNS domain, if known
+	FQDN string
+	// OS and Arch are the Go GOOS and GOARCH values
+	OS   string
+	Arch string
+	// Machine is the architecture as reported by `uname -m`, i.e. x86_64
+	// or aarch64
+	Machine string
+	// Platform is the os-release ID on Linux (i.e. ubuntu, centos), and
+	// "mac_os_x" or "windows" otherwise
+	Platform        string
+	PlatformVersion string
+	// PlatformLike lists the os-release ID_LIKE platforms
+	PlatformLike []string
+}
+
+// osReleasePaths are the os-release locations, in order of preference
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+var cached struct {
+	sync.Once
+	facts *Facts
+}
+
+// Get returns the host facts, gathering them on the first call
+func Get() *Facts {
+	cached.Do(func() {
+		cached.facts = gather()
+	})
+	return cached.facts
+}
+
+func gather() *Facts {
+	f := &Facts{
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Machine: Machine(runtime.GOARCH),
+	}
+	f.Hostname, _ = os.Hostname()
+	f.FQDN = f.Hostname
+	if runtime.GOOS != "windows" {
+		if out, err := exec.Command("hostname", "-f").Output(); err == nil {
+			if fqdn := strings.TrimSpace(string(out)); fqdn != "" {
+				f.FQDN = fqdn
+			}
+		}
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		for _, p := range osReleasePaths {
+			fh, err := os.Open(p)
+			if err != nil {
+				continue
+			}
+			rel := ParseOSRelease(fh)
+			fh.Close()
+			f.Platform = rel["ID"]
+			f.PlatformVersion = rel["VERSION_ID"]
+			f.PlatformLike = strings.Fields(rel["ID_LIKE"])
+			break
+		}
+	case "darwin":
+		f.Platform = "mac_os_x"
+		if out, err := exec.Command("sw_vers", "-productVersion").Output(); err == nil {
+			f.PlatformVersion = strings.TrimSpace(string(out))
+		}
+	case "windows":
+		f.Platform = "windows"
+		// `ver` prints i.e. "Microsoft Windows [Version 10.0.19045.3570]"
+		if out, err := exec.Command("cmd", "/c", "ver").Output(); err == nil {
+			s := string(out)
+			if i := strings.Index(s, "Version "); i >= 0 {
+				f.PlatformVersion = strings.TrimRight(strings.TrimSpace(s[i+len("Version "):]), "]")
+			}
+		}
+	default:
+		f.Platform = runtime.GOOS
+	}
+	return f
+}
+
+// ParseOSRelease parses os-release(5) formatted data into a map
+func ParseOSRelease(r io.Reader) map[string]string {
+	out := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		val := parts[1]
+		if uq, err := strconv.Unquote(val); err == nil {
+			val = uq
+		} else {
+			val = strings.Trim(val, `'"`)
+		}
+		out[parts[0]] = val
+	}
+	return out
+}
+
+// Machine converts a GOARCH value to the `uname -m` architecture name
+func Machine(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i386"
+	case "arm64":
+		return "aarch64"
+	case "arm":
+		return "armv7l"
+	default:
+		return goarch
+	}
+}
+
+// IsLike reports whether the platform is, or is derived from, any of the
+// given platforms (i.e. IsLike("rhel") for a CentOS host)
+func (f *Facts) IsLike(platforms ...string) bool {
+	for _, p := range platforms {
+		if f.Platform == p {
+			return true
+		}
+		for _, l := range f.PlatformLike {
+			if l == p {
+				return true
+			}
+		}
+	}
+	return false
+}
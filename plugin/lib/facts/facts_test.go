@@ -0,0 +1,52 @@
+package facts
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseOSRelease(t *testing.T) {
+	rel := ParseOSRelease(strings.NewReader(`# comment
+NAME="Rocky Linux"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID='8.9'
+PLATFORM_ID=platform:el8
+`))
+	for k, v := range map[string]string{
+		"NAME":        "Rocky Linux",
+		"ID":          "rocky",
+		"ID_LIKE":     "rhel centos fedora",
+		"VERSION_ID":  "8.9",
+		"PLATFORM_ID": "platform:el8",
+	} {
+		if rel[k] != v {
+			t.Errorf("%s: got %q, want %q", k, rel[k], v)
+		}
+	}
+}
+
+func TestFacts_IsLike(t *testing.T) {
+	f := &Facts{Platform: "rocky", PlatformLike: []string{"rhel", "centos", "fedora"}}
+	if !f.IsLike("debian", "rhel") {
+		t.Errorf("expected rocky to be like rhel")
+	}
+	if f.IsLike("debian") {
+		t.Errorf("didn't expect rocky to be like debian")
+	}
+}
+
+func TestGet(t *testing.T) {
+	f := Get()
+	if f.OS != runtime.GOOS || f.Arch != runtime.GOARCH || f.Machine == "" {
+		t.Errorf("unexpected facts %+v", f)
+	}
+	if Get() != f {
+		t.Errorf("expected facts to be cached")
+	}
+}
@@ -0,0 +1,108 @@
+// Package outfile writes files which sources generate themselves, such as
+// secrets or inline content, into a download path.
+package outfile
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Path returns the path of name within dir, failing if name would escape
+// it or refers to dir itself
+func Path(dir, name string) (string, error) {
+	outpath := filepath.Join(dir, name)
+	if rel, err := filepath.Rel(dir, outpath); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("filename %q is outside the download path", name)
+	}
+	return outpath, nil
+}
+
+// ParseMode parses an octal file mode such as "0440", returning def if s is
+// empty
+func ParseMode(s string, def os.FileMode) (os.FileMode, error) {
+	if s == "" {
+		return def, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	return os.FileMode(m), nil
+}
+
+// ValidateOwner checks that an owner can be applied on this platform
+func ValidateOwner(owner string) error {
+	if owner != "" && runtime.GOOS == "windows" {
+		return errors.New("owner is not supported on windows")
+	}
+	return nil
+}
+
+// Write writes content to outpath with exactly mode, creating parent
+// directories as needed, and chowns it to owner (`user[:group]`, names or
+// IDs) if set
+func Write(outpath string, content []byte, mode os.FileMode, owner string) error {
+	if err := os.MkdirAll(filepath.Dir(outpath), 0755); err != nil {
+		return err
+	}
+	// remove any existing file so it's recreated with the right mode even
+	// if the old one was read-only
+	if err := os.Remove(outpath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := ioutil.WriteFile(outpath, content, mode); err != nil {
+		return err
+	}
+	// WriteFile is subject to the umask
+	if err := os.Chmod(outpath, mode); err != nil {
+		return err
+	}
+	if owner == "" {
+		return nil
+	}
+	uid, gid, err := lookupOwner(owner)
+	if err != nil {
+		return fmt.Errorf("owner %q: %s", owner, err)
+	}
+	return os.Chown(outpath, uid, gid)
+}
+
+// lookupOwner resolves `user[:group]` to numeric IDs; -1 leaves the group
+// unchanged
+func lookupOwner(owner string) (int, int, error) {
+	parts := strings.SplitN(owner, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		u, err := user.Lookup(parts[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, err
+		}
+	}
+	gid := -1
+	if len(parts) == 2 && parts[1] != "" {
+		if gid, err = strconv.Atoi(parts[1]); err != nil {
+			g, err := user.LookupGroup(parts[1])
+			if err != nil {
+				return 0, 0, err
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	return uid, gid, nil
+}
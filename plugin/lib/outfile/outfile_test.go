@@ -0,0 +1,80 @@
+package outfile
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"client.rb":         true,
+		"keys/ca.pem":       true,
+		"keys/../client.rb": true,
+		"..client.rb":       true,
+		"":                  false,
+		".":                 false,
+		"..":                false,
+		"../client.rb":      false,
+		"keys/../../x":      false,
+	} {
+		p, err := Path("/tmp/dl", name)
+		if ok && (err != nil || filepath.Dir(p) == "/tmp") {
+			t.Errorf("Path(%q) = %q, %v", name, p, err)
+		} else if !ok && err == nil {
+			t.Errorf("expected %q to be outside the download path, got %s", name, p)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if m, err := ParseMode("", 0400); err != nil || m != 0400 {
+		t.Errorf("expected the default mode, got %o, %v", m, err)
+	}
+	if m, err := ParseMode("0640", 0400); err != nil || m != 0640 {
+		t.Errorf("expected 0640, got %o, %v", m, err)
+	}
+	for _, s := range []string{"0999", "rw", "10000"} {
+		if _, err := ParseMode(s, 0400); err == nil {
+			t.Errorf("expected mode %q to be invalid", s)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// existing read-only files are replaced with the new mode
+	fn := filepath.Join(dir, "keys", "secret")
+	if err := Write(fn, []byte("old"), 0400, ""); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	owner := ""
+	if runtime.GOOS != "windows" {
+		owner = strconv.Itoa(os.Getuid())
+	}
+	if err := Write(fn, []byte("new"), 0640, owner); err != nil {
+		t.Fatalf("failed to rewrite file: %s", err)
+	}
+	if data, err := ioutil.ReadFile(fn); err != nil || string(data) != "new" {
+		t.Errorf("unexpected content %q, %v", data, err)
+	}
+	if st, err := os.Stat(fn); err != nil || st.Mode().Perm() != 0640 {
+		t.Errorf("unexpected mode %v, %v", st, err)
+	}
+
+	if err := Write(fn, nil, 0400, "no-such-user-go2chef"); err == nil {
+		t.Errorf("expected unknown owner to fail")
+	}
+}
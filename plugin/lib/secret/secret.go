@@ -0,0 +1,130 @@
+// Package secret resolves credential values for plugins. Values may be given
+// inline or read from a file, an environment variable or another source.
+package secret
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/util/temp"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Spec is the configuration for a secret value. In config it may also be
+// given as a plain string, which is equivalent to `{"value": "..."}`.
+//
+//	{"value": "literal"}
+//	{"file": "/etc/go2chef/token"}
+//	{"env": "ARTIFACT_TOKEN"}
+//	{"source": {"type": "go2chef.source.secretsmanager", ...}, "filename": "token"}
+type Spec struct {
+	Value    string                 `mapstructure:"value"`
+	File     string                 `mapstructure:"file"`
+	Env      string                 `mapstructure:"env"`
+	Source   map[string]interface{} `mapstructure:"source"`
+	Filename string                 `mapstructure:"filename"`
+}
+
+// FieldValue returns the content to write for a field of a JSON secret.
+// String fields are written as-is, and registered for redaction; other
+// values are written as JSON.
+func FieldValue(raw json.RawMessage) []byte {
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return raw
+	}
+	go2chef.RegisterRedaction(str)
+	return []byte(str)
+}
+
+// Resolve resolves a secret value from its configuration. Trailing newlines
+// are trimmed from values read from files, the environment or sources. The
+// resolved value is registered for log redaction.
+func Resolve(config interface{}) (string, error) {
+	if s, ok := config.(string); ok {
+		go2chef.RegisterRedaction(s)
+		return s, nil
+	}
+	spec := Spec{}
+	if err := mapstructure.Decode(config, &spec); err != nil {
+		return "", err
+	}
+
+	var (
+		val string
+		err error
+	)
+	switch {
+	case spec.Value != "":
+		val = spec.Value
+	case spec.File != "":
+		val, err = readFile(spec.File)
+	case spec.Env != "":
+		v, ok := os.LookupEnv(spec.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", spec.Env)
+		}
+		val = strings.TrimRight(v, "\r\n")
+	case spec.Source != nil:
+		val, err = fromSource(spec.Source, spec.Filename)
+	default:
+		return "", errors.New("secret must set one of value, file, env or source")
+	}
+	if err != nil {
+		return "", err
+	}
+	go2chef.RegisterRedaction(val)
+	return val, nil
+}
+
+func readFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// fromSource downloads a source to a temp directory and reads the secret
+// from filename, which may be omitted if the source yields a single file.
+func fromSource(config map[string]interface{}, filename string) (string, error) {
+	stype, err := go2chef.GetType(config)
+	if err != nil {
+		return "", err
+	}
+	src, err := go2chef.GetSource(stype, config)
+	if err != nil {
+		return "", err
+	}
+	dir, err := temp.Dir("", "go2chef-secret-")
+	if err != nil {
+		return "", err
+	}
+	// secrets shouldn't outlive their use, regardless of --preserve-temp
+	defer os.RemoveAll(dir)
+	if err := src.DownloadToPath(dir); err != nil {
+		return "", err
+	}
+
+	if filename == "" {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return "", err
+		}
+		if len(entries) != 1 || entries[0].IsDir() {
+			return "", fmt.Errorf("secret source produced %d entries, set `filename` to choose one", len(entries))
+		}
+		filename = entries[0].Name()
+	}
+	return readFile(filepath.Join(dir, filename))
+}
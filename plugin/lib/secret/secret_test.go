@@ -0,0 +1,61 @@
+package secret
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/go2chef"
+	_ "github.com/facebookincubator/go2chef/plugin/source/local"
+)
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "token"), []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %s", err)
+	}
+	os.Setenv("GO2CHEF_TEST_SECRET", "env-secret")
+	defer os.Unsetenv("GO2CHEF_TEST_SECRET")
+
+	for _, tc := range []struct {
+		config interface{}
+		exp    string
+	}{
+		{"inline-secret", "inline-secret"},
+		{map[string]interface{}{"value": "value-secret"}, "value-secret"},
+		{map[string]interface{}{"file": filepath.Join(dir, "token")}, "file-secret"},
+		{map[string]interface{}{"env": "GO2CHEF_TEST_SECRET"}, "env-secret"},
+		{map[string]interface{}{
+			"source": map[string]interface{}{"type": "go2chef.source.local", "path": dir},
+		}, "file-secret"},
+	} {
+		val, err := Resolve(tc.config)
+		if err != nil {
+			t.Errorf("failed to resolve %#v: %s", tc.config, err)
+			continue
+		}
+		if val != tc.exp {
+			t.Errorf("resolved %#v to %q, expected %q", tc.config, val, tc.exp)
+		}
+		if strings.Contains(go2chef.Redact("value: "+val), val) {
+			t.Errorf("resolved value %q was not registered for redaction", val)
+		}
+	}
+
+	if _, err := Resolve(map[string]interface{}{"env": "GO2CHEF_TEST_UNSET"}); err == nil {
+		t.Errorf("expected error resolving unset environment variable")
+	}
+	if _, err := Resolve(map[string]interface{}{}); err == nil {
+		t.Errorf("expected error resolving empty spec")
+	}
+}
@@ -0,0 +1,155 @@
+// Package signature verifies detached signatures on downloaded artifacts.
+// Sources opt in with a `signature` block in their configuration:
+//
+//	"signature": {
+//	  "format": "openpgp",
+//	  "keyring": "/etc/go2chef/release-keys.asc",
+//	  "location": "https://example.com/chef.rpm.asc"
+//	}
+package signature
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/facebookincubator/go2chef"
+	sigutil "github.com/facebookincubator/go2chef/util/signature"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Supported signature formats
+const (
+	FormatOpenPGP  = "openpgp"
+	FormatMinisign = "minisign"
+	FormatEd25519  = "ed25519"
+)
+
+// EventSignatureInvalid is emitted when an artifact fails verification
+const EventSignatureInvalid = "SOURCE_SIGNATURE_INVALID"
+
+// Config is the `signature` block accepted by sources
+type Config struct {
+	// Format is one of openpgp, minisign or ed25519
+	Format string `mapstructure:"format"`
+	// Location is the URL, S3 key or path of the detached signature. By
+	// default it's the artifact's location plus `.sig` (`.asc` for
+	// OpenPGP).
+	Location string `mapstructure:"location"`
+	// Keys are trusted public keys: armored OpenPGP keys, minisign public
+	// keys or base64 ed25519 public keys
+	Keys []string `mapstructure:"keys"`
+	// KeyFiles are paths to files containing trusted public keys
+	KeyFiles []string `mapstructure:"key_files"`
+	// Keyring is the path to an OpenPGP keyring, armored or binary
+	Keyring string `mapstructure:"keyring"`
+}
+
+// Verifier verifies artifacts against detached signatures
+type Verifier struct {
+	Config
+	keyring sigutil.Verifier
+}
+
+// Load builds a Verifier from a source's `signature` block, returning nil
+// if config is nil
+func Load(config map[string]interface{}) (*Verifier, error) {
+	if config == nil {
+		return nil, nil
+	}
+	v := &Verifier{}
+	if err := mapstructure.Decode(config, &v.Config); err != nil {
+		return nil, err
+	}
+
+	keys := append([]string{}, v.Keys...)
+	for _, fn := range v.KeyFiles {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, string(data))
+	}
+
+	switch v.Format {
+	case FormatOpenPGP:
+		var kr sigutil.OpenPGPKeyRing
+		for _, k := range keys {
+			el, err := sigutil.ReadOpenPGPKeyRing(strings.NewReader(k))
+			if err != nil {
+				return nil, fmt.Errorf("signature: invalid OpenPGP key: %s", err)
+			}
+			kr = append(kr, el...)
+		}
+		if v.Keyring != "" {
+			f, err := os.Open(v.Keyring)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			el, err := sigutil.ReadOpenPGPKeyRing(f)
+			if err != nil {
+				return nil, fmt.Errorf("signature: invalid OpenPGP keyring %s: %s", v.Keyring, err)
+			}
+			kr = append(kr, el...)
+		}
+		if len(kr) == 0 {
+			return nil, errors.New("signature: no trusted keys configured")
+		}
+		v.keyring = kr
+	case FormatMinisign, FormatEd25519:
+		if v.Keyring != "" {
+			return nil, fmt.Errorf("signature: keyring is only supported for the %s format", FormatOpenPGP)
+		}
+		kr, err := sigutil.ParsePublicKeys(keys)
+		if err != nil {
+			return nil, fmt.Errorf("signature: %s", err)
+		}
+		if len(kr) == 0 {
+			return nil, errors.New("signature: no trusted keys configured")
+		}
+		v.keyring = kr
+	default:
+		return nil, fmt.Errorf("signature: unsupported format %q", v.Format)
+	}
+	return v, nil
+}
+
+// SignatureLocation returns where to find the signature for an artifact
+func (v *Verifier) SignatureLocation(artifact string) string {
+	if v.Location != "" {
+		return v.Location
+	}
+	if v.Format == FormatOpenPGP {
+		return artifact + ".asc"
+	}
+	return artifact + ".sig"
+}
+
+// Verify checks the file at path against sig. Failures are reported to the
+// global logger as a SOURCE_SIGNATURE_INVALID event from the given source.
+func (v *Verifier) Verify(src go2chef.Source, path string, sig []byte) error {
+	err := v.verify(path, sig)
+	if err != nil {
+		err = fmt.Errorf("signature verification failed for %s: %s", path, err)
+		go2chef.GetGlobalLogger().WriteEvent(go2chef.NewEvent(EventSignatureInvalid, src.Type(), src.Name()+": "+err.Error()))
+		return err
+	}
+	go2chef.GetGlobalLogger().Debugf(1, "%s: %s signature verified for %s", src.Name(), v.Format, path)
+	return nil
+}
+
+func (v *Verifier) verify(path string, sig []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return v.keyring.VerifyReader(f, sig)
+}
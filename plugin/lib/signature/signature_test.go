@@ -0,0 +1,170 @@
+package signature_test
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/signature"
+	"github.com/facebookincubator/go2chef/plugin/source/local"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func writeArtifact(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	fn := filepath.Join(dir, "chef.rpm")
+	if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write artifact: %s", err)
+	}
+	return fn, func() { os.RemoveAll(dir) }
+}
+
+func TestVerifier_OpenPGP(t *testing.T) {
+	entity, err := openpgp.NewEntity("release", "", "release@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to generate OpenPGP key: %s", err)
+	}
+	pubkey := &bytes.Buffer{}
+	w, err := armor.Encode(pubkey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("failed to armor public key: %s", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("failed to serialize public key: %s", err)
+	}
+	w.Close()
+
+	fn, cleanup := writeArtifact(t, "artifact")
+	defer cleanup()
+	sig := &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(sig, entity, bytes.NewReader([]byte("artifact")), nil); err != nil {
+		t.Fatalf("failed to sign artifact: %s", err)
+	}
+	binsig := &bytes.Buffer{}
+	if err := openpgp.DetachSign(binsig, entity, bytes.NewReader([]byte("artifact")), nil); err != nil {
+		t.Fatalf("failed to sign artifact: %s", err)
+	}
+
+	v, err := signature.Load(map[string]interface{}{"format": "openpgp", "keys": []string{pubkey.String()}})
+	if err != nil {
+		t.Fatalf("failed to load verifier: %s", err)
+	}
+	if loc := v.SignatureLocation(fn); loc != fn+".asc" {
+		t.Errorf("unexpected default signature location %s", loc)
+	}
+	src, _ := local.Loader(map[string]interface{}{})
+	if err := v.Verify(src, fn, sig.Bytes()); err != nil {
+		t.Errorf("armored signature failed to verify: %s", err)
+	}
+	if err := v.Verify(src, fn, binsig.Bytes()); err != nil {
+		t.Errorf("binary signature failed to verify: %s", err)
+	}
+	if err := ioutil.WriteFile(fn, []byte("tampered"), 0644); err != nil {
+		t.Fatalf("failed to write artifact: %s", err)
+	}
+	if err := v.Verify(src, fn, sig.Bytes()); err == nil {
+		t.Errorf("tampered artifact should fail verification")
+	}
+}
+
+func TestVerifier_LocalSource(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	fn, cleanup := writeArtifact(t, "artifact")
+	defer cleanup()
+	if err := ioutil.WriteFile(fn+".sig", ed25519.Sign(priv, []byte("artifact")), 0644); err != nil {
+		t.Fatalf("failed to write signature: %s", err)
+	}
+	if err := ioutil.WriteFile(fn+".bad.sig", ed25519.Sign(priv, []byte("other")), 0644); err != nil {
+		t.Fatalf("failed to write signature: %s", err)
+	}
+
+	var events []*go2chef.Event
+	go2chef.InitGlobalLogger([]go2chef.Logger{&eventRecorder{events: &events}})
+	// drop events replayed from before the logger was initialized
+	events = nil
+
+	for loc, ok := range map[string]bool{"": true, fn + ".bad.sig": false} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		src, err := local.Loader(map[string]interface{}{
+			"path": fn,
+			"signature": map[string]interface{}{
+				"format":   "ed25519",
+				"keys":     []string{base64.StdEncoding.EncodeToString(pub)},
+				"location": loc,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to load source: %s", err)
+		}
+		err = src.DownloadToPath(filepath.Join(dir, "out"))
+		if ok && err != nil {
+			t.Errorf("download with valid signature failed: %s", err)
+		} else if !ok && err == nil {
+			t.Errorf("download with invalid signature succeeded")
+		}
+	}
+	invalid := 0
+	for _, e := range events {
+		if e.Event == signature.EventSignatureInvalid {
+			invalid++
+		}
+	}
+	if invalid != 1 {
+		t.Errorf("expected a single %s event, got %d", signature.EventSignatureInvalid, invalid)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if v, err := signature.Load(nil); v != nil || err != nil {
+		t.Errorf("nil config should produce no verifier, got %v, %v", v, err)
+	}
+	for _, config := range []map[string]interface{}{
+		{"format": "x509", "keys": []string{"a"}},
+		{"format": "minisign"},
+		{"format": "openpgp", "keys": []string{"not a key"}},
+		{"format": "ed25519", "keyring": "/etc/keyring.gpg"},
+	} {
+		if _, err := signature.Load(config); err == nil {
+			t.Errorf("expected config %v to fail to load", config)
+		}
+	}
+}
+
+// eventRecorder is a go2chef.Logger which records events
+type eventRecorder struct {
+	events *[]*go2chef.Event
+}
+
+func (e *eventRecorder) String() string                                  { return "eventRecorder" }
+func (e *eventRecorder) Name() string                                    { return "eventRecorder" }
+func (e *eventRecorder) Type() string                                    { return "eventRecorder" }
+func (e *eventRecorder) SetName(string)                                  {}
+func (e *eventRecorder) SetLevel(int)                                    {}
+func (e *eventRecorder) SetDebug(int)                                    {}
+func (e *eventRecorder) Debugf(dbg int, fmt string, args ...interface{}) {}
+func (e *eventRecorder) Infof(fmt string, args ...interface{})           {}
+func (e *eventRecorder) Errorf(fmt string, args ...interface{})          {}
+func (e *eventRecorder) WriteEvent(ev *go2chef.Event)                    { *e.events = append(*e.events, ev) }
+func (e *eventRecorder) Shutdown()                                       {}
@@ -0,0 +1,312 @@
+// Package transfer implements progress reporting and bandwidth limiting for
+// source downloads. `global.download` sets a rate limit shared by every
+// download, and how often progress events are written:
+//
+//	{
+//	  "global": {
+//	    "download": {
+//	      "rate_limit": "20MiB",
+//	      "progress_interval_seconds": 10
+//	    }
+//	  }
+//	}
+//
+// Sources embed Limit in their configuration to accept a per-source
+// `rate_limit` as well.
+package transfer
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/util"
+	"github.com/mitchellh/mapstructure"
+)
+
+// EventProgress is the event written periodically during downloads
+const EventProgress = "DOWNLOAD_PROGRESS"
+
+// DefaultProgressInterval is how often progress is reported by default
+const DefaultProgressInterval = 10 * time.Second
+
+var (
+	// ProgressInterval is how often progress events are written; 0
+	// disables them
+	ProgressInterval = DefaultProgressInterval
+	// Global limits the combined rate of all downloads, or is nil if
+	// they're unlimited
+	Global *Limiter
+)
+
+// ParseRate parses a rate limit in bytes per second: a byte count, or a
+// size string such as "10MiB" or "10MiB/s". nil and 0 mean unlimited.
+func ParseRate(v interface{}) (int64, error) {
+	switch r := v.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		n, err := util.ParseSize(strings.TrimSuffix(strings.TrimSpace(r), "/s"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid rate limit %q", r)
+		}
+		return n, nil
+	case int:
+		if r >= 0 {
+			return int64(r), nil
+		}
+	case int64:
+		if r >= 0 {
+			return r, nil
+		}
+	case float64:
+		if r >= 0 {
+			return int64(r), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid rate limit %v", v)
+}
+
+// Limiter is a token bucket limiting throughput to a number of bytes per
+// second, with bursts of up to one second's worth. It's safe for
+// concurrent use, and a nil Limiter doesn't limit anything.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter for rate bytes per second, or nil if rate
+// isn't positive
+func NewLimiter(rate int64) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &Limiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// Wait blocks until n more bytes may be transferred. Transfers beyond the
+// available tokens go into debt, which later callers wait out too, so
+// concurrent downloads share the rate.
+func (l *Limiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// Limit is embedded in source configurations to accept a per-source
+// `rate_limit`, which applies in addition to the global one
+type Limit struct {
+	RateLimit interface{} `mapstructure:"rate_limit"`
+
+	limiter *Limiter
+}
+
+// Validate parses the rate limit. It should be called by source loaders.
+func (l *Limit) Validate() error {
+	rate, err := ParseRate(l.RateLimit)
+	if err != nil {
+		return err
+	}
+	l.limiter = NewLimiter(rate)
+	return nil
+}
+
+// NewProgress starts tracking a download of total bytes (-1 if unknown).
+// component and name identify the download in progress events.
+func (l *Limit) NewProgress(component, name string, total int64) *Progress {
+	now := time.Now()
+	return &Progress{
+		logger:    go2chef.GetGlobalLogger(),
+		component: component,
+		name:      name,
+		limiters:  []*Limiter{l.limiter, Global},
+		interval:  ProgressInterval,
+		total:     total,
+		start:     now,
+		last:      now,
+	}
+}
+
+// Progress counts the bytes of a download as they pass through its
+// Reader, Writer or WriterAt, throttling them and writing progress events.
+// It's safe for concurrent use.
+type Progress struct {
+	logger    go2chef.Logger
+	component string
+	name      string
+	limiters  []*Limiter
+	interval  time.Duration
+
+	mu sync.Mutex
+	// done is the bytes downloaded so far, of which base were already
+	// present when the transfer (re)started
+	done, base, total int64
+	start, last       time.Time
+}
+
+// SetTotal sets the expected size, if it wasn't known up front
+func (p *Progress) SetTotal(total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+}
+
+// Restart resets the count to offset, i.e. when a download is retried
+// from the start or resumed part way through
+func (p *Progress) Restart(offset int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done, p.base = offset, offset
+	p.start = time.Now()
+}
+
+// Add records n more bytes, waiting for the rate limits and writing a
+// progress event if one is due
+func (p *Progress) Add(n int) {
+	for _, l := range p.limiters {
+		l.Wait(n)
+	}
+	p.mu.Lock()
+	p.done += int64(n)
+	now := time.Now()
+	due := p.interval > 0 && now.Sub(p.last) >= p.interval
+	var msg string
+	if due {
+		p.last = now
+		msg = p.message(now)
+	}
+	p.mu.Unlock()
+	if due {
+		p.logger.WriteEvent(go2chef.NewEvent(EventProgress, p.component, msg))
+	}
+}
+
+// message describes the progress, i.e.
+// "chef.rpm: 40.0MiB of 100.0MiB (40%), 4.0MiB/s, ETA 15s"
+func (p *Progress) message(now time.Time) string {
+	var rate float64
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(p.done-p.base) / elapsed
+	}
+	if p.total <= 0 {
+		return fmt.Sprintf("%s: %s, %s/s", p.name, formatBytes(float64(p.done)), formatBytes(rate))
+	}
+	msg := fmt.Sprintf("%s: %s of %s (%d%%), %s/s", p.name, formatBytes(float64(p.done)), formatBytes(float64(p.total)),
+		p.done*100/p.total, formatBytes(rate))
+	if rate > 0 && p.done < p.total {
+		eta := time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+		msg += ", ETA " + eta.Round(time.Second).String()
+	}
+	return msg
+}
+
+// formatBytes formats a byte count with binary units
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f%s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
+
+// Reader wraps r to count the bytes read from it
+func (p *Progress) Reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+// Writer wraps w to count the bytes written to it
+func (p *Progress) Writer(w io.Writer) io.Writer {
+	return &progressWriter{w: w, p: p}
+}
+
+// WriterAt wraps w to count the bytes written to it
+func (p *Progress) WriterAt(w io.WriterAt) io.WriterAt {
+	return &progressWriterAt{w: w, p: p}
+}
+
+type progressReader struct {
+	r io.Reader
+	p *Progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.Add(n)
+	return n, err
+}
+
+type progressWriter struct {
+	w io.Writer
+	p *Progress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.p.Add(len(b))
+	return w.w.Write(b)
+}
+
+type progressWriterAt struct {
+	w io.WriterAt
+	p *Progress
+}
+
+func (w *progressWriterAt) WriteAt(b []byte, off int64) (int, error) {
+	w.p.Add(len(b))
+	return w.w.WriteAt(b, off)
+}
+
+// Config is the `global.download` configuration
+type Config struct {
+	RateLimit               interface{} `mapstructure:"rate_limit"`
+	ProgressIntervalSeconds int         `mapstructure:"progress_interval_seconds"`
+}
+
+func downloadProcessor(f string, data interface{}) error {
+	c := Config{ProgressIntervalSeconds: int(DefaultProgressInterval / time.Second)}
+	if err := mapstructure.Decode(data, &c); err != nil {
+		return err
+	}
+	rate, err := ParseRate(c.RateLimit)
+	if err != nil {
+		return fmt.Errorf("global.download.rate_limit: %s", err)
+	}
+	if c.ProgressIntervalSeconds < 0 {
+		return errors.New("global.download.progress_interval_seconds must not be negative")
+	}
+	Global = NewLimiter(rate)
+	ProgressInterval = time.Duration(c.ProgressIntervalSeconds) * time.Second
+	return nil
+}
+
+func init() {
+	go2chef.GlobalConfiguration.MustRegister("download", downloadProcessor)
+}
@@ -0,0 +1,124 @@
+package transfer
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/go2chef"
+)
+
+// eventLogger records events written to it
+type eventLogger struct {
+	go2chef.Logger
+	events []*go2chef.Event
+}
+
+func (l *eventLogger) WriteEvent(e *go2chef.Event) {
+	l.events = append(l.events, e)
+}
+
+func TestParseRate(t *testing.T) {
+	for in, want := range map[interface{}]int64{
+		nil:        0,
+		"10MiB":    10 << 20,
+		"512K/s":   512 << 10,
+		"1000":     1000,
+		2048:       2048,
+		float64(5): 5,
+	} {
+		if got, err := ParseRate(in); err != nil || got != want {
+			t.Errorf("ParseRate(%v) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []interface{}{"fast", -1, "10MiB/h", true} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("expected ParseRate(%v) to fail", in)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := &Limit{RateLimit: "100KiB"}
+	if err := l.Validate(); err != nil {
+		t.Fatalf("failed to validate limit: %s", err)
+	}
+	p := l.NewProgress("test", "data", -1)
+	p.interval = 0
+
+	// the first second's worth is a burst, the remaining 50KiB take ~0.5s
+	start := time.Now()
+	n, err := io.Copy(ioutil.Discard, p.Reader(bytes.NewReader(make([]byte, 150<<10))))
+	elapsed := time.Since(start)
+	if err != nil || n != 150<<10 {
+		t.Fatalf("copy failed after %d bytes: %v", n, err)
+	}
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("rate limited copy took %s, expected ~0.5s", elapsed)
+	}
+
+	// nil limiters don't limit
+	start = time.Now()
+	(*Limiter)(nil).Wait(1 << 30)
+	if NewLimiter(0) != nil || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("expected a zero rate to be unlimited")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	logger := &eventLogger{}
+	p := (&Limit{}).NewProgress("go2chef.source.test", "chef.rpm", 4<<20)
+	p.logger = logger
+	p.interval = time.Nanosecond
+
+	w := p.Writer(ioutil.Discard)
+	for i := 0; i < 4; i++ {
+		time.Sleep(time.Millisecond)
+		if _, err := w.Write(make([]byte, 1<<20)); err != nil {
+			t.Fatalf("write failed: %s", err)
+		}
+	}
+	if len(logger.events) != 4 {
+		t.Fatalf("expected 4 progress events, got %d", len(logger.events))
+	}
+	first, last := logger.events[0], logger.events[3]
+	if first.Event != EventProgress || first.Component != "go2chef.source.test" {
+		t.Errorf("unexpected event %+v", first)
+	}
+	if !strings.HasPrefix(first.Message, "chef.rpm: 1.0MiB of 4.0MiB (25%), ") || !strings.Contains(first.Message, "ETA") {
+		t.Errorf("unexpected progress message %q", first.Message)
+	}
+	if !strings.HasPrefix(last.Message, "chef.rpm: 4.0MiB of 4.0MiB (100%), ") || strings.Contains(last.Message, "ETA") {
+		t.Errorf("unexpected final progress message %q", last.Message)
+	}
+
+	// unknown totals only report bytes and rate; restarts reset the count
+	p.SetTotal(-1)
+	p.Restart(512)
+	p.Add(512)
+	if msg := logger.events[len(logger.events)-1].Message; !strings.HasPrefix(msg, "chef.rpm: 1.0KiB, ") {
+		t.Errorf("unexpected progress message %q", msg)
+	}
+}
+
+func TestDownloadProcessor(t *testing.T) {
+	defer func() {
+		Global, ProgressInterval = nil, DefaultProgressInterval
+	}()
+	if err := downloadProcessor("download", map[string]interface{}{"rate_limit": "1MiB/s", "progress_interval_seconds": 0}); err != nil {
+		t.Fatalf("failed to process config: %s", err)
+	}
+	if Global == nil || Global.rate != 1<<20 || ProgressInterval != 0 {
+		t.Errorf("unexpected global settings %+v %s", Global, ProgressInterval)
+	}
+	if err := downloadProcessor("download", map[string]interface{}{"rate_limit": "lots"}); err == nil {
+		t.Errorf("expected invalid rate limit to fail")
+	}
+}
@@ -0,0 +1,284 @@
+package git
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/secret"
+	"github.com/facebookincubator/go2chef/util/temp"
+	"github.com/mitchellh/mapstructure"
+)
+
+// TypeName is the name of this source plugin
+const TypeName = "go2chef.source.git"
+
+// defaultTokenUsername is sent with HTTPS tokens if no username is set; it's
+// what GitHub expects and other hosts ignore
+const defaultTokenUsername = "x-access-token"
+
+var commitRegex = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// Source implements a git repository source which checks out a branch, tag
+// or commit into the download path using the `git` command line tool.
+type Source struct {
+	logger go2chef.Logger
+
+	SourceName string `mapstructure:"name"`
+	URL        string `mapstructure:"url"`
+	// Ref is the branch or tag to check out, defaulting to the remote HEAD
+	Ref string `mapstructure:"ref"`
+	// Commit pins the full SHA of the commit to check out. If Ref is also
+	// set, the commit must be reachable from it.
+	Commit      string   `mapstructure:"commit"`
+	Depth       int      `mapstructure:"depth"`
+	SparsePaths []string `mapstructure:"sparse_paths"`
+	Submodules  bool     `mapstructure:"submodules"`
+
+	SSHKey         interface{} `mapstructure:"ssh_key"`
+	KnownHostsFile string      `mapstructure:"known_hosts_file"`
+	Token          interface{} `mapstructure:"token"`
+	Username       string      `mapstructure:"username"`
+
+	GitPath string `mapstructure:"git_path"`
+
+	env []string
+}
+
+func (s *Source) String() string {
+	return "<" + TypeName + ":" + s.SourceName + ">"
+}
+
+// Name returns the name of this source instance
+func (s *Source) Name() string {
+	return s.SourceName
+}
+
+// Type returns the type of this source
+func (s *Source) Type() string {
+	return TypeName
+}
+
+// SetName sets the name of this source instance
+func (s *Source) SetName(name string) {
+	s.SourceName = name
+}
+
+// DownloadToPath checks out the repository into dlPath. Rather than `git
+// clone`, this initializes an empty repository and fetches exactly the
+// ref or commit requested, which works for shallow fetches of any of them.
+func (s *Source) DownloadToPath(dlPath string) (err error) {
+	s.logger.WriteEvent(go2chef.NewEvent("GIT_CHECKOUT_STARTED", TypeName, s.URL))
+	head := ""
+	defer func() {
+		event, msg := "GIT_CHECKOUT_COMPLETE", s.URL+"@"+head
+		if err != nil {
+			event, msg = "GIT_CHECKOUT_FAILURE", s.URL
+		}
+		s.logger.WriteEvent(go2chef.NewEvent(event, TypeName, msg))
+	}()
+
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		return err
+	}
+	cleanup, err := s.setupAuth()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := s.git(dlPath, "init", "-q"); err != nil {
+		return err
+	}
+	if _, err := s.git(dlPath, "remote", "add", "origin", s.URL); err != nil {
+		return err
+	}
+	if len(s.SparsePaths) > 0 {
+		args := append([]string{"sparse-checkout", "set", "--no-cone"}, s.SparsePaths...)
+		if _, err := s.git(dlPath, args...); err != nil {
+			return err
+		}
+	}
+
+	want := s.Ref
+	switch {
+	case want == "" && s.Commit != "":
+		want = s.Commit
+	case want == "":
+		want = "HEAD"
+	}
+	fetch := []string{"fetch", "-q", "--no-tags"}
+	if s.Depth > 0 {
+		fetch = append(fetch, "--depth", strconv.Itoa(s.Depth))
+	}
+	if _, err := s.git(dlPath, append(fetch, "origin", want)...); err != nil {
+		return err
+	}
+
+	target := "FETCH_HEAD"
+	if s.Commit != "" {
+		target = s.Commit
+	}
+	if _, err := s.git(dlPath, "checkout", "-q", "--detach", target); err != nil {
+		return err
+	}
+	if head, err = s.git(dlPath, "rev-parse", "HEAD"); err != nil {
+		return err
+	}
+	if s.Commit != "" && head != s.Commit {
+		return fmt.Errorf("%s: checked out commit %s, expected %s", s.Name(), head, s.Commit)
+	}
+	s.logger.Debugf(0, "%s: checked out %s at %s", s.Name(), want, head)
+
+	if s.Submodules {
+		update := []string{"submodule", "update", "-q", "--init", "--recursive"}
+		if s.Depth > 0 {
+			update = append(update, "--depth", strconv.Itoa(s.Depth))
+		}
+		if _, err := s.git(dlPath, update...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupAuth prepares the environment for authenticated git commands,
+// returning a function to clean up any key material written to disk.
+// Credentials are passed via the environment rather than arguments so they
+// aren't visible in the process list.
+func (s *Source) setupAuth() (func(), error) {
+	s.env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var config [][2]string
+	cleanup := func() {}
+
+	if s.Token != nil {
+		token, err := secret.Resolve(s.Token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: token: %s", s.Name(), err)
+		}
+		basic := base64.StdEncoding.EncodeToString([]byte(s.Username + ":" + token))
+		go2chef.RegisterRedaction(basic)
+		// scope the header to this repository so it isn't sent to other
+		// hosts, e.g. when fetching submodules
+		config = append(config, [2]string{"http." + s.authURL() + ".extraHeader", "Authorization: Basic " + basic})
+	}
+	if go2chef.HTTP.Proxy != "" {
+		config = append(config, [2]string{"http.proxy", go2chef.HTTP.Proxy})
+	}
+	if len(config) > 0 {
+		s.env = append(s.env, "GIT_CONFIG_COUNT="+strconv.Itoa(len(config)))
+		for i, kv := range config {
+			s.env = append(s.env,
+				"GIT_CONFIG_KEY_"+strconv.Itoa(i)+"="+kv[0],
+				"GIT_CONFIG_VALUE_"+strconv.Itoa(i)+"="+kv[1],
+			)
+		}
+	}
+
+	ssh := []string{"ssh", "-o", "BatchMode=yes"}
+	if s.KnownHostsFile != "" {
+		ssh = append(ssh, "-o", shellQuote("UserKnownHostsFile="+s.KnownHostsFile), "-o", "StrictHostKeyChecking=yes")
+	}
+	if s.SSHKey != nil {
+		key, err := secret.Resolve(s.SSHKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: ssh_key: %s", s.Name(), err)
+		}
+		kf, err := temp.File("", "go2chef-git-key-")
+		if err != nil {
+			return nil, err
+		}
+		cleanup = func() { _ = os.Remove(kf.Name()) }
+		// OpenSSH rejects keys without a trailing newline
+		_, err = kf.WriteString(key + "\n")
+		if cerr := kf.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chmod(kf.Name(), 0600)
+		}
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		ssh = append(ssh, "-i", shellQuote(kf.Name()), "-o", "IdentitiesOnly=yes")
+	}
+	// git runs GIT_SSH_COMMAND through the shell
+	s.env = append(s.env, "GIT_SSH_COMMAND="+strings.Join(ssh, " "))
+	return cleanup, nil
+}
+
+// authURL returns the repository URL without any userinfo, for use as an
+// `http.<url>.*` config key. git matches these against the URL of each
+// request by scheme, host and path prefix.
+func (s *Source) authURL() string {
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Host == "" {
+		return s.URL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// shellQuote quotes a string for use as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// git runs a git command in dir, returning its trimmed stdout
+func (s *Source) git(dir string, args ...string) (string, error) {
+	s.logger.Debugf(1, "%s: git %s", s.Name(), strings.Join(args, " "))
+	cmd := exec.Command(s.GitPath, args...)
+	cmd.Dir = dir
+	cmd.Env = s.env
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Loader provides an instantiation function for this source
+func Loader(config map[string]interface{}) (go2chef.Source, error) {
+	s := &Source{
+		logger:     go2chef.GetGlobalLogger(),
+		SourceName: "",
+		Username:   defaultTokenUsername,
+		GitPath:    "git",
+	}
+	if err := mapstructure.Decode(config, s); err != nil {
+		return nil, err
+	}
+	if s.SourceName == "" {
+		s.SourceName = TypeName
+	}
+	if s.URL == "" {
+		return nil, fmt.Errorf("%s: url is required", TypeName)
+	}
+	if s.Commit != "" {
+		s.Commit = strings.ToLower(s.Commit)
+		if !commitRegex.MatchString(s.Commit) {
+			return nil, fmt.Errorf("%s: commit must be a full commit SHA, got %q", TypeName, s.Commit)
+		}
+	}
+	return s, nil
+}
+
+var _ go2chef.Source = &Source{}
+var _ go2chef.SourceLoader = Loader
+
+func init() {
+	go2chef.RegisterSource(TypeName, Loader)
+}
@@ -5,39 +5,107 @@ package http
 */
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/facebookincubator/go2chef/plugin/lib/certs"
+	"github.com/facebookincubator/go2chef/plugin/lib/cache"
+	// certs applies the `global.tls` configuration to go2chef.HTTPClient()
+	_ "github.com/facebookincubator/go2chef/plugin/lib/certs"
+	"github.com/facebookincubator/go2chef/plugin/lib/secret"
+	"github.com/facebookincubator/go2chef/plugin/lib/signature"
+	"github.com/facebookincubator/go2chef/plugin/lib/transfer"
 
-	"github.com/facebookincubator/go2chef/util/hashfile"
-	"github.com/facebookincubator/go2chef/util/temp"
 	"github.com/facebookincubator/go2chef/util"
+	"github.com/facebookincubator/go2chef/util/temp"
 
 	"github.com/facebookincubator/go2chef"
-	"github.com/mholt/archiver/v3"
+	"github.com/facebookincubator/go2chef/plugin/lib/archive"
 	"github.com/mitchellh/mapstructure"
 )
 
 // TypeName is the name of this source plugin
 const TypeName = "go2chef.source.http"
 
+const (
+	// MirrorSelectionOrder tries mirrors in the order they're configured
+	MirrorSelectionOrder = "order"
+	// MirrorSelectionLatency tries mirrors in order of measured latency
+	MirrorSelectionLatency = "latency"
+
+	// maxRetryDelay caps the exponential backoff between download attempts
+	maxRetryDelay = 30 * time.Second
+	// mirrorProbeTimeout bounds latency measurement for each mirror
+	mirrorProbeTimeout = 5 * time.Second
+	// maxRedirects matches net/http's default redirect limit
+	maxRedirects = 10
+)
+
 // Source implements an HTTP source for resource downloads
 type Source struct {
 	logger           go2chef.Logger
-	SourceName       string `mapstructure:"name"`
-	Method           string `mapstructure:"http_method"`
-	URL              string `mapstructure:"url"`
-	ValidStatusCodes []int  `mapstructure:"valid_status_codes"`
-	Archive          bool   `mapstructure:"archive"`
+	SourceName       string   `mapstructure:"name"`
+	Method           string   `mapstructure:"http_method"`
+	URL              string   `mapstructure:"url"`
+	URLs             []string `mapstructure:"urls"`
+	Mirrors          []string `mapstructure:"mirrors"`
+	MirrorSelection  string   `mapstructure:"mirror_selection"`
+	Index            *Index   `mapstructure:"index"`
+	ValidStatusCodes []int    `mapstructure:"valid_status_codes"`
+	Archive          bool     `mapstructure:"archive"`
+	archive.Options  `mapstructure:",squash"`
+	transfer.Limit   `mapstructure:",squash"`
 	OutputFilename   string `mapstructure:"output_filename"`
-	SHA256           string `mapstructure:"sha256"`
+	checksums        go2chef.ChecksumVerifiers
+
+	Signature map[string]interface{} `mapstructure:"signature"`
+	verifier  *signature.Verifier
+
+	Headers     map[string]interface{} `mapstructure:"headers"`
+	BasicAuth   *basicAuthConfig       `mapstructure:"basic_auth"`
+	BearerToken interface{}            `mapstructure:"bearer_token"`
+	Netrc       bool                   `mapstructure:"netrc"`
+	NetrcFile   string                 `mapstructure:"netrc_file"`
+	auth        *requestAuth
+
+	Retries               int `mapstructure:"retries"`
+	RetryDelaySeconds     int `mapstructure:"retry_delay_seconds"`
+	ConnectTimeoutSeconds int `mapstructure:"connect_timeout_seconds"`
+	ReadTimeoutSeconds    int `mapstructure:"read_timeout_seconds"`
+}
+
+// basicAuthConfig holds HTTP basic auth credentials. Each value may be any
+// secret.Resolve-able specification.
+type basicAuthConfig struct {
+	Username interface{} `mapstructure:"username"`
+	Password interface{} `mapstructure:"password"`
+}
+
+// requestAuth holds resolved credentials applied to every request
+type requestAuth struct {
+	headers  http.Header
+	username string
+	password string
+	basic    bool
+	bearer   string
+	netrc    map[string]netrcEntry
+	// origins are the scheme://host of each configured URL. Credentials
+	// are only sent to these, not to other hosts an index links to.
+	origins map[string]bool
 }
 
 // String returns a string representation of this
@@ -61,27 +129,34 @@ func (s *Source) SetName(n string) {
 }
 
 // DownloadToPath downloads a file over HTTP to a given path, handling
-// archive extraction if the Source.Archive parameter is true.
+// archive extraction if the Source.Archive parameter is true. If mirrors
+// are configured, each is tried in turn until one succeeds. If an index is
+// configured, the URLs are listings which are resolved to the newest
+// matching file first.
 func (s *Source) DownloadToPath(dlPath string) (err error) {
+	mirrors := s.mirrorList()
+	winner := ""
+
 	// set up start/end events
-	s.logger.WriteEvent(go2chef.NewEvent("HTTP_DOWNLOAD_STARTED", TypeName, s.URL))
+	s.logger.WriteEvent(go2chef.NewEvent("HTTP_DOWNLOAD_STARTED", TypeName, strings.Join(mirrors, ",")))
 	defer func() {
-		event := "HTTP_DOWNLOAD_COMPLETE"
+		event, msg := "HTTP_DOWNLOAD_COMPLETE", winner
 		if err != nil {
-			event = "HTTP_DOWNLOAD_FAILURE"
+			event, msg = "HTTP_DOWNLOAD_FAILURE", strings.Join(mirrors, ",")
 		}
-		s.logger.WriteEvent(go2chef.NewEvent(event, TypeName, s.URL))
+		s.logger.WriteEvent(go2chef.NewEvent(event, TypeName, msg))
 	}()
 
-	tlsConf, err := certs.TLS.GetTLSClientConf()
+	if len(mirrors) == 0 {
+		return errors.New("no url or mirrors configured")
+	}
+
+	c, err := s.client()
 	if err != nil {
 		return err
 	}
-	// Use the client from GlobalConfig so we can get any configured CAs
-	c := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConf,
-		},
+	if s.auth, err = s.resolveAuth(); err != nil {
+		return err
 	}
 
 	if ex, err := go2chef.PathExists(dlPath); err != nil {
@@ -92,32 +167,108 @@ func (s *Source) DownloadToPath(dlPath string) (err error) {
 			return err
 		}
 	}
-	s.logger.Debugf(1, "%s: 1", s.Name())
 
-	req, err := http.NewRequest(s.Method, s.URL, nil)
+	if len(mirrors) > 1 && s.MirrorSelection == MirrorSelectionLatency {
+		mirrors = s.sortByLatency(c, mirrors)
+	}
+
+	var (
+		tmpfile        *os.File
+		outputFilename string
+	)
+	for i := 0; i < len(mirrors); i++ {
+		var u string
+		tmpfile, outputFilename, u, err = s.fetchResolved(c, mirrors[i])
+		if err == nil {
+			winner = u
+			break
+		}
+		if i < len(mirrors)-1 {
+			s.logger.Errorf("%s: mirror %s failed: %s, failing over to %s", s.Name(), mirrors[i], err, mirrors[i+1])
+		}
+	}
 	if err != nil {
 		return err
 	}
+	_ = tmpfile.Close()
+	return s.install(outputFilename, tmpfile.Name(), dlPath)
+}
 
-	resp, err := c.Do(req)
-	if err != nil {
+// InstallFile moves or extracts a file fetched earlier, such as from the
+// download cache, into dlPath
+func (s *Source) InstallFile(filename, path, dlPath string) error {
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
 		return err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	outputFilename := s.OutputFilename
+	if outputFilename == "" {
+		outputFilename = filename
+	}
+	return s.install(outputFilename, path, dlPath)
+}
 
-	s.logger.Debugf(1, "%s: HTTP %s %s => %d %s", s.Name(), s.Method, s.URL, resp.StatusCode, http.StatusText(resp.StatusCode))
+// install moves a verified temp file to outputFilename in dlPath, or
+// extracts it there in archive mode
+func (s *Source) install(outputFilename, tmpPath, dlPath string) error {
+	outputPath := filepath.Join(dlPath, outputFilename)
+	s.logger.Debugf(1, "Final outputPath: '%s'", outputPath)
+
+	if s.Archive {
+		/*
+		  ARCHIVE MODE: If the request is for an archive (using `{"archive": true}` in config) then
+		  decompress that archive into the destination.
+		*/
+		s.logger.Debugf(1, "%s: archive mode enabled, extracting %s to %s", s.Name(), tmpPath, dlPath)
+		extFilename := filepath.Join(filepath.Dir(tmpPath), outputFilename)
+		if err := util.MoveFile(tmpPath, extFilename); err != nil {
+			s.logger.Errorf("failed to relocate output")
+			return err
+		}
+
+		if err := s.Extract(extFilename, dlPath); err != nil {
+			return err
+		}
+	} else {
+		/*
+			FILE MODE: If the request isn't for an archive (default), then just move
+			the temp file to the output path.
+		*/
+		s.logger.Debugf(1, "%s: direct download to %s, rename to %s", s.Name(), tmpPath, outputPath)
+		return util.MoveFile(tmpPath, outputPath)
+	}
+	return nil
+}
+
+// fetchResolved resolves a mirror's index, if one is configured, and
+// fetches the result, returning the URL actually downloaded too
+func (s *Source) fetchResolved(c *http.Client, mirror string) (*os.File, string, string, error) {
+	u := mirror
+	if s.Index != nil {
+		var err error
+		if u, err = s.resolveIndex(c, mirror); err != nil {
+			return nil, "", "", err
+		}
+	}
+	tmpfile, outputFilename, err := s.fetchMirror(c, u)
+	return tmpfile, outputFilename, u, err
+}
 
-	if !s.checkStatusCode(resp) {
-		return fmt.Errorf("non-matching status code: %d", resp.StatusCode)
+// fetchMirror downloads from a single mirror into a temp file and verifies
+// it, returning the temp file and the output filename to use for it
+func (s *Source) fetchMirror(c *http.Client, mirror string) (*os.File, string, error) {
+	reqURL, err := url.Parse(mirror)
+	if err != nil {
+		return nil, "", err
 	}
 
 	tmpfile, err := temp.File("", "go2chef-src-http-*")
-	defer func() { _ = tmpfile.Close() }()
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	if _, err = io.Copy(tmpfile, resp.Body); err != nil {
-		return err
+	resp, err := s.download(c, mirror, tmpfile)
+	if err != nil {
+		_ = tmpfile.Close()
+		return nil, "", err
 	}
 
 	/*
@@ -128,9 +279,9 @@ func (s *Source) DownloadToPath(dlPath string) (err error) {
 	  - Check if config["output_filename"] is set and use it if so
 	  - If not, check if the Content-Disposition has a download filename set and use that if so
 	*/
-	outputFilename := path.Base(req.URL.Path)
+	outputFilename := path.Base(reqURL.Path)
 
-	s.logger.Debugf(1, "Configured OutputFilename: '%s'",  s.OutputFilename)
+	s.logger.Debugf(1, "Configured OutputFilename: '%s'", s.OutputFilename)
 	if s.OutputFilename != "" {
 		outputFilename = s.OutputFilename
 	} else {
@@ -141,50 +292,477 @@ func (s *Source) DownloadToPath(dlPath string) (err error) {
 			}
 		}
 	}
-	outputPath := filepath.Join(dlPath, outputFilename)
-	s.logger.Debugf(1, "Final outputPath: '%s'", outputPath)
 
-	if s.SHA256 != "" {
-		s.logger.Debugf(1, "%s: sha256 was provided, validating %s", s.Name(), outputPath)
-		fileHash, err := hashfile.SHA256(tmpfile.Name())
+	if len(s.checksums) > 0 {
+		// manifests list the upstream name, which output_filename or
+		// Content-Disposition may have changed
+		upstreamFilename := path.Base(reqURL.Path)
+		s.logger.Debugf(1, "%s: checksum was provided, validating %s", s.Name(), upstreamFilename)
+		if err := s.checksums.VerifyChecksum(upstreamFilename, tmpfile.Name()); err != nil {
+			_ = tmpfile.Close()
+			return nil, "", err
+		}
+	}
+	if s.verifier != nil {
+		sig, err := s.get(c, s.verifier.SignatureLocation(mirror))
 		if err != nil {
-			return err
+			_ = tmpfile.Close()
+			return nil, "", fmt.Errorf("failed to fetch signature: %s", err)
+		}
+		if err := s.verifier.Verify(s, tmpfile.Name(), sig); err != nil {
+			_ = tmpfile.Close()
+			return nil, "", err
 		}
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		s.cachePut(mirror, tmpfile.Name(), outputFilename, resp.Header.Get("ETag"))
+	}
+	return tmpfile, outputFilename, nil
+}
 
-		s.logger.Debugf(1, "%s: calculated hash %s", s.Name(), fileHash)
-		s.logger.Debugf(1, "%s: provided hash %s", s.Name(), s.SHA256)
-		// If the hash doesn't match what is provided, return an error.
-		if fileHash != s.SHA256 {
-			return errors.New("sha256 hashes do not match")
+// cachePut stores a verified download in the persistent cache by URL if the
+// server supplied an ETag. Downloads with a known checksum are cached under
+// it by go2chef.GetSource instead.
+func (s *Source) cachePut(u, tmpPath, filename, etag string) {
+	if cache.Global == nil || etag == "" || go2chef.KnownChecksum(s.checksums) != nil {
+		return
+	}
+	if err := cache.Global.Put(cache.URLKey(u), tmpPath, cache.Meta{Source: u, ETag: etag, Filename: filename}); err != nil {
+		s.logger.Errorf("%s: failed to cache %s: %s", s.Name(), u, err)
+	}
+}
+
+// get fetches a small resource, such as a signature, into memory
+func (s *Source) get(c *http.Client, u string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.authorize(req)
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{code: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// FetchChecksumResource fetches a checksum manifest or its signature with
+// this source's headers and credentials, which are sent to it even if it's
+// on another host since it was configured alongside the source
+func (s *Source) FetchChecksumResource(loc string) ([]byte, error) {
+	c, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, loc, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.applyAuth(req)
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{code: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// AddChecksumVerifier adds a verifier run against each downloaded file
+// before it's extracted or moved into place
+func (s *Source) AddChecksumVerifier(v go2chef.ChecksumVerifier) {
+	s.checksums = append(s.checksums, v)
+}
+
+// mirrorList returns all configured URLs: `url` first, then `urls`, then
+// `mirrors`
+func (s *Source) mirrorList() []string {
+	var mirrors []string
+	if s.URL != "" {
+		mirrors = append(mirrors, s.URL)
+	}
+	mirrors = append(mirrors, s.URLs...)
+	return append(mirrors, s.Mirrors...)
+}
+
+// sortByLatency orders mirrors by the time taken to answer a HEAD request.
+// Mirrors which fail to answer are moved to the end but not dropped.
+func (s *Source) sortByLatency(c *http.Client, mirrors []string) []string {
+	latencies := make([]time.Duration, len(mirrors))
+	var wg sync.WaitGroup
+	for i, m := range mirrors {
+		wg.Add(1)
+		go func(i int, m string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), mirrorProbeTimeout)
+			defer cancel()
+			latencies[i] = math.MaxInt64
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, m, nil)
+			if err != nil {
+				return
+			}
+			s.authorize(req)
+			start := time.Now()
+			resp, err := c.Do(req)
+			if err != nil {
+				return
+			}
+			_ = resp.Body.Close()
+			latencies[i] = time.Since(start)
+		}(i, m)
+	}
+	wg.Wait()
+
+	idx := make([]int, len(mirrors))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return latencies[idx[a]] < latencies[idx[b]] })
+	sorted := make([]string, len(mirrors))
+	for i, j := range idx {
+		sorted[i] = mirrors[j]
+		s.logger.Debugf(1, "%s: mirror %s latency %s", s.Name(), mirrors[j], latencies[j])
+	}
+	return sorted
+}
+
+// resolveAuth resolves configured headers and credentials. Resolved values
+// are registered for redaction and never logged.
+func (s *Source) resolveAuth() (*requestAuth, error) {
+	auth := &requestAuth{headers: make(http.Header), origins: make(map[string]bool)}
+	for _, m := range s.mirrorList() {
+		if u, err := url.Parse(m); err == nil {
+			auth.origins[origin(u)] = true
+		}
+	}
+	for name, spec := range s.Headers {
+		val, err := secret.Resolve(spec)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %s", name, err)
 		}
+		auth.headers.Set(name, val)
 	}
 
-	if s.Archive {
-		/*
-		  ARCHIVE MODE: If the request is for an archive (using `{"archive": true}` in config) then
-		  decompress that archive into the destination.
-		*/
-		_ = tmpfile.Close()
-		s.logger.Debugf(1, "%s: archive mode enabled, extracting %s to %s", s.Name(), tmpfile.Name(), dlPath)
-		extFilename := filepath.Join(filepath.Dir(tmpfile.Name()), outputFilename)
-		if err := util.MoveFile(tmpfile.Name(), extFilename); err != nil {
-			s.logger.Errorf("failed to relocate output")
-			return err
+	var err error
+	if s.BasicAuth != nil {
+		if auth.username, err = secret.Resolve(s.BasicAuth.Username); err != nil {
+			return nil, fmt.Errorf("basic_auth username: %s", err)
+		}
+		if auth.password, err = secret.Resolve(s.BasicAuth.Password); err != nil {
+			return nil, fmt.Errorf("basic_auth password: %s", err)
+		}
+		auth.basic = true
+	}
+	if s.BearerToken != nil {
+		if auth.bearer, err = secret.Resolve(s.BearerToken); err != nil {
+			return nil, fmt.Errorf("bearer_token: %s", err)
 		}
+	}
 
-		if err := archiver.Unarchive(extFilename, dlPath); err != nil {
-			return err
+	if s.Netrc {
+		path := s.NetrcFile
+		if path == "" {
+			path = defaultNetrcPath()
+		}
+		if auth.netrc, err = readNetrc(path); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("netrc: %s", err)
+			}
+			s.logger.Debugf(1, "%s: netrc file %s does not exist", s.Name(), path)
 		}
+		for _, e := range auth.netrc {
+			go2chef.RegisterRedaction(e.password)
+		}
+	}
+	return auth, nil
+}
+
+// authorize applies configured headers and credentials to a request for
+// one of the configured URLs' hosts. Explicit basic_auth or bearer_token
+// take precedence over netrc.
+func (s *Source) authorize(req *http.Request) {
+	if s.auth == nil || !s.auth.origins[origin(req.URL)] {
+		return
+	}
+	s.applyAuth(req)
+}
+
+// applyAuth applies configured headers and credentials to a request
+// regardless of its host
+func (s *Source) applyAuth(req *http.Request) {
+	if s.auth == nil {
+		return
+	}
+	for name, vals := range s.auth.headers {
+		req.Header[name] = vals
+	}
+	switch {
+	case s.auth.basic:
+		req.SetBasicAuth(s.auth.username, s.auth.password)
+	case s.auth.bearer != "":
+		req.Header.Set("Authorization", "Bearer "+s.auth.bearer)
+	case s.auth.netrc != nil:
+		e, ok := s.auth.netrc[req.URL.Hostname()]
+		if !ok {
+			e, ok = s.auth.netrc[""]
+		}
+		if ok {
+			req.SetBasicAuth(e.login, e.password)
+		}
+	}
+}
+
+// origin returns the scheme and host of u
+func origin(u *url.URL) string {
+	return u.Scheme + "://" + strings.ToLower(u.Host)
+}
+
+// client returns a copy of the shared go2chef HTTP client, or a client with
+// the same global settings if this source overrides the timeouts. Custom
+// headers are dropped when a redirect leaves the original host, just as Go
+// drops Authorization.
+func (s *Source) client() (*http.Client, error) {
+	var (
+		c   *http.Client
+		err error
+	)
+	if s.ConnectTimeoutSeconds == go2chef.HTTP.ConnectTimeoutSeconds && s.ReadTimeoutSeconds == go2chef.HTTP.ReadTimeoutSeconds {
+		c, err = go2chef.HTTPClient()
 	} else {
-		/*
-			FILE MODE: If the request isn't for an archive (default), then just close the temp file
-			and move to the output path.
-		*/
-		s.logger.Debugf(1, "%s: direct download to %s, rename to %s", s.Name(), tmpfile.Name(), outputPath)
-		_ = tmpfile.Close()
-		return util.MoveFile(tmpfile.Name(), outputPath)
+		hc := *go2chef.HTTP
+		hc.ConnectTimeoutSeconds = s.ConnectTimeoutSeconds
+		hc.ReadTimeoutSeconds = s.ReadTimeoutSeconds
+		c, err = hc.Client()
 	}
-	return nil
+	if err != nil {
+		return nil, err
+	}
+
+	cc := *c
+	next := c.CheckRedirect
+	cc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if s.auth != nil && req.URL.Host != via[0].URL.Host {
+			for name := range s.auth.headers {
+				req.Header.Del(name)
+			}
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+	return &cc, nil
+}
+
+// download fetches the source URL into tmpfile, retrying with exponential
+// backoff. Retries resume from the end of the partial file using a Range
+// request guarded by If-Range, so a changed object is never spliced onto
+// a partial download of the old one. The final response is returned with
+// its body closed.
+func (s *Source) download(c *http.Client, u string, tmpfile *os.File) (*http.Response, error) {
+	var (
+		validator string
+		offset    int64
+	)
+	delay := time.Duration(s.RetryDelaySeconds) * time.Second
+	progress := s.NewProgress(TypeName, u, -1)
+	for attempt := 0; ; attempt++ {
+		resp, err := s.fetch(c, u, tmpfile, offset, validator, progress)
+		if err == nil {
+			return resp, nil
+		}
+		if resp != nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent) {
+			validator = resumeValidator(resp)
+		}
+		if attempt >= s.Retries || !retryable(resp, err) {
+			return nil, err
+		}
+
+		// resume from wherever the last attempt left off, but only if the
+		// object can be validated as unchanged
+		if offset, err = tmpfile.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		if validator == "" {
+			offset = 0
+		}
+		s.logger.Errorf("%s: download attempt %d/%d failed (%s), retrying from byte %d in %s", s.Name(), attempt+1, s.Retries+1, err, offset, delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// fetch performs a single download attempt into tmpfile starting from
+// offset, counting the body towards progress. The response is returned (if
+// one was received) even on error.
+func (s *Source) fetch(c *http.Client, u string, tmpfile *os.File, offset int64, validator string, progress *transfer.Progress) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, s.Method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.authorize(req)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+	var cached *cache.Entry
+	if offset == 0 {
+		if cached = s.cachedByURL(u); cached != nil {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	s.logger.Debugf(1, "%s: HTTP %s %s => %d %s", s.Name(), s.Method, u, resp.StatusCode, http.StatusText(resp.StatusCode))
+
+	// start is where in the file this response's body begins
+	var start int64
+	switch {
+	case cached != nil && resp.StatusCode == http.StatusNotModified:
+		s.logger.Debugf(1, "%s: %s not modified, using cached %s", s.Name(), u, cached.Key)
+		if _, err := tmpfile.Seek(0, io.SeekStart); err != nil {
+			return resp, err
+		}
+		if err := tmpfile.Truncate(0); err != nil {
+			return resp, err
+		}
+		_, err := cache.Global.CopyTo(cached.Key, tmpfile)
+		return resp, err
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		if rs := contentRangeStart(resp); rs != offset {
+			return resp, fmt.Errorf("server resumed at byte %d, expected %d", rs, offset)
+		}
+		s.logger.Debugf(1, "%s: resuming download at byte %d", s.Name(), offset)
+		start = offset
+	case !s.checkStatusCode(resp):
+		return resp, &statusError{code: resp.StatusCode}
+	default:
+		// full response: either a fresh download or the object changed
+		// since the last attempt, so start over
+		if _, err := tmpfile.Seek(0, io.SeekStart); err != nil {
+			return resp, err
+		}
+		if err := tmpfile.Truncate(0); err != nil {
+			return resp, err
+		}
+	}
+	progress.Restart(start)
+	if resp.ContentLength >= 0 {
+		progress.SetTotal(start + resp.ContentLength)
+	}
+
+	// the idle timeout only covers reads from the network, not time spent
+	// throttled by the rate limit
+	var body io.Reader = resp.Body
+	if s.ReadTimeoutSeconds > 0 {
+		body = newIdleTimeoutReader(body, time.Duration(s.ReadTimeoutSeconds)*time.Second, cancel)
+	}
+	if _, err := io.Copy(tmpfile, progress.Reader(body)); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// cachedByURL returns the persistent cache entry for a URL if the content
+// can be revalidated by ETag. Sources with a known checksum use the
+// checksum-keyed entry instead.
+func (s *Source) cachedByURL(u string) *cache.Entry {
+	if cache.Global == nil || go2chef.KnownChecksum(s.checksums) != nil {
+		return nil
+	}
+	e, ok := cache.Global.Get(cache.URLKey(u))
+	if !ok || e.ETag == "" {
+		return nil
+	}
+	return e
+}
+
+// statusError is returned when the server responds with an unexpected status
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("non-matching status code: %d", e.code)
+}
+
+// retryable returns whether a failed attempt is worth retrying: network
+// errors, timeouts and server-side/throttling status codes are, other
+// client errors aren't.
+func retryable(resp *http.Response, err error) bool {
+	if se, ok := err.(*statusError); ok {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests || se.code == http.StatusRequestTimeout
+	}
+	return true
+}
+
+// resumeValidator returns a value usable in If-Range for this response. Weak
+// ETags can't be used for range requests, so Last-Modified is the fallback.
+func resumeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// contentRangeStart parses the first byte position from a Content-Range
+// header (`bytes 100-199/200`), returning -1 if it can't be parsed.
+func contentRangeStart(resp *http.Response) int64 {
+	cr := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	dash := strings.Index(cr, "-")
+	if dash < 0 {
+		return -1
+	}
+	start, err := strconv.ParseInt(cr[:dash], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// idleTimeoutReader cancels an in-flight request if a read waits longer
+// than the timeout for data. The timer only runs during reads, so time the
+// caller spends between reads doesn't count.
+type idleTimeoutReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newIdleTimeoutReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	t := &idleTimeoutReader{
+		r:       r,
+		timer:   time.AfterFunc(timeout, cancel),
+		timeout: timeout,
+	}
+	t.timer.Stop()
+	return t
+}
+
+func (t *idleTimeoutReader) Read(p []byte) (int, error) {
+	t.timer.Reset(t.timeout)
+	n, err := t.r.Read(p)
+	t.timer.Stop()
+	return n, err
 }
 
 // checkStatusCodes does the logic for checking if non-200 status codes
@@ -204,14 +782,14 @@ func (s *Source) checkStatusCode(resp *http.Response) bool {
 // Loader implements SourceLoader for plugin registration
 func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	s := &Source{
-		go2chef.GetGlobalLogger(),
-		"",
-		"GET",
-		"",
-		make([]int, 0),
-		false,
-		"",
-		"",
+		logger:                go2chef.GetGlobalLogger(),
+		Method:                "GET",
+		MirrorSelection:       MirrorSelectionOrder,
+		ValidStatusCodes:      make([]int, 0),
+		Retries:               go2chef.HTTP.Retries,
+		RetryDelaySeconds:     go2chef.HTTP.RetryDelaySeconds,
+		ConnectTimeoutSeconds: go2chef.HTTP.ConnectTimeoutSeconds,
+		ReadTimeoutSeconds:    go2chef.HTTP.ReadTimeoutSeconds,
 	}
 	if err := mapstructure.Decode(config, s); err != nil {
 		return nil, err
@@ -219,10 +797,33 @@ func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	if s.SourceName == "" {
 		s.SourceName = "http"
 	}
+	if err := s.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	if err := s.Limit.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	verifier, err := signature.Load(s.Signature)
+	if err != nil {
+		return nil, err
+	}
+	s.verifier = verifier
+	if s.Index != nil {
+		if err := s.Index.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s", TypeName, err)
+		}
+	}
+	switch s.MirrorSelection {
+	case MirrorSelectionOrder, MirrorSelectionLatency:
+	default:
+		return nil, fmt.Errorf("%s: invalid mirror_selection %q", TypeName, s.MirrorSelection)
+	}
 	return s, nil
 }
 
-var _ go2chef.Source = &Source{}
+var _ go2chef.ChecksumSource = &Source{}
+var _ go2chef.ChecksumFetcher = &Source{}
+var _ go2chef.FileInstaller = &Source{}
 var _ go2chef.SourceLoader = Loader
 
 func init() {
@@ -5,14 +5,23 @@ package http
 */
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/cache"
 	"github.com/facebookincubator/go2chef/util/testutil"
 )
 
@@ -99,3 +108,466 @@ func TestSource_DownloadToPathArchive(t *testing.T) {
 		}
 	}
 }
+
+// flakyHandler serves content, but aborts the first response after
+// sending half of the body
+type flakyHandler struct {
+	content  func() string
+	etag     func() string
+	requests []*http.Request
+}
+
+func (f *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r)
+	content := f.content()
+	w.Header().Set("ETag", f.etag())
+	if len(f.requests) == 1 {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = io.WriteString(w, content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	http.ServeContent(w, r, "test.txt", time.Time{}, strings.NewReader(content))
+}
+
+func downloadOne(t *testing.T, config map[string]interface{}) string {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config["retry_delay_seconds"] = 0
+	config["output_filename"] = "out"
+	s, err := go2chef.GetSource(TypeName, config)
+	if err != nil {
+		t.Fatalf("failed to initialize source: %s", err)
+	}
+	if err := s.DownloadToPath(dir); err != nil {
+		t.Fatalf("failed to download to path %s: %s", dir, err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %s", err)
+	}
+	return string(data)
+}
+
+// Test that interrupted downloads resume with a validated Range request
+func TestSource_DownloadToPathResume(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	h := &flakyHandler{
+		content: func() string { return content },
+		etag:    func() string { return `"v1"` },
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	if data := downloadOne(t, map[string]interface{}{"url": ts.URL}); data != content {
+		t.Errorf("resumed download content mismatch (%d bytes, expected %d)", len(data), len(content))
+	}
+	if len(h.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(h.requests))
+	}
+	if rng := h.requests[1].Header.Get("Range"); rng != fmt.Sprintf("bytes=%d-", len(content)/2) {
+		t.Errorf("unexpected Range header on retry: %q", rng)
+	}
+	if ir := h.requests[1].Header.Get("If-Range"); ir != `"v1"` {
+		t.Errorf("unexpected If-Range header on retry: %q", ir)
+	}
+}
+
+// Test that a download restarts from scratch if the object changes
+func TestSource_DownloadToPathChangedObject(t *testing.T) {
+	v1, v2 := strings.Repeat("a", 1000), strings.Repeat("b", 1000)
+	h := &flakyHandler{}
+	h.content = func() string {
+		if len(h.requests) == 1 {
+			return v1
+		}
+		return v2
+	}
+	h.etag = func() string {
+		if len(h.requests) == 1 {
+			return `"v1"`
+		}
+		return `"v2"`
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	if data := downloadOne(t, map[string]interface{}{"url": ts.URL}); data != v2 {
+		t.Errorf("changed object was spliced into the download")
+	}
+}
+
+// Test that server errors are retried
+func TestSource_DownloadToPathRetry(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	if data := downloadOne(t, map[string]interface{}{"url": ts.URL}); data != "hello" {
+		t.Errorf("did not get expected content `hello`: %q", data)
+	}
+
+	calls = 0
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	s, _ := Loader(map[string]interface{}{"url": ts.URL, "retries": 1, "retry_delay_seconds": 0})
+	if err := s.DownloadToPath(dir); err == nil {
+		t.Errorf("expected failure when retries are exhausted")
+	}
+}
+
+// Test failover between mirrors on bad status and checksum mismatch
+func TestSource_DownloadToPathMirrors(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer broken.Close()
+	corrupt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "corrupt")
+	}))
+	defer corrupt.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer good.Close()
+
+	data := downloadOne(t, map[string]interface{}{
+		"urls":    []string{broken.URL, corrupt.URL},
+		"mirrors": []string{good.URL},
+		"sha256":  "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	})
+	if data != "hello" {
+		t.Errorf("did not get expected content `hello` from good mirror: %q", data)
+	}
+}
+
+// Test that mirrors are ordered by latency with unreachable mirrors last
+func TestSource_sortByLatency(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+
+	src, err := Loader(map[string]interface{}{"mirror_selection": MirrorSelectionLatency})
+	if err != nil {
+		t.Fatalf("failed to initialize source: %s", err)
+	}
+	s := src.(*Source)
+	c, _ := s.client()
+	sorted := s.sortByLatency(c, []string{dead.URL, slow.URL, fast.URL})
+	if sorted[0] != fast.URL || sorted[1] != slow.URL || sorted[2] != dead.URL {
+		t.Errorf("unexpected mirror order: %v", sorted)
+	}
+}
+
+// Test that time spent throttled by rate_limit doesn't count towards
+// read_timeout_seconds, while a stalled server still times out
+func TestSource_DownloadToPathRateLimitReadTimeout(t *testing.T) {
+	content := strings.Repeat("x", 3<<10+512)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		// the rest of the body is sent after the timeout has passed, but
+		// while the first part is still being throttled
+		_, _ = fmt.Fprint(w, content[:3<<10])
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/stall" {
+			<-r.Context().Done()
+			return
+		}
+		time.Sleep(1500 * time.Millisecond)
+		_, _ = fmt.Fprint(w, content[3<<10:])
+	}))
+	defer ts.Close()
+
+	// the first KiB is a burst, the rest takes ~2.5s to be let through
+	start := time.Now()
+	if got := downloadOne(t, map[string]interface{}{
+		"url":                  ts.URL,
+		"rate_limit":           "1KiB",
+		"read_timeout_seconds": 1,
+		"retries":              0,
+	}); got != content {
+		t.Errorf("unexpected content after rate limited download: %d bytes", len(got))
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("rate limited download took only %s", elapsed)
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := Loader(map[string]interface{}{
+		"url":                  ts.URL + "/stall",
+		"read_timeout_seconds": 1,
+		"retries":              0,
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize source: %s", err)
+	}
+	if err := s.DownloadToPath(dir); err == nil {
+		t.Errorf("expected stalled download to time out")
+	}
+}
+
+// Test that headers and credentials are applied to requests
+func TestSource_DownloadToPathAuth(t *testing.T) {
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	os.Setenv("GO2CHEF_TEST_TOKEN", "bearer-secret")
+	defer os.Unsetenv("GO2CHEF_TEST_TOKEN")
+
+	downloadOne(t, map[string]interface{}{
+		"url": ts.URL,
+		"headers": map[string]interface{}{
+			"X-Static": "static-value",
+			"X-Env":    map[string]interface{}{"env": "GO2CHEF_TEST_TOKEN"},
+		},
+		"bearer_token": map[string]interface{}{"env": "GO2CHEF_TEST_TOKEN"},
+	})
+	if v := got.Header.Get("X-Static"); v != "static-value" {
+		t.Errorf("unexpected X-Static header: %q", v)
+	}
+	if v := got.Header.Get("X-Env"); v != "bearer-secret" {
+		t.Errorf("unexpected X-Env header: %q", v)
+	}
+	if v := got.Header.Get("Authorization"); v != "Bearer bearer-secret" {
+		t.Errorf("unexpected Authorization header: %q", v)
+	}
+
+	downloadOne(t, map[string]interface{}{
+		"url":        ts.URL,
+		"basic_auth": map[string]interface{}{"username": "user", "password": "basic-secret"},
+	})
+	if u, p, ok := got.BasicAuth(); !ok || u != "user" || p != "basic-secret" {
+		t.Errorf("unexpected basic auth: %q %q %t", u, p, ok)
+	}
+}
+
+// Test that custom headers only follow redirects on the same host
+func TestSource_DownloadToPathAuthRedirect(t *testing.T) {
+	var got *http.Request
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, "/file", http.StatusFound)
+		case "/cross":
+			http.Redirect(w, r, other.URL+"/file", http.StatusFound)
+		default:
+			got = r
+			_, _ = fmt.Fprint(w, "hello")
+		}
+	}))
+	defer ts.Close()
+
+	for path, want := range map[string]string{"/same": "static-value", "/cross": ""} {
+		got = nil
+		downloadOne(t, map[string]interface{}{
+			"url":     ts.URL + path,
+			"headers": map[string]interface{}{"X-Static": "static-value"},
+		})
+		if got == nil {
+			t.Fatalf("%s: redirect target wasn't requested", path)
+		}
+		if v := got.Header.Get("X-Static"); v != want {
+			t.Errorf("%s: unexpected X-Static header after redirect: %q", path, v)
+		}
+	}
+}
+
+// Test that checksum manifests are matched against the upstream file name,
+// even if the file is saved under another one
+func TestSource_DownloadToPathChecksumManifest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the manifest is fetched with the source's credentials too
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/SHA256SUMS":
+			_, _ = fmt.Fprintln(w, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  chef.rpm")
+		case "/disposition/chef.rpm":
+			w.Header().Set("Content-Disposition", "attachment; filename=renamed.rpm")
+			fallthrough
+		default:
+			_, _ = fmt.Fprint(w, "hello")
+		}
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		config map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{"url": ts.URL + "/chef.rpm", "output_filename": "out.rpm"}, "out.rpm"},
+		{map[string]interface{}{"url": ts.URL + "/disposition/chef.rpm"}, "renamed.rpm"},
+	} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		tc.config["type"] = TypeName
+		tc.config["checksum_url"] = ts.URL + "/SHA256SUMS"
+		tc.config["bearer_token"] = "s3cret"
+		s, err := go2chef.GetSource(TypeName, tc.config)
+		if err != nil {
+			t.Fatalf("failed to initialize source: %s", err)
+		}
+		if err := s.DownloadToPath(dir); err != nil {
+			t.Errorf("%s: failed to download: %s", tc.want, err)
+			continue
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(dir, tc.want)); err != nil || string(data) != "hello" {
+			t.Errorf("expected %s to be downloaded: %q, %v", tc.want, data, err)
+		}
+	}
+}
+
+// Test that a mirror serving an artifact with a bad signature is skipped
+func TestSource_DownloadToPathSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	handler := func(content string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".sig") {
+				_, _ = w.Write(ed25519.Sign(priv, []byte("hello")))
+				return
+			}
+			_, _ = fmt.Fprint(w, content)
+		}
+	}
+	tampered := httptest.NewServer(handler("tampered"))
+	defer tampered.Close()
+	good := httptest.NewServer(handler("hello"))
+	defer good.Close()
+
+	data := downloadOne(t, map[string]interface{}{
+		"urls": []string{tampered.URL + "/chef.rpm", good.URL + "/chef.rpm"},
+		"signature": map[string]interface{}{
+			"format": "ed25519",
+			"keys":   []string{base64.StdEncoding.EncodeToString(pub)},
+		},
+	})
+	if data != "hello" {
+		t.Errorf("did not get expected content `hello` from good mirror: %q", data)
+	}
+}
+
+// Test that downloads are served from the persistent cache
+func TestSource_DownloadToPathCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	cache.Global = cache.New(dir, 0)
+	go2chef.SetDownloadCache(cache.Global)
+	defer func() {
+		cache.Global = nil
+		go2chef.SetDownloadCache(nil)
+	}()
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	// without a checksum, the cached copy is revalidated by ETag
+	for i := 0; i < 2; i++ {
+		if data := downloadOne(t, map[string]interface{}{"url": ts.URL + "/etag"}); data != "hello" {
+			t.Errorf("unexpected content %q on download %d", data, i)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+
+	// with a checksum, the cached copy is used without any request
+	config := func() map[string]interface{} {
+		return map[string]interface{}{
+			"url":    ts.URL + "/sum",
+			"sha256": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		}
+	}
+	downloadOne(t, config())
+	ts.Close()
+	if data := downloadOne(t, config()); data != "hello" {
+		t.Errorf("unexpected cached content %q", data)
+	}
+	if requests != 3 {
+		t.Errorf("expected the checksummed download to be served from cache, got %d requests", requests)
+	}
+}
+
+func TestReadNetrc(t *testing.T) {
+	tf, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create tempfile: %s", err)
+	}
+	defer os.Remove(tf.Name())
+	_, _ = tf.WriteString(`machine artifacts.example.com login alice password s3cret
+macdef init
+  machine ignored.example.com login x password y
+
+machine other.example.com
+  login bob
+  password hunter2
+default login anon password anon-pass
+`)
+	tf.Close()
+
+	entries, err := readNetrc(tf.Name())
+	if err != nil {
+		t.Fatalf("failed to read netrc: %s", err)
+	}
+	for machine, exp := range map[string]netrcEntry{
+		"artifacts.example.com": {"alice", "s3cret"},
+		"other.example.com":     {"bob", "hunter2"},
+		"":                      {"anon", "anon-pass"},
+	} {
+		if entries[machine] != exp {
+			t.Errorf("netrc entry for %q: expected %#v, got %#v", machine, exp, entries[machine])
+		}
+	}
+	if _, ok := entries["ignored.example.com"]; ok {
+		t.Errorf("macdef contents should be skipped")
+	}
+}
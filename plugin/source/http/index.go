@@ -0,0 +1,334 @@
+package http
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/facebookincubator/go2chef/util/version"
+)
+
+// Index listing formats
+const (
+	IndexFormatAuto = "auto"
+	IndexFormatHTML = "html"
+	IndexFormatJSON = "json"
+	IndexFormatS3   = "s3"
+)
+
+const (
+	// maxIndexSize bounds how much of each listing response is read
+	maxIndexSize = 16 << 20
+	// maxIndexPages bounds pagination of S3 listings
+	maxIndexPages = 1000
+)
+
+// Index configures resolving the download from a listing: the source's
+// URLs point at the listing rather than the file, and the newest entry
+// whose name matches Pattern is downloaded.
+type Index struct {
+	// Pattern is a regular expression matched against the whole entry
+	// name. The version is taken from a `version` named group, the first
+	// group, or the whole name, in that order.
+	Pattern string `mapstructure:"pattern"`
+	// VersionScheme is how versions are ordered: semver, rpm or deb
+	VersionScheme string `mapstructure:"version_scheme"`
+	// Format is the listing format: html (a directory index page), json
+	// (an array of names or of objects with name/url/href fields), s3 (an
+	// S3 ListObjects response) or auto to detect it from the response
+	Format string `mapstructure:"format"`
+
+	pattern *regexp.Regexp
+	group   int
+}
+
+// indexEntry is a single file in a listing
+type indexEntry struct {
+	name    string
+	url     string
+	version string
+}
+
+// validate checks the index configuration and applies defaults
+func (i *Index) validate() error {
+	if i.Pattern == "" {
+		return errors.New("index pattern is required")
+	}
+	var err error
+	if i.pattern, err = regexp.Compile("^(?:" + i.Pattern + ")$"); err != nil {
+		return fmt.Errorf("invalid index pattern: %s", err)
+	}
+	i.group = i.pattern.SubexpIndex("version")
+	if i.group < 0 && i.pattern.NumSubexp() > 0 {
+		i.group = 1
+	}
+	if i.VersionScheme == "" {
+		i.VersionScheme = version.SchemeSemver
+	}
+	if !version.Supported(i.VersionScheme) {
+		return fmt.Errorf("invalid index version_scheme %q", i.VersionScheme)
+	}
+	switch i.Format {
+	case "":
+		i.Format = IndexFormatAuto
+	case IndexFormatAuto, IndexFormatHTML, IndexFormatJSON, IndexFormatS3:
+	default:
+		return fmt.Errorf("invalid index format %q", i.Format)
+	}
+	return nil
+}
+
+// resolveIndex fetches the listing at u and returns the URL of the newest
+// matching entry
+func (s *Source) resolveIndex(c *http.Client, u string) (string, error) {
+	body, base, err := s.getIndex(c, u)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch index %s: %s", u, err)
+	}
+	format := s.Index.Format
+	if format == IndexFormatAuto {
+		format = detectIndexFormat(body)
+	}
+
+	var entries []indexEntry
+	switch format {
+	case IndexFormatHTML:
+		entries = parseHTMLIndex(body, base)
+	case IndexFormatJSON:
+		entries, err = parseJSONIndex(body, base)
+	case IndexFormatS3:
+		entries, err = s.parseS3Index(c, body, base)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to parse index %s: %s", u, err)
+	}
+
+	best := s.Index.latest(entries, func(e indexEntry, err error) {
+		s.logger.Debugf(1, "%s: ignoring index entry %s: %s", s.Name(), e.name, err)
+	})
+	if best == nil {
+		return "", fmt.Errorf("no entries in index %s match %q", u, s.Index.Pattern)
+	}
+	s.logger.Infof("%s: resolved %s to %s (version %s)", s.Name(), u, best.url, best.version)
+	return best.url, nil
+}
+
+// latest filters entries by the pattern and returns the one with the
+// highest version, or nil if none match. Entries whose version can't be
+// parsed are reported to skip and ignored.
+func (i *Index) latest(entries []indexEntry, skip func(indexEntry, error)) *indexEntry {
+	var best *indexEntry
+	for _, e := range entries {
+		m := i.pattern.FindStringSubmatch(e.name)
+		if m == nil {
+			continue
+		}
+		e.version = m[0]
+		if i.group > 0 {
+			e.version = m[i.group]
+		}
+		if err := version.Validate(i.VersionScheme, e.version); err != nil {
+			skip(e, err)
+			continue
+		}
+		if best == nil {
+			e := e
+			best = &e
+		} else if c, _ := version.Compare(i.VersionScheme, e.version, best.version); c > 0 {
+			e := e
+			best = &e
+		}
+	}
+	return best
+}
+
+// getIndex fetches a listing, returning its body and the final URL after
+// redirects, against which relative links are resolved
+func (s *Source) getIndex(c *http.Client, u string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.authorize(req)
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, &statusError{code: resp.StatusCode}
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxIndexSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) > maxIndexSize {
+		return nil, nil, fmt.Errorf("index is larger than %d bytes", maxIndexSize)
+	}
+	return body, resp.Request.URL, nil
+}
+
+// detectIndexFormat guesses a listing's format from its content
+func detectIndexFormat(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return IndexFormatJSON
+	case bytes.Contains(trimmed, []byte("<ListBucketResult")):
+		return IndexFormatS3
+	}
+	return IndexFormatHTML
+}
+
+// newIndexEntry resolves ref against the listing URL. The name defaults to
+// the base name of the resolved path. Directories yield ok == false.
+func newIndexEntry(base *url.URL, ref, name string) (indexEntry, bool) {
+	r, err := url.Parse(ref)
+	if err != nil {
+		return indexEntry{}, false
+	}
+	abs := base.ResolveReference(r)
+	if strings.HasSuffix(abs.Path, "/") || abs.Path == "" {
+		return indexEntry{}, false
+	}
+	if name == "" {
+		name = path.Base(abs.Path)
+	}
+	return indexEntry{name: name, url: abs.String()}, true
+}
+
+var hrefRegexp = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+// parseHTMLIndex extracts links from a directory index page
+func parseHTMLIndex(body []byte, base *url.URL) []indexEntry {
+	var entries []indexEntry
+	for _, m := range hrefRegexp.FindAllSubmatch(body, -1) {
+		href := html.UnescapeString(string(m[1]) + string(m[2]) + string(m[3]))
+		// skip sort links and fragments
+		if href == "" || strings.HasPrefix(href, "?") || strings.HasPrefix(href, "#") {
+			continue
+		}
+		if e, ok := newIndexEntry(base, href, ""); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// parseJSONIndex parses an array of names or of {name, url|href} objects.
+// Plain names are relative to the listing URL.
+func parseJSONIndex(body []byte, base *url.URL) ([]indexEntry, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	var entries []indexEntry
+	for _, r := range raw {
+		var name, ref string
+		if err := json.Unmarshal(r, &ref); err != nil {
+			var obj struct {
+				Name string `json:"name"`
+				URL  string `json:"url"`
+				Href string `json:"href"`
+			}
+			if err := json.Unmarshal(r, &obj); err != nil {
+				return nil, fmt.Errorf("unsupported entry %s", r)
+			}
+			name, ref = obj.Name, obj.URL
+			if ref == "" {
+				ref = obj.Href
+			}
+			if ref == "" {
+				ref = "./" + url.PathEscape(obj.Name)
+			}
+		} else {
+			ref = "./" + url.PathEscape(ref)
+		}
+		if e, ok := newIndexEntry(base, ref, name); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// s3Listing is the subset of a ListObjects/ListObjectsV2 response used here
+type s3Listing struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextMarker            string `xml:"NextMarker"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+// parseS3Index parses an S3 bucket listing, following pagination. Object
+// URLs are the listing URL without its query plus the key, which works for
+// both virtual-hosted and path-style listing URLs.
+func (s *Source) parseS3Index(c *http.Client, body []byte, base *url.URL) ([]indexEntry, error) {
+	root := *base
+	root.RawQuery = ""
+	if !strings.HasSuffix(root.Path, "/") {
+		root.Path += "/"
+		root.RawPath = ""
+	}
+
+	var entries []indexEntry
+	for page := 0; ; page++ {
+		var l s3Listing
+		if err := xml.Unmarshal(body, &l); err != nil {
+			return nil, err
+		}
+		for _, obj := range l.Contents {
+			if e, ok := newIndexEntry(&root, "./"+escapeKey(obj.Key), ""); ok {
+				entries = append(entries, e)
+			}
+		}
+		if !l.IsTruncated {
+			return entries, nil
+		}
+		if page >= maxIndexPages {
+			return nil, fmt.Errorf("listing has more than %d pages", maxIndexPages)
+		}
+
+		q := base.Query()
+		switch {
+		case l.NextContinuationToken != "":
+			q.Set("continuation-token", l.NextContinuationToken)
+		case l.NextMarker != "":
+			q.Set("marker", l.NextMarker)
+		case len(l.Contents) > 0:
+			q.Set("marker", l.Contents[len(l.Contents)-1].Key)
+		default:
+			return nil, errors.New("truncated listing has no continuation marker")
+		}
+		next := *base
+		next.RawQuery = q.Encode()
+		var err error
+		if body, _, err = s.getIndex(c, next.String()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// escapeKey escapes an S3 key for use as a relative URL path
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,213 @@
+package http
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/go2chef"
+)
+
+var indexFiles = []string{
+	"chef-17.9.59-1.el8.x86_64.rpm",
+	"chef-17.10.3-1.el8.x86_64.rpm",
+	"chef-17.10.3-1.el7.x86_64.rpm",
+	"chef-17.10.0-1.el8.x86_64.rpm",
+}
+
+// indexServer serves indexFiles (with their names as content) under
+// /files/, along with HTML, JSON and paginated S3 listings of them
+func indexServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		if r.URL.Path == "/files/" {
+			_, _ = fmt.Fprint(w, `<html><body><a href="?C=N;O=D">Name</a><a href="../">Parent</a><a href="subdir/">subdir/</a>`)
+			for _, f := range indexFiles {
+				_, _ = fmt.Fprintf(w, `<a href='%s'>%s</a>`, f, f)
+			}
+			return
+		}
+		if name == "SHA256SUMS" {
+			for _, f := range indexFiles {
+				sum := sha256.Sum256([]byte(f))
+				_, _ = fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(sum[:]), f)
+			}
+			return
+		}
+		_, _ = fmt.Fprint(w, name)
+	})
+	mux.HandleFunc("/listing.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `["%s", {"name": "%s", "url": "/files/%s"}, {"href": "files/%s"}]`,
+			"files-are-relative", indexFiles[1], indexFiles[1], indexFiles[0])
+	})
+	mux.HandleFunc("/bucket/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, path.Base(r.URL.Path))
+	})
+	mux.HandleFunc("/bucket", func(w http.ResponseWriter, r *http.Request) {
+		// one key per page
+		i := 0
+		if m := r.URL.Query().Get("marker"); m != "" {
+			for j, f := range indexFiles {
+				if "files/"+f == m {
+					i = j + 1
+				}
+			}
+		}
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <IsTruncated>%t</IsTruncated>
+  <Contents><Key>files/%s</Key></Contents>
+</ListBucketResult>`, i < len(indexFiles)-1, indexFiles[i])
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSource_DownloadToPathIndex(t *testing.T) {
+	ts := indexServer()
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		url     string
+		pattern string
+		scheme  string
+		want    string
+	}{
+		{"/files/", `chef-(?P<version>[\d.]+)-\d+\.el8\.x86_64\.rpm`, "semver", indexFiles[1]},
+		{"/files/", `chef-([\d.]+-\d+)\.el7\.x86_64\.rpm`, "rpm", indexFiles[2]},
+		{"/listing.json", `chef-(.*)\.el8\.x86_64\.rpm`, "rpm", indexFiles[1]},
+		{"/bucket?prefix=files/", `chef-(.*)\.el8\.x86_64\.rpm`, "deb", indexFiles[1]},
+	} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		s, err := go2chef.GetSource(TypeName, map[string]interface{}{
+			"type":         TypeName,
+			"url":          ts.URL + tc.url,
+			"index":        map[string]interface{}{"pattern": tc.pattern, "version_scheme": tc.scheme},
+			"checksum_url": ts.URL + "/files/SHA256SUMS",
+		})
+		if err != nil {
+			t.Fatalf("failed to initialize source: %s", err)
+		}
+		if err := s.DownloadToPath(dir); err != nil {
+			t.Errorf("%s: failed to download: %s", tc.url, err)
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, tc.want))
+		if err != nil || string(data) != tc.want {
+			t.Errorf("%s: expected %s to be downloaded: %q, %v", tc.url, tc.want, data, err)
+		}
+	}
+}
+
+func TestSource_DownloadToPathIndexNoMatch(t *testing.T) {
+	ts := indexServer()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := Loader(map[string]interface{}{
+		"url":   ts.URL + "/files/",
+		"index": map[string]interface{}{"pattern": `cinc-.*\.rpm`},
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize source: %s", err)
+	}
+	if err := s.DownloadToPath(dir); err == nil || !strings.Contains(err.Error(), "no entries") {
+		t.Errorf("expected no matching entries to fail, got %v", err)
+	}
+}
+
+func TestSource_DownloadToPathIndexCrossHostAuth(t *testing.T) {
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-Token") != "" {
+			leaked = append(leaked, r.URL.Path)
+		}
+		_, _ = fmt.Fprint(w, path.Base(r.URL.Path))
+	}))
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" || r.Header.Get("X-Token") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `[{"name": "%s", "url": "%s/files/%s"}]`, indexFiles[1], other.URL, indexFiles[1])
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := Loader(map[string]interface{}{
+		"url":          ts.URL + "/listing.json",
+		"index":        map[string]interface{}{"pattern": `chef-(.*)\.el8\.x86_64\.rpm`, "version_scheme": "rpm"},
+		"headers":      map[string]interface{}{"X-Token": "s3cret"},
+		"bearer_token": "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize source: %s", err)
+	}
+	if err := s.DownloadToPath(dir); err != nil {
+		t.Fatalf("failed to download: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, indexFiles[1])); err != nil {
+		t.Errorf("expected %s to be downloaded: %s", indexFiles[1], err)
+	}
+	if len(leaked) > 0 {
+		t.Errorf("credentials sent to a host linked from the index: %v", leaked)
+	}
+}
+
+func TestIndex_latest(t *testing.T) {
+	i := &Index{Pattern: `chef-(.*)\.tar\.gz`}
+	if err := i.validate(); err != nil {
+		t.Fatalf("failed to validate index: %s", err)
+	}
+	var skipped []string
+	best := i.latest([]indexEntry{
+		{name: "chef-17.9.0.tar.gz"},
+		{name: "chef-latest.tar.gz"},
+		{name: "chef-17.10.0-rc.1.tar.gz"},
+		{name: "chef-17.10.0.tar.gz"},
+		{name: "README"},
+	}, func(e indexEntry, err error) { skipped = append(skipped, e.name) })
+	if best == nil || best.name != "chef-17.10.0.tar.gz" || best.version != "17.10.0" {
+		t.Errorf("unexpected latest entry %+v", best)
+	}
+	if len(skipped) != 1 || skipped[0] != "chef-latest.tar.gz" {
+		t.Errorf("unexpected skipped entries %v", skipped)
+	}
+
+	for _, cfg := range []map[string]interface{}{
+		{},
+		{"pattern": "("},
+		{"pattern": ".*", "version_scheme": "calver"},
+		{"pattern": ".*", "format": "xml"},
+	} {
+		if _, err := Loader(map[string]interface{}{"url": "http://example.com/", "index": cfg}); err == nil {
+			t.Errorf("expected index %v to fail to load", cfg)
+		}
+	}
+}
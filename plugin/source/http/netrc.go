@@ -0,0 +1,95 @@
+package http
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// netrcEntry holds the credentials for a single netrc machine
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// defaultNetrcPath returns $NETRC, or ~/.netrc (~/_netrc on Windows)
+func defaultNetrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// readNetrc parses a netrc file into entries keyed by machine name. The
+// `default` entry, if any, is keyed by the empty string. Macro definitions
+// are skipped.
+func readNetrc(path string) (map[string]netrcEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]netrcEntry)
+
+	var (
+		machine string
+		entry   netrcEntry
+		inEntry bool
+	)
+	flush := func() {
+		if inEntry {
+			if _, ok := entries[machine]; !ok {
+				entries[machine] = entry
+			}
+		}
+		entry, inEntry = netrcEntry{}, false
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+			switch fields[j] {
+			case "machine":
+				flush()
+				machine, inEntry = next(), true
+			case "default":
+				flush()
+				machine, inEntry = "", true
+			case "login":
+				entry.login = next()
+			case "password":
+				entry.password = next()
+			case "account":
+				next()
+			case "macdef":
+				// macro bodies run until the next blank line
+				flush()
+				for i++; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				}
+				j = len(fields)
+			}
+		}
+	}
+	flush()
+	return entries, nil
+}
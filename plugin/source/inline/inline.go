@@ -0,0 +1,217 @@
+package inline
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/facts"
+	"github.com/facebookincubator/go2chef/plugin/lib/outfile"
+	"github.com/mitchellh/mapstructure"
+)
+
+// TypeName is the name of this source plugin
+const TypeName = "go2chef.source.inline"
+
+// defaultMode is the file mode files are written with
+const defaultMode = 0644
+
+// File is a single file written by the inline source. At most one of
+// Content, Base64 and Template may be set; with none, the file is empty.
+type File struct {
+	Filename string `mapstructure:"filename"`
+	Content  string `mapstructure:"content"`
+	Base64   string `mapstructure:"base64"`
+	// Template is a Go text/template rendered with `.Vars` (the source's
+	// vars merged with the file's) and `.Facts` (see plugin/lib/facts)
+	Template string                 `mapstructure:"template"`
+	Vars     map[string]interface{} `mapstructure:"vars"`
+	// Mode is the octal file mode, i.e. "0600"
+	Mode string `mapstructure:"mode"`
+
+	data []byte
+	mode os.FileMode
+	tmpl *template.Template
+}
+
+// templateData is the data templates are rendered with
+type templateData struct {
+	Vars  map[string]interface{}
+	Facts *facts.Facts
+}
+
+// templateFuncs are available to templates in addition to the builtins
+var templateFuncs = template.FuncMap{
+	"env":   os.Getenv,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"join":  strings.Join,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// Source implements a source which writes content given in its
+// configuration, so small files don't need to be hosted anywhere.
+type Source struct {
+	logger go2chef.Logger
+
+	SourceName string `mapstructure:"name"`
+	// Vars are available to all file templates
+	Vars  map[string]interface{} `mapstructure:"vars"`
+	Files []*File                `mapstructure:"files"`
+
+	// a single file may be configured at the top level instead of in Files
+	File `mapstructure:",squash"`
+}
+
+func (s *Source) String() string {
+	return "<" + TypeName + ":" + s.SourceName + ">"
+}
+
+// Name returns the name of this source instance
+func (s *Source) Name() string {
+	return s.SourceName
+}
+
+// Type returns the type of this source
+func (s *Source) Type() string {
+	return TypeName
+}
+
+// SetName sets the name of this source instance
+func (s *Source) SetName(name string) {
+	s.SourceName = name
+}
+
+// DownloadToPath renders and writes the configured files to dlPath
+func (s *Source) DownloadToPath(dlPath string) error {
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		return err
+	}
+	for _, f := range s.Files {
+		data := f.data
+		if f.Template != "" {
+			var err error
+			if data, err = s.render(f); err != nil {
+				return err
+			}
+		}
+
+		outpath, err := outfile.Path(dlPath, f.Filename)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s.Name(), err)
+		}
+		if err := outfile.Write(outpath, data, f.mode, ""); err != nil {
+			return err
+		}
+		s.logger.Debugf(1, "%s: wrote %s", s.Name(), outpath)
+	}
+	return nil
+}
+
+// render executes a file's template
+func (s *Source) render(f *File) ([]byte, error) {
+	vars := make(map[string]interface{}, len(s.Vars)+len(f.Vars))
+	for k, v := range s.Vars {
+		vars[k] = v
+	}
+	for k, v := range f.Vars {
+		vars[k] = v
+	}
+	buf := &bytes.Buffer{}
+	if err := f.tmpl.Execute(buf, templateData{Vars: vars, Facts: facts.Get()}); err != nil {
+		return nil, fmt.Errorf("%s: %s", s.Name(), err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Loader provides an instantiation function for this source
+func Loader(config map[string]interface{}) (go2chef.Source, error) {
+	s := &Source{
+		logger:     go2chef.GetGlobalLogger(),
+		SourceName: "",
+	}
+	if err := mapstructure.Decode(config, s); err != nil {
+		return nil, err
+	}
+	if s.SourceName == "" {
+		s.SourceName = TypeName
+	}
+	if s.Filename != "" {
+		top := s.File
+		s.Files = append([]*File{&top}, s.Files...)
+	}
+	if len(s.Files) == 0 {
+		return nil, errors.New(TypeName + ": at least one file is required")
+	}
+
+	seen := make(map[string]bool, len(s.Files))
+	for i, f := range s.Files {
+		if f.Filename == "" {
+			return nil, fmt.Errorf("%s: file %d has no filename", TypeName, i)
+		}
+		if seen[f.Filename] {
+			return nil, fmt.Errorf("%s: duplicate filename %s", TypeName, f.Filename)
+		}
+		seen[f.Filename] = true
+
+		set := 0
+		for _, v := range []string{f.Content, f.Base64, f.Template} {
+			if v != "" {
+				set++
+			}
+		}
+		if set > 1 {
+			return nil, fmt.Errorf("%s: %s: only one of content, base64 and template may be set", TypeName, f.Filename)
+		}
+		f.data = []byte(f.Content)
+		if f.Base64 != "" {
+			data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(f.Base64), ""))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: invalid base64: %s", TypeName, f.Filename, err)
+			}
+			f.data = data
+		}
+		if f.Template != "" {
+			// missing keys are errors rather than rendering "<no value>"
+			tmpl, err := template.New(f.Filename).Funcs(templateFuncs).Option("missingkey=error").Parse(f.Template)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", TypeName, err)
+			}
+			f.tmpl = tmpl
+		}
+
+		mode, err := outfile.ParseMode(f.Mode, defaultMode)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", TypeName, f.Filename, err)
+		}
+		f.mode = mode
+	}
+	return s, nil
+}
+
+var _ go2chef.Source = &Source{}
+var _ go2chef.SourceLoader = Loader
+
+func init() {
+	go2chef.RegisterSource(TypeName, Loader)
+}
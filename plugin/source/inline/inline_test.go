@@ -0,0 +1,92 @@
+package inline
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/facebookincubator/go2chef/plugin/lib/facts"
+)
+
+func TestSource_DownloadToPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Loader(map[string]interface{}{
+		"filename": "client.rb",
+		"template": `chef_server_url "{{ .Vars.server }}"` + "\n" + `node_name "{{ .Facts.Hostname }}"` + "\n",
+		"vars":     map[string]interface{}{"server": "https://chef.example.com"},
+		"files": []interface{}{
+			map[string]interface{}{"filename": "first-boot.json", "content": `{"run_list": []}`},
+			map[string]interface{}{"filename": "keys/ca.pem", "base64": "Q0EgQlVO\nRExF", "mode": "0600"},
+			map[string]interface{}{
+				"filename": "attrs.json",
+				"template": `{{ json .Vars }}`,
+				"vars":     map[string]interface{}{"tier": "web"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to load source: %s", err)
+	}
+	if err := s.DownloadToPath(dir); err != nil {
+		t.Fatalf("download failed: %s", err)
+	}
+
+	for fn, want := range map[string]string{
+		"client.rb":       "chef_server_url \"https://chef.example.com\"\nnode_name \"" + facts.Get().Hostname + "\"\n",
+		"first-boot.json": `{"run_list": []}`,
+		"keys/ca.pem":     "CA BUNDLE",
+		"attrs.json":      `{"server":"https://chef.example.com","tier":"web"}`,
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, fn))
+		if err != nil {
+			t.Errorf("failed to read %s: %s", fn, err)
+		} else if string(data) != want {
+			t.Errorf("unexpected content in %s: %q", fn, data)
+		}
+	}
+	if st, err := os.Stat(filepath.Join(dir, "keys", "ca.pem")); err != nil || st.Mode().Perm() != 0600 {
+		t.Errorf("unexpected mode for ca.pem: %v %v", st, err)
+	}
+}
+
+func TestSource_DownloadToPathMissingVar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Loader(map[string]interface{}{"filename": "a", "template": "{{ .Vars.missing }}"})
+	if err != nil {
+		t.Fatalf("failed to load source: %s", err)
+	}
+	if err := s.DownloadToPath(dir); err == nil {
+		t.Errorf("expected missing template variable to fail")
+	}
+}
+
+func TestLoader(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{},
+		{"content": "no filename"},
+		{"filename": "a", "content": "x", "base64": "eA=="},
+		{"filename": "a", "base64": "!!"},
+		{"filename": "a", "template": "{{ .Vars.x "},
+		{"filename": "a", "content": "x", "mode": "rw"},
+		{"filename": "a", "files": []interface{}{map[string]interface{}{"filename": "a"}}},
+	} {
+		if _, err := Loader(config); err == nil {
+			t.Errorf("expected config %v to fail to load", config)
+		}
+	}
+}
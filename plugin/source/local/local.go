@@ -5,11 +5,15 @@ package local
 */
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
-
-	"github.com/mholt/archiver/v3"
+	"path/filepath"
 
 	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/archive"
+	"github.com/facebookincubator/go2chef/plugin/lib/signature"
+	"github.com/facebookincubator/go2chef/util/temp"
 	"github.com/mitchellh/mapstructure"
 	"github.com/otiai10/copy"
 )
@@ -27,6 +31,13 @@ type Source struct {
 	SourceName string `mapstructure:"name"`
 	Path       string `mapstructure:"path"`
 	Archive    bool   `mapstructure:"archive"`
+
+	archive.Options `mapstructure:",squash"`
+
+	checksums go2chef.ChecksumVerifiers
+
+	Signature map[string]interface{} `mapstructure:"signature"`
+	verifier  *signature.Verifier
 }
 
 func (s *Source) String() string {
@@ -50,7 +61,8 @@ func (s *Source) SetName(name string) {
 
 // DownloadToPath performs the actual copy of files to the working directory.
 // We copy rather than just setting downloadPath to avoid side effects from
-// steps affecting the original source location.
+// steps affecting the original source location. Checksums and signatures
+// are verified against the copy, so the file used is the file checked.
 func (s *Source) DownloadToPath(dlPath string) error {
 
 	if err := os.MkdirAll(dlPath, 0755); err != nil {
@@ -58,14 +70,50 @@ func (s *Source) DownloadToPath(dlPath string) error {
 	}
 	s.logger.Debugf(0, "copy directory %s is ready", dlPath)
 
+	st, err := os.Stat(s.Path)
+	if err != nil {
+		return err
+	}
+	verify := len(s.checksums) > 0 || s.verifier != nil
+	if verify && st.IsDir() {
+		return fmt.Errorf("%s: `checksum` and `signature` can't verify directory %s, use `checksums` instead", s.Name(), s.Path)
+	}
+
 	if !s.Archive {
-		if err := copy.Copy(s.Path, dlPath); err != nil {
-			s.logger.Errorf("failed to copy directory %s to %s", s.Path, dlPath)
+		dest := dlPath
+		if !st.IsDir() {
+			// single files are copied into the directory, not over it
+			dest = filepath.Join(dlPath, filepath.Base(s.Path))
+		}
+		if err := copy.Copy(s.Path, dest); err != nil {
+			s.logger.Errorf("failed to copy %s to %s", s.Path, dest)
 			return err
 		}
-		s.logger.Debugf(0, "copied directory %s to %s", s.Path, dlPath)
+		if verify {
+			if err := s.verify(dest); err != nil {
+				_ = os.Remove(dest)
+				return err
+			}
+		}
+		s.logger.Debugf(0, "copied %s to %s", s.Path, dest)
 	} else {
-		if err := archiver.Unarchive(s.Path, dlPath); err != nil {
+		src := s.Path
+		if verify {
+			// keep the name, which may determine the archive format
+			tmpdir, err := temp.Dir("", "go2chef-src-local-")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = temp.Remove(tmpdir) }()
+			src = filepath.Join(tmpdir, filepath.Base(s.Path))
+			if err := copy.Copy(s.Path, src); err != nil {
+				return err
+			}
+			if err := s.verify(src); err != nil {
+				return err
+			}
+		}
+		if err := s.Extract(src, dlPath); err != nil {
 			s.logger.Errorf("failed to unarchive %s to dir %s", s.Path, dlPath)
 			return err
 		}
@@ -74,6 +122,29 @@ func (s *Source) DownloadToPath(dlPath string) error {
 	return nil
 }
 
+// AddChecksumVerifier adds a verifier run against the copied file before
+// it's used or extracted
+func (s *Source) AddChecksumVerifier(v go2chef.ChecksumVerifier) {
+	s.checksums = append(s.checksums, v)
+}
+
+// verify checks a copy of the source file at path against the configured
+// checksums and signature. Only single files can be verified this way;
+// directories need `checksums`.
+func (s *Source) verify(path string) error {
+	if err := s.checksums.VerifyChecksum(filepath.Base(s.Path), path); err != nil {
+		return err
+	}
+	if s.verifier == nil {
+		return nil
+	}
+	sig, err := ioutil.ReadFile(s.verifier.SignatureLocation(s.Path))
+	if err != nil {
+		return err
+	}
+	return s.verifier.Verify(s, path, sig)
+}
+
 // Loader provides an instantiation function for this source
 func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	s := &Source{
@@ -86,10 +157,18 @@ func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	if s.SourceName == "" {
 		s.SourceName = TypeName
 	}
+	if err := s.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	verifier, err := signature.Load(s.Signature)
+	if err != nil {
+		return nil, err
+	}
+	s.verifier = verifier
 	return s, nil
 }
 
-var _ go2chef.Source = &Source{}
+var _ go2chef.ChecksumSource = &Source{}
 var _ go2chef.SourceLoader = Loader
 
 func init() {
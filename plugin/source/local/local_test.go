@@ -0,0 +1,106 @@
+package local
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/facebookincubator/go2chef"
+)
+
+func TestSource_DownloadToPath(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(src)
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatalf("failed to create source directory: %s", err)
+	}
+	for _, fn := range []string{"chef.rpm", "sub/client.rb"} {
+		if err := ioutil.WriteFile(filepath.Join(src, fn), []byte(fn), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", fn, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		// directories are copied as the download directory's contents
+		{src, []string{"chef.rpm", "sub/client.rb"}},
+		// single files are copied into it under their own name
+		{filepath.Join(src, "chef.rpm"), []string{"chef.rpm"}},
+		{filepath.Join(src, "sub", "client.rb"), []string{"client.rb"}},
+	} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		s, err := Loader(map[string]interface{}{"path": tc.path})
+		if err != nil {
+			t.Fatalf("failed to load source: %s", err)
+		}
+		if err := s.DownloadToPath(filepath.Join(dir, "out")); err != nil {
+			t.Errorf("%s: failed to download: %s", tc.path, err)
+			continue
+		}
+		for _, fn := range tc.want {
+			if _, err := os.Stat(filepath.Join(dir, "out", fn)); err != nil {
+				t.Errorf("%s: expected %s to be copied: %s", tc.path, fn, err)
+			}
+		}
+	}
+}
+
+func TestSource_DownloadToPathChecksum(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(src)
+	fn := filepath.Join(src, "chef.rpm")
+	if err := ioutil.WriteFile(fn, []byte("chef"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", fn, err)
+	}
+	sum := sha256.Sum256([]byte("chef"))
+	other := sha256.Sum256([]byte("cinc"))
+
+	for want, checksum := range map[bool]string{
+		true:  "sha256:" + hex.EncodeToString(sum[:]),
+		false: "sha256:" + hex.EncodeToString(other[:]),
+	} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		s, err := go2chef.GetSource(TypeName, map[string]interface{}{
+			"type":     TypeName,
+			"path":     fn,
+			"checksum": checksum,
+		})
+		if err != nil {
+			t.Fatalf("failed to load source: %s", err)
+		}
+		err = s.DownloadToPath(dir)
+		if want && err != nil {
+			t.Errorf("failed to download with a matching checksum: %s", err)
+		} else if !want && err == nil {
+			t.Errorf("expected a mismatched checksum to fail")
+		}
+		if _, err := os.Stat(filepath.Join(dir, "chef.rpm")); (err == nil) != want {
+			t.Errorf("checksum valid = %t, but copied file exists = %t", want, err == nil)
+		}
+	}
+}
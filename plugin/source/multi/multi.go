@@ -5,28 +5,47 @@ package multi
 */
 
 import (
-	"io/ioutil"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/util/temp"
 	"github.com/mitchellh/mapstructure"
-	"github.com/otiai10/copy"
 )
 
 // TypeName is the name of this source plugin
 const TypeName = "go2chef.source.multi"
 
-// Source implements a multi filesystem source plugin that
-// copies files from a directory on multi filesystem to temp
-// for use. Paths are relative to the current working directory
-// of the go2chef process.
+// Conflict policies for files provided by more than one source
+const (
+	ConflictError     = "error"
+	ConflictOverwrite = "overwrite"
+	ConflictSkip      = "skip"
+)
+
+// Source implements a multi source plugin that fetches several
+// sources and merges their contents into one download path. Each
+// source spec may set `dest`, a subdirectory of the download path
+// to place that source's files in.
 type Source struct {
 	logger go2chef.Logger
 
 	SourceName string `mapstructure:"name"`
 
 	SourceSpecs []map[string]interface{} `mapstructure:"sources"`
-	sources     []go2chef.Source         `mapstructure:","`
+	// Parallelism is the maximum number of sources fetched at once
+	Parallelism int `mapstructure:"parallelism"`
+	// OnConflict decides what happens when a file is provided by more than
+	// one source: "error", "overwrite" (later sources win) or "skip"
+	// (earlier sources win)
+	OnConflict string `mapstructure:"on_conflict"`
+
+	sources []go2chef.Source `mapstructure:","`
+	dests   []string         `mapstructure:","`
 }
 
 func (s *Source) String() string {
@@ -48,34 +67,169 @@ func (s *Source) SetName(name string) {
 	s.SourceName = name
 }
 
-// DownloadToPath fetches multiple source defs in order
+// DownloadToPath fetches all sources to their own temp directories, up to
+// Parallelism at a time, then merges them into dlPath in the order they're
+// configured so the result doesn't depend on which finished first.
 func (s *Source) DownloadToPath(dlPath string) error {
 	if err := os.MkdirAll(dlPath, 0755); err != nil {
 		return err
 	}
+
+	dirs := make([]string, len(s.sources))
+	errs := make([]error, len(s.sources))
+	defer func() {
+		for _, d := range dirs {
+			if d != "" {
+				_ = temp.Remove(d)
+			}
+		}
+	}()
+
+	sem := make(chan struct{}, s.Parallelism)
+	wg := sync.WaitGroup{}
 	for i, src := range s.sources {
-		thisDl, err := ioutil.TempDir("", "go2chef-multi-")
+		dir, err := temp.Dir("", "go2chef-multi-")
 		if err != nil {
+			errs[i] = err
+			break
+		}
+		dirs[i] = dir
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, src go2chef.Source, dir string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := src.DownloadToPath(dir); err != nil {
+				s.logger.Errorf("failed to download source %d (%s) to %s", i, src.Name(), dir)
+				errs[i] = err
+			}
+		}(i, src, dir)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, dir := range dirs {
+		if err := s.merge(dir, dlPath, s.dests[i]); err != nil {
+			s.logger.Errorf("failed to merge source %d (%s) into %s", i, s.sources[i].Name(), filepath.Join(dlPath, s.dests[i]))
+			return err
+		}
+	}
+	return nil
+}
+
+// merge copies the tree at from into dest under root, applying the
+// conflict policy to files which already exist. Symlinks from earlier
+// sources are never followed, so they can't redirect files outside root.
+func (s *Source) merge(from, root, dest string) error {
+	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.Join(dest, rel)
+		target := filepath.Join(root, rel)
+		if info.IsDir() {
+			if err := s.checkSymlinks(root, rel); err != nil {
+				return err
+			}
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		if err := s.checkSymlinks(root, filepath.Dir(rel)); err != nil {
 			return err
 		}
-		if err := src.DownloadToPath(thisDl); err != nil {
-			s.logger.Errorf("failed to download source %d to %s", i, thisDl)
+
+		if existing, err := os.Lstat(target); err == nil {
+			if existing.IsDir() {
+				return fmt.Errorf("%s: %s is a directory in an earlier source", s.Name(), rel)
+			}
+			switch s.OnConflict {
+			case ConflictSkip:
+				s.logger.Debugf(1, "%s: keeping existing %s", s.Name(), target)
+				return nil
+			case ConflictOverwrite:
+				s.logger.Debugf(1, "%s: overwriting %s", s.Name(), target)
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("%s: %s is provided by more than one source", s.Name(), target)
+			}
+		} else if !os.IsNotExist(err) {
 			return err
 		}
-		if err := copy.Copy(thisDl, dlPath); err != nil {
-			s.logger.Errorf("failed to copy directory %s to %s", thisDl, dlPath)
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+// checkSymlinks walks the components of rel under root with Lstat, failing
+// if any existing one is a symlink
+func (s *Source) checkSymlinks(root, rel string) error {
+	cur := root
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		if elem == "" || elem == "." {
+			continue
+		}
+		cur = filepath.Join(cur, elem)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
 			return err
 		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: %s is a symlink in an earlier source", s.Name(), cur)
+		}
 	}
 	return nil
 }
 
+func copyFile(from, to string, mode os.FileMode) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// OpenFile's mode is subject to the umask
+	return os.Chmod(to, mode)
+}
+
 // Loader provides an instantiation function for this source
 func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	s := &Source{
 		logger:      go2chef.GetGlobalLogger(),
 		SourceName:  "",
 		SourceSpecs: []map[string]interface{}{},
+		Parallelism: 1,
+		OnConflict:  ConflictError,
 	}
 	if err := mapstructure.Decode(config, s); err != nil {
 		return nil, err
@@ -83,17 +237,43 @@ func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	if s.SourceName == "" {
 		s.SourceName = TypeName
 	}
+	if s.Parallelism < 1 {
+		return nil, fmt.Errorf("%s: parallelism must be at least 1", TypeName)
+	}
+	switch s.OnConflict {
+	case ConflictError, ConflictOverwrite, ConflictSkip:
+	default:
+		return nil, fmt.Errorf("%s: unknown on_conflict policy %q", TypeName, s.OnConflict)
+	}
+
+	for i, spec := range s.SourceSpecs {
+		// `dest` belongs to this source, not the child
+		child := make(map[string]interface{}, len(spec))
+		for k, v := range spec {
+			child[k] = v
+		}
+		dest := ""
+		if d, ok := child["dest"]; ok {
+			if dest, ok = d.(string); !ok {
+				return nil, fmt.Errorf("%s: source %d: dest must be a string", TypeName, i)
+			}
+			delete(child, "dest")
+		}
+		dest = filepath.Clean(filepath.FromSlash(dest))
+		if filepath.IsAbs(dest) || dest == ".." || strings.HasPrefix(dest, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s: source %d: dest %q must be within the download path", TypeName, i, dest)
+		}
 
-	for _, spec := range s.SourceSpecs {
-		stype, err := go2chef.GetType(spec)
+		stype, err := go2chef.GetType(child)
 		if err != nil {
 			return nil, err
 		}
-		src, err := go2chef.GetSource(stype, spec)
+		src, err := go2chef.GetSource(stype, child)
 		if err != nil {
 			return nil, err
 		}
 		s.sources = append(s.sources, src)
+		s.dests = append(s.dests, dest)
 	}
 
 	return s, nil
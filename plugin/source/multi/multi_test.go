@@ -0,0 +1,146 @@
+package multi
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/facebookincubator/go2chef/plugin/source/inline"
+)
+
+func inline(filename, content string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "go2chef.source.inline",
+		"filename": filename,
+		"content":  content,
+	}
+}
+
+func download(t *testing.T, config map[string]interface{}) (string, error) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	s, err := Loader(config)
+	if err != nil {
+		t.Fatalf("failed to load source: %s", err)
+	}
+	return dir, s.DownloadToPath(dir)
+}
+
+func readFile(t *testing.T, fn string) string {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Errorf("failed to read %s: %s", fn, err)
+	}
+	return string(data)
+}
+
+func TestSource_DownloadToPath(t *testing.T) {
+	cookbooks := inline("metadata.rb", "name 'base'")
+	cookbooks["dest"] = "cookbooks/base"
+
+	dir, err := download(t, map[string]interface{}{
+		"parallelism": 4,
+		"sources": []interface{}{
+			inline("chefctl.rb", "one"),
+			cookbooks,
+			inline("client.rb", "three"),
+		},
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("download failed: %s", err)
+	}
+	for fn, want := range map[string]string{
+		"chefctl.rb":                 "one",
+		"cookbooks/base/metadata.rb": "name 'base'",
+		"client.rb":                  "three",
+	} {
+		if c := readFile(t, filepath.Join(dir, fn)); c != want {
+			t.Errorf("unexpected content in %s: %q", fn, c)
+		}
+	}
+}
+
+func TestSource_DownloadToPathConflict(t *testing.T) {
+	for policy, want := range map[string]string{
+		ConflictOverwrite: "second",
+		ConflictSkip:      "first",
+		ConflictError:     "",
+	} {
+		dir, err := download(t, map[string]interface{}{
+			"on_conflict": policy,
+			"sources":     []interface{}{inline("client.rb", "first"), inline("client.rb", "second")},
+		})
+		defer os.RemoveAll(dir)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s: expected conflicting files to fail", policy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: download failed: %s", policy, err)
+		}
+		if c := readFile(t, filepath.Join(dir, "client.rb")); c != want {
+			t.Errorf("%s: unexpected content %q", policy, c)
+		}
+	}
+}
+
+func TestSource_mergeSymlinkParent(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(root)
+	for _, d := range []string{"dl", "outside", "first", "second/link"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatalf("failed to create %s: %s", d, err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "outside"), filepath.Join(root, "first", "link")); err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "second", "link", "file"), []byte("escaped"), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	s := &Source{SourceName: TypeName, OnConflict: ConflictOverwrite}
+	dl := filepath.Join(root, "dl")
+	if err := s.merge(filepath.Join(root, "first"), dl, "."); err != nil {
+		t.Fatalf("failed to merge first source: %s", err)
+	}
+	for _, dest := range []string{".", "link"} {
+		from := filepath.Join(root, "second")
+		if dest == "link" {
+			from = filepath.Join(from, "link")
+		}
+		if err := s.merge(from, dl, dest); err == nil {
+			t.Errorf("dest %s: expected merging through a symlink to fail", dest)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "outside", "file")); !os.IsNotExist(err) {
+		t.Errorf("file was written through the symlink: %v", err)
+	}
+}
+
+func TestLoader(t *testing.T) {
+	escape := inline("a", "")
+	escape["dest"] = "../outside"
+	for _, config := range []map[string]interface{}{
+		{"parallelism": 0},
+		{"on_conflict": "merge"},
+		{"sources": []interface{}{escape}},
+	} {
+		if _, err := Loader(config); err == nil {
+			t.Errorf("expected config %v to fail to load", config)
+		}
+	}
+}
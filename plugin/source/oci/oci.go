@@ -0,0 +1,604 @@
+package oci
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/archive"
+	"github.com/facebookincubator/go2chef/plugin/lib/cache"
+	"github.com/facebookincubator/go2chef/plugin/lib/secret"
+	"github.com/facebookincubator/go2chef/util"
+	"github.com/facebookincubator/go2chef/util/temp"
+	"github.com/mitchellh/mapstructure"
+)
+
+// TypeName is the name of this source plugin
+const TypeName = "go2chef.source.oci"
+
+// Manifest and layer media types
+const (
+	MediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// annotationTitle names the file a layer was pushed from
+	annotationTitle = "org.opencontainers.image.title"
+	// maxManifestSize bounds how much of a manifest response is read
+	maxManifestSize = 4 << 20
+)
+
+var digestRegex = regexp.MustCompile(`^(sha256:[0-9a-f]{64}|sha512:[0-9a-f]{128})$`)
+
+var manifestAccept = strings.Join([]string{MediaTypeOCIManifest, MediaTypeOCIIndex, MediaTypeDockerManifest, MediaTypeDockerList}, ", ")
+
+// Source implements an OCI distribution registry source which downloads
+// the layers of an artifact or image manifest
+type Source struct {
+	logger go2chef.Logger
+
+	SourceName string `mapstructure:"name"`
+	// Reference is the artifact to pull, i.e. `registry.example.com/chef/cookbooks:1.0`
+	// or `registry.example.com/chef/cookbooks@sha256:…`
+	Reference string `mapstructure:"reference"`
+	// MediaTypes selects which layers to download; all if empty
+	MediaTypes []string `mapstructure:"media_types"`
+	// Platform selects a manifest from an image index, as `os/arch[/variant]`
+	Platform string `mapstructure:"platform"`
+	// Archive extracts tar layers into the download path
+	Archive   bool `mapstructure:"archive"`
+	PlainHTTP bool `mapstructure:"plain_http"`
+	// Options controls extraction; the format comes from each layer's
+	// media type
+	archive.Options `mapstructure:",squash"`
+
+	Username interface{} `mapstructure:"username"`
+	Password interface{} `mapstructure:"password"`
+	Token    interface{} `mapstructure:"token"`
+
+	ref    *reference
+	client *http.Client
+	auth   registryAuth
+}
+
+// registryAuth holds resolved credentials and the negotiated authorization
+type registryAuth struct {
+	username string
+	password string
+	// authorization is the Authorization header value to send, once known
+	authorization string
+}
+
+// descriptor describes a manifest or layer
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant,omitempty"`
+	} `json:"platform,omitempty"`
+}
+
+// manifest is an image manifest or index
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+func (s *Source) String() string {
+	return "<" + TypeName + ":" + s.SourceName + ">"
+}
+
+// Name returns the name of this source instance
+func (s *Source) Name() string {
+	return s.SourceName
+}
+
+// Type returns the type of this source
+func (s *Source) Type() string {
+	return TypeName
+}
+
+// SetName sets the name of this source instance
+func (s *Source) SetName(name string) {
+	s.SourceName = name
+}
+
+// DownloadToPath pulls the selected layers of the referenced manifest into
+// dlPath, verifying every digest along the way
+func (s *Source) DownloadToPath(dlPath string) (err error) {
+	s.logger.WriteEvent(go2chef.NewEvent("OCI_PULL_STARTED", TypeName, s.ref.String()))
+	defer func() {
+		event := "OCI_PULL_COMPLETE"
+		if err != nil {
+			event = "OCI_PULL_FAILURE"
+		}
+		s.logger.WriteEvent(go2chef.NewEvent(event, TypeName, s.ref.String()))
+	}()
+
+	if s.client, err = go2chef.HTTPClient(); err != nil {
+		return err
+	}
+	if err := s.resolveAuth(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		return err
+	}
+
+	m, err := s.fetchManifest(s.ref.manifestRef())
+	if err != nil {
+		return err
+	}
+	if len(m.Manifests) > 0 {
+		d, err := s.selectPlatform(m.Manifests)
+		if err != nil {
+			return err
+		}
+		if err := validateDigest(d.Digest); err != nil {
+			return err
+		}
+		if m, err = s.fetchManifest(d.Digest); err != nil {
+			return err
+		}
+	}
+
+	layers := s.selectLayers(m.Layers)
+	if len(layers) == 0 {
+		return fmt.Errorf("%s: no layers of %s match media types %v", s.Name(), s.ref, s.MediaTypes)
+	}
+	for _, l := range layers {
+		if err := s.pullLayer(l, dlPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchManifest fetches and verifies a manifest by tag or digest
+func (s *Source) fetchManifest(ref string) (*manifest, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url("manifests", ref), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", manifestAccept)
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// a manifest requested by digest must match it; one requested by tag
+	// is checked against the digest the registry claims for it
+	want := resp.Header.Get("Docker-Content-Digest")
+	if strings.Contains(ref, ":") {
+		want = ref
+	}
+	if want != "" {
+		if err := verifyDigest(want, body); err != nil {
+			return nil, fmt.Errorf("manifest %s: %s", ref, err)
+		}
+	}
+
+	m := &manifest{}
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, fmt.Errorf("manifest %s: %s", ref, err)
+	}
+	s.logger.Debugf(1, "%s: fetched manifest %s (%s)", s.Name(), ref, m.MediaType)
+	return m, nil
+}
+
+// selectPlatform picks the manifest for the configured platform from an index
+func (s *Source) selectPlatform(manifests []descriptor) (*descriptor, error) {
+	parts := strings.SplitN(s.Platform, "/", 3)
+	for i := range manifests {
+		p := manifests[i].Platform
+		if p == nil || p.OS != parts[0] || (len(parts) > 1 && p.Architecture != parts[1]) {
+			continue
+		}
+		if len(parts) > 2 && p.Variant != parts[2] {
+			continue
+		}
+		return &manifests[i], nil
+	}
+	return nil, fmt.Errorf("%s: %s has no manifest for platform %s", s.Name(), s.ref, s.Platform)
+}
+
+// selectLayers filters layers by the configured media types
+func (s *Source) selectLayers(layers []descriptor) []descriptor {
+	if len(s.MediaTypes) == 0 {
+		return layers
+	}
+	var selected []descriptor
+	for _, l := range layers {
+		for _, mt := range s.MediaTypes {
+			if l.MediaType == mt {
+				selected = append(selected, l)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// pullLayer downloads and verifies a layer blob, then extracts it (tar
+// layers in archive mode) or moves it into dlPath
+func (s *Source) pullLayer(l descriptor, dlPath string) error {
+	tmpfile, err := temp.File("", "go2chef-src-oci-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tmpfile.Close() }()
+
+	// the digest names the blob URL, cache entry and possibly the file
+	if err := validateDigest(l.Digest); err != nil {
+		return err
+	}
+	key := strings.Replace(l.Digest, ":", "-", 1)
+	if cache.Global != nil {
+		if _, err := cache.Global.CopyTo(key, tmpfile); err == nil {
+			s.logger.Debugf(1, "%s: using cached layer %s", s.Name(), l.Digest)
+		} else if err := s.downloadBlob(l, tmpfile); err != nil {
+			return err
+		}
+	} else if err := s.downloadBlob(l, tmpfile); err != nil {
+		return err
+	}
+	if err := tmpfile.Close(); err != nil {
+		return err
+	}
+	if err := verifyFileDigest(l.Digest, l.Size, tmpfile.Name()); err != nil {
+		return fmt.Errorf("layer %s: %s", l.Digest, err)
+	}
+	if cache.Global != nil {
+		if err := cache.Global.Put(key, tmpfile.Name(), cache.Meta{Source: s.ref.String(), Filename: layerFilename(l)}); err != nil {
+			s.logger.Errorf("%s: failed to cache layer %s: %s", s.Name(), l.Digest, err)
+		}
+	}
+
+	if s.Archive {
+		if format := tarFormat(l.MediaType); format != "" {
+			s.logger.Debugf(1, "%s: extracting layer %s to %s", s.Name(), l.Digest, dlPath)
+			opts := s.Options
+			opts.Format = format
+			return opts.Extract(tmpfile.Name(), dlPath)
+		}
+	}
+	out := filepath.Join(dlPath, layerFilename(l))
+	s.logger.Debugf(1, "%s: saving layer %s as %s", s.Name(), l.Digest, out)
+	return util.MoveFile(tmpfile.Name(), out)
+}
+
+// downloadBlob fetches a blob into f
+func (s *Source) downloadBlob(l descriptor, f *os.File) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, s.url("blobs", l.Digest), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// read at most one byte past the declared size so oversized blobs
+	// fail verification without being downloaded in full
+	n, err := io.Copy(f, io.LimitReader(resp.Body, l.Size+1))
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf(1, "%s: downloaded layer %s (%d bytes)", s.Name(), l.Digest, n)
+	return nil
+}
+
+// do sends a registry request, negotiating authorization from the
+// registry's challenge on the first 401
+func (s *Source) do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if s.auth.authorization != "" {
+			req.Header.Set("Authorization", s.auth.authorization)
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			_ = resp.Body.Close()
+			if err := s.authorize(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("GET %s returned %d %s", req.URL, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		return resp, nil
+	}
+}
+
+// authorize answers a WWW-Authenticate challenge, fetching a bearer token
+// from the registry's token service if required
+func (s *Source) authorize(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if s.auth.username == "" {
+			return fmt.Errorf("%s: registry %s requires credentials", s.Name(), s.ref.Registry)
+		}
+		req := &http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(s.auth.username, s.auth.password)
+		s.auth.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("%s: unsupported registry auth challenge %q", s.Name(), challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("%s: invalid token realm in challenge %q", s.Name(), challenge)
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + s.ref.Repository + ":pull"
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if s.auth.username != "" {
+		req.SetBasicAuth(s.auth.username, s.auth.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: token request to %s returned %d %s", s.Name(), realm.Host, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	tok := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return err
+	}
+	if tok.Token == "" {
+		tok.Token = tok.AccessToken
+	}
+	if tok.Token == "" {
+		return fmt.Errorf("%s: token service %s returned no token", s.Name(), realm.Host)
+	}
+	go2chef.RegisterRedaction(tok.Token)
+	s.auth.authorization = "Bearer " + tok.Token
+	return nil
+}
+
+// resolveAuth resolves configured credentials. A configured token is used
+// as a bearer token up front; username/password are used for basic auth or
+// to obtain a token when the registry asks for one.
+func (s *Source) resolveAuth() error {
+	var err error
+	if s.Token != nil {
+		tok, err := secret.Resolve(s.Token)
+		if err != nil {
+			return fmt.Errorf("%s: token: %s", s.Name(), err)
+		}
+		s.auth.authorization = "Bearer " + tok
+	}
+	if s.Username != nil {
+		if s.auth.username, err = secret.Resolve(s.Username); err != nil {
+			return fmt.Errorf("%s: username: %s", s.Name(), err)
+		}
+	}
+	if s.Password != nil {
+		if s.auth.password, err = secret.Resolve(s.Password); err != nil {
+			return fmt.Errorf("%s: password: %s", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+// url returns a registry API URL
+func (s *Source) url(kind, ref string) string {
+	scheme := "https"
+	if s.PlainHTTP {
+		scheme = "http"
+	}
+	return scheme + "://" + s.ref.Registry + "/v2/" + s.ref.Repository + "/" + kind + "/" + ref
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example.com/token",service="registry"`
+func parseChallenge(h string) (string, map[string]string) {
+	params := make(map[string]string)
+	h = strings.TrimSpace(h)
+	sp := strings.IndexByte(h, ' ')
+	if sp < 0 {
+		return strings.ToLower(h), params
+	}
+	scheme, rest := strings.ToLower(h[:sp]), h[sp+1:]
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				break
+			}
+			val, rest = rest[1:end+1], rest[end+2:]
+		} else if comma := strings.IndexByte(rest, ','); comma >= 0 {
+			val, rest = rest[:comma], rest[comma:]
+		} else {
+			val, rest = rest, ""
+		}
+		params[key] = val
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return scheme, params
+}
+
+// validateDigest checks that digest is a well-formed sha256 or sha512
+// digest, and so is safe to use in URLs and file names
+func validateDigest(digest string) error {
+	if !digestRegex.MatchString(digest) {
+		return fmt.Errorf("invalid digest %q", digest)
+	}
+	return nil
+}
+
+// newDigester returns a hash for an `algorithm:hex` digest
+func newDigester(digest string) (hash.Hash, string, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return nil, "", fmt.Errorf("invalid digest %q", digest)
+	}
+	switch parts[0] {
+	case "sha256":
+		return sha256.New(), parts[1], nil
+	case "sha512":
+		return sha512.New(), parts[1], nil
+	}
+	return nil, "", fmt.Errorf("unsupported digest algorithm in %q", digest)
+}
+
+func verifyDigest(digest string, data []byte) error {
+	h, want, err := newDigester(digest)
+	if err != nil {
+		return err
+	}
+	h.Write(data)
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", want, got)
+	}
+	return nil
+}
+
+func verifyFileDigest(digest string, size int64, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h, want, err := newDigester(digest)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("size mismatch: expected %d bytes, got %d", size, n)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", want, got)
+	}
+	return nil
+}
+
+// layerFilename returns the name to save a layer as: its title annotation
+// if it has a safe one, else its (validated) digest
+func layerFilename(l descriptor) string {
+	if title := filepath.Base(filepath.Clean(l.Annotations[annotationTitle])); title != "" && title != "." && title != ".." && title != string(filepath.Separator) {
+		return title
+	}
+	return strings.Replace(l.Digest, ":", "-", 1)
+}
+
+// tarFormat returns the archive format of tar layer media types, or ""
+func tarFormat(mediaType string) string {
+	switch {
+	case strings.HasSuffix(mediaType, "tar+gzip"), strings.HasSuffix(mediaType, "tar.gzip"):
+		return "tar.gz"
+	case strings.HasSuffix(mediaType, "tar+zstd"):
+		return "tar.zst"
+	case strings.HasSuffix(mediaType, "tar"):
+		return "tar"
+	}
+	return ""
+}
+
+// Loader provides an instantiation function for this source
+func Loader(config map[string]interface{}) (go2chef.Source, error) {
+	s := &Source{
+		logger:     go2chef.GetGlobalLogger(),
+		SourceName: "",
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if err := mapstructure.Decode(config, s); err != nil {
+		return nil, err
+	}
+	if s.SourceName == "" {
+		s.SourceName = TypeName
+	}
+	if s.Reference == "" {
+		return nil, errors.New(TypeName + ": reference is required")
+	}
+	if s.Format != "" {
+		return nil, errors.New(TypeName + ": archive_format can't be set, it comes from layer media types")
+	}
+	if err := s.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	ref, err := parseReference(s.Reference)
+	if err != nil {
+		return nil, err
+	}
+	s.ref = ref
+	return s, nil
+}
+
+var _ go2chef.Source = &Source{}
+var _ go2chef.SourceLoader = Loader
+
+func init() {
+	go2chef.RegisterSource(TypeName, Loader)
+}
@@ -0,0 +1,239 @@
+package oci
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func digestOf(data []byte) string {
+	h := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// testRegistry is a minimal OCI distribution registry requiring bearer
+// tokens obtained with basic auth
+type testRegistry struct {
+	*httptest.Server
+	manifests map[string][]byte
+	blobs     map[string][]byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		if u, p, ok := req.BasicAuth(); !ok || u != "puller" || p != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") != "repository:chef/cookbooks:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "tok"})
+	})
+	mux.HandleFunc("/v2/chef/cookbooks/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer tok" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:chef/cookbooks:pull"`, r.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		parts := strings.Split(req.URL.Path, "/")
+		kind, ref := parts[len(parts)-2], parts[len(parts)-1]
+		switch kind {
+		case "manifests":
+			m, ok := r.manifests[ref]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digestOf(m))
+			_, _ = w.Write(m)
+		case "blobs":
+			b, ok := r.blobs[ref]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(b)
+		}
+	})
+	r.Server = httptest.NewServer(mux)
+	return r
+}
+
+func (r *testRegistry) push(tag string, m interface{}) string {
+	data, _ := json.Marshal(m)
+	r.manifests[tag] = data
+	r.manifests[digestOf(data)] = data
+	return digestOf(data)
+}
+
+func (r *testRegistry) blob(data []byte, mediaType, title string) descriptor {
+	r.blobs[digestOf(data)] = data
+	d := descriptor{MediaType: mediaType, Digest: digestOf(data), Size: int64(len(data))}
+	if title != "" {
+		d.Annotations = map[string]string{annotationTitle: title}
+	}
+	return d
+}
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("failed to write tar header: %s", err)
+		}
+		_, _ = tw.Write([]byte(content))
+	}
+	_ = tw.Close()
+	return buf.Bytes()
+}
+
+func pull(t *testing.T, config map[string]interface{}) (string, error) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	config["plain_http"] = true
+	config["username"] = "puller"
+	config["password"] = "hunter2"
+	s, err := Loader(config)
+	if err != nil {
+		t.Fatalf("failed to load source: %s", err)
+	}
+	return dir, s.DownloadToPath(dir)
+}
+
+func TestSource_DownloadToPath(t *testing.T) {
+	reg := newTestRegistry(t)
+	defer reg.Close()
+	host := strings.TrimPrefix(reg.URL, "http://")
+
+	cfg := reg.blob([]byte(`{}`), "application/vnd.oci.image.config.v1+json", "")
+	rpm := reg.blob([]byte("rpm contents"), "application/vnd.example.rpm", "chef-18.0.0.rpm")
+	cookbooks := reg.blob(tarball(t, map[string]string{"cookbooks/base/metadata.rb": "name 'base'\n"}), "application/vnd.oci.image.layer.v1.tar", "")
+	digest := reg.push("1.0", map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     MediaTypeOCIManifest,
+		"config":        cfg,
+		"layers":        []descriptor{rpm, cookbooks},
+	})
+	reg.push("multi", map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     MediaTypeOCIIndex,
+		"manifests": []map[string]interface{}{
+			{"mediaType": MediaTypeOCIManifest, "digest": digest, "size": 1, "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+		},
+	})
+	corrupt := reg.blob([]byte("original"), "application/vnd.example.rpm", "corrupt.rpm")
+	reg.blobs[corrupt.Digest] = []byte("tampered")
+	reg.push("corrupt", map[string]interface{}{"schemaVersion": 2, "mediaType": MediaTypeOCIManifest, "layers": []descriptor{corrupt}})
+
+	t.Run("tag with archive", func(t *testing.T) {
+		dir, err := pull(t, map[string]interface{}{"reference": host + "/chef/cookbooks:1.0", "archive": true})
+		defer os.RemoveAll(dir)
+		if err != nil {
+			t.Fatalf("pull failed: %s", err)
+		}
+		for _, fn := range []string{"chef-18.0.0.rpm", "cookbooks/base/metadata.rb"} {
+			if _, err := os.Stat(filepath.Join(dir, fn)); err != nil {
+				t.Errorf("expected %s to be pulled: %s", fn, err)
+			}
+		}
+	})
+	t.Run("digest with media type", func(t *testing.T) {
+		dir, err := pull(t, map[string]interface{}{
+			"reference":   host + "/chef/cookbooks@" + digest,
+			"media_types": []string{"application/vnd.example.rpm"},
+		})
+		defer os.RemoveAll(dir)
+		if err != nil {
+			t.Fatalf("pull failed: %s", err)
+		}
+		entries, _ := ioutil.ReadDir(dir)
+		if len(entries) != 1 || entries[0].Name() != "chef-18.0.0.rpm" {
+			t.Errorf("expected only the rpm layer, got %v", entries)
+		}
+	})
+	t.Run("index", func(t *testing.T) {
+		dir, err := pull(t, map[string]interface{}{"reference": host + "/chef/cookbooks:multi", "platform": "linux/arm64"})
+		defer os.RemoveAll(dir)
+		if err != nil {
+			t.Fatalf("pull failed: %s", err)
+		}
+		dir, err = pull(t, map[string]interface{}{"reference": host + "/chef/cookbooks:multi", "platform": "windows/amd64"})
+		defer os.RemoveAll(dir)
+		if err == nil {
+			t.Errorf("expected pull for a missing platform to fail")
+		}
+	})
+	t.Run("corrupt layer", func(t *testing.T) {
+		dir, err := pull(t, map[string]interface{}{"reference": host + "/chef/cookbooks:corrupt"})
+		defer os.RemoveAll(dir)
+		if err == nil || !strings.Contains(err.Error(), "mismatch") {
+			t.Errorf("expected digest mismatch, got %v", err)
+		}
+	})
+}
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	for in, exp := range map[string]string{
+		"alpine":                                    "registry-1.docker.io/library/alpine:latest",
+		"example/cookbooks:1.0":                     "registry-1.docker.io/example/cookbooks:1.0",
+		"localhost:5000/chef/cookbooks":             "localhost:5000/chef/cookbooks:latest",
+		"ghcr.io/org/chef@" + digest:                "ghcr.io/org/chef@" + digest,
+		"registry.example.com:443/a/b:v2@" + digest: "registry.example.com:443/a/b:v2@" + digest,
+	} {
+		r, err := parseReference(in)
+		if err != nil {
+			t.Errorf("failed to parse %s: %s", in, err)
+		} else if r.String() != exp {
+			t.Errorf("parseReference(%s) = %s, expected %s", in, r, exp)
+		}
+	}
+	if _, err := parseReference("ghcr.io/org/chef@sha256:abcd"); err == nil {
+		t.Errorf("expected short digest to fail")
+	}
+}
+
+func TestValidateDigest(t *testing.T) {
+	for digest, valid := range map[string]bool{
+		"sha256:" + strings.Repeat("0f", 32): true,
+		"sha512:" + strings.Repeat("0f", 64): true,
+		"sha256:" + strings.Repeat("0F", 32): false,
+		"sha256:" + strings.Repeat("0f", 31): false,
+		"sha512:" + strings.Repeat("0f", 32): false,
+		"sha256:../../etc/passwd":            false,
+		"md5:" + strings.Repeat("0f", 16):    false,
+		"":                                   false,
+	} {
+		if err := validateDigest(digest); (err == nil) != valid {
+			t.Errorf("validateDigest(%q) = %v, expected valid = %t", digest, err, valid)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull,push"`)
+	if scheme != "bearer" || params["realm"] != "https://auth.example.com/token" || params["scope"] != "repository:a/b:pull,push" || params["service"] != "registry.example.com" {
+		t.Errorf("unexpected challenge parse: %s %v", scheme, params)
+	}
+}
@@ -0,0 +1,81 @@
+package oci
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// reference is a parsed image reference:
+// `[registry/]repository[:tag][@digest]`
+type reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseReference parses an image reference. References without a registry
+// host refer to Docker Hub, and those without a tag or digest to `latest`.
+func parseReference(ref string) (*reference, error) {
+	r := &reference{}
+	name := ref
+	if at := strings.Index(name, "@"); at >= 0 {
+		name, r.Digest = name[:at], name[at+1:]
+		if validateDigest(r.Digest) != nil {
+			return nil, fmt.Errorf("invalid digest in reference %q", ref)
+		}
+	}
+	// a colon after the last slash separates the tag; earlier ones are ports
+	if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+		name, r.Tag = name[:colon], name[colon+1:]
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		r.Registry, r.Repository = parts[0], parts[1]
+	} else {
+		r.Registry, r.Repository = dockerHubDomain, name
+	}
+	if r.Registry == dockerHubDomain {
+		r.Registry = dockerHubRegistry
+		if !strings.Contains(r.Repository, "/") {
+			r.Repository = "library/" + r.Repository
+		}
+	}
+	if r.Repository == "" {
+		return nil, fmt.Errorf("invalid reference %q", ref)
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+// manifestRef returns the tag or digest to request the manifest by,
+// preferring the digest
+func (r *reference) manifestRef() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r *reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
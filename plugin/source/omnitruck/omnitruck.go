@@ -0,0 +1,330 @@
+package omnitruck
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/facts"
+	"github.com/facebookincubator/go2chef/plugin/lib/transfer"
+	// the package is downloaded with the HTTP source
+	httpsource "github.com/facebookincubator/go2chef/plugin/source/http"
+	"github.com/facebookincubator/go2chef/util/version"
+	"github.com/mitchellh/mapstructure"
+)
+
+// TypeName is the name of this source plugin
+const TypeName = "go2chef.source.omnitruck"
+
+const (
+	// DefaultEndpoint is Chef's public omnitruck API
+	DefaultEndpoint = "https://omnitruck.chef.io"
+	// maxResponseSize bounds how much of an API response is read
+	maxResponseSize = 4 << 20
+)
+
+// Source implements a source which resolves a Chef (or Cinc) package from
+// an omnitruck-style metadata API and downloads it, verified against the
+// sha256 the API returns.
+type Source struct {
+	logger go2chef.Logger
+
+	SourceName string `mapstructure:"name"`
+	// Endpoint is the omnitruck API base URL, i.e. an internal mirror or
+	// https://omnitruck.cinc.sh
+	Endpoint string `mapstructure:"endpoint"`
+	Product  string `mapstructure:"product"`
+	Channel  string `mapstructure:"channel"`
+	// Version is "latest", a (possibly partial) version such as "17.10",
+	// or a constraint such as "~> 17.10" or ">= 17, < 18"
+	Version string `mapstructure:"version"`
+	// Platform, PlatformVersion and Arch select the package, and are
+	// filled in from the host's facts if unset
+	Platform        string `mapstructure:"platform"`
+	PlatformVersion string `mapstructure:"platform_version"`
+	Arch            string `mapstructure:"arch"`
+
+	// these are passed through to the HTTP source which downloads the
+	// package
+	transfer.Limit        `mapstructure:",squash"`
+	Retries               int `mapstructure:"retries"`
+	RetryDelaySeconds     int `mapstructure:"retry_delay_seconds"`
+	ConnectTimeoutSeconds int `mapstructure:"connect_timeout_seconds"`
+	ReadTimeoutSeconds    int `mapstructure:"read_timeout_seconds"`
+
+	constraint *version.Constraint
+}
+
+// metadata is an omnitruck package metadata response
+type metadata struct {
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+	Version string `json:"version"`
+}
+
+func (s *Source) String() string {
+	return "<" + TypeName + ":" + s.SourceName + ">"
+}
+
+// Name returns the name of this source instance
+func (s *Source) Name() string {
+	return s.SourceName
+}
+
+// Type returns the type of this source
+func (s *Source) Type() string {
+	return TypeName
+}
+
+// SetName sets the name of this source instance
+func (s *Source) SetName(name string) {
+	s.SourceName = name
+}
+
+// DownloadToPath resolves the package's metadata and downloads it to dlPath
+func (s *Source) DownloadToPath(dlPath string) (err error) {
+	desc := fmt.Sprintf("%s %s %s %s/%s/%s", s.Product, s.Channel, s.Version, s.Platform, s.PlatformVersion, s.Arch)
+	s.logger.WriteEvent(go2chef.NewEvent("OMNITRUCK_RESOLVE_STARTED", TypeName, desc))
+	md, err := s.resolve()
+	if err != nil {
+		s.logger.WriteEvent(go2chef.NewEvent("OMNITRUCK_RESOLVE_FAILURE", TypeName, desc))
+		return err
+	}
+	s.logger.WriteEvent(go2chef.NewEvent("OMNITRUCK_RESOLVE_COMPLETE", TypeName, fmt.Sprintf("%s %s", md.Version, md.URL)))
+
+	src, err := go2chef.GetSource(httpsource.TypeName, map[string]interface{}{
+		"type":                    httpsource.TypeName,
+		"name":                    s.SourceName,
+		"url":                     md.URL,
+		"sha256":                  md.SHA256,
+		"rate_limit":              s.RateLimit,
+		"retries":                 s.Retries,
+		"retry_delay_seconds":     s.RetryDelaySeconds,
+		"connect_timeout_seconds": s.ConnectTimeoutSeconds,
+		"read_timeout_seconds":    s.ReadTimeoutSeconds,
+	})
+	if err != nil {
+		return err
+	}
+	return src.DownloadToPath(dlPath)
+}
+
+// resolve finds the package metadata, first picking the latest version
+// from the API's version list if a constraint was given
+func (s *Source) resolve() (*metadata, error) {
+	c, err := go2chef.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	v := s.Version
+	if s.constraint != nil {
+		var versions []string
+		if err := s.get(c, s.url("versions/all", nil), &versions); err != nil {
+			return nil, fmt.Errorf("%s: failed to list %s versions: %s", s.Name(), s.Product, err)
+		}
+		if v = s.constraint.Latest(versions); v == "" {
+			return nil, fmt.Errorf("%s: no %s version in channel %s satisfies %q", s.Name(), s.Product, s.Channel, s.Version)
+		}
+		s.logger.Debugf(1, "%s: resolved %q to %s", s.Name(), s.Version, v)
+	}
+
+	md := &metadata{}
+	q := url.Values{
+		"v":  {v},
+		"p":  {s.Platform},
+		"pv": {s.PlatformVersion},
+		"m":  {s.Arch},
+	}
+	if err := s.get(c, s.url("metadata", q), md); err != nil {
+		return nil, fmt.Errorf("%s: failed to fetch %s metadata: %s", s.Name(), s.Product, err)
+	}
+	if md.URL == "" {
+		return nil, fmt.Errorf("%s: metadata has no package url", s.Name())
+	}
+	// the sha256 is the only integrity check, so it's mandatory
+	if len(md.SHA256) != 64 {
+		return nil, fmt.Errorf("%s: metadata has no valid sha256 for %s", s.Name(), md.URL)
+	}
+	return md, nil
+}
+
+// url builds an API URL for the configured channel and product
+func (s *Source) url(endpoint string, q url.Values) string {
+	u := strings.TrimRight(s.Endpoint, "/") + "/" + url.PathEscape(s.Channel) + "/" + url.PathEscape(s.Product) + "/" + endpoint
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// get fetches an API resource into out. JSON is requested, but metadata in
+// omnitruck's plain text `key<TAB>value` format is understood too.
+func (s *Source) get(c *http.Client, u string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err == nil {
+		return nil
+	}
+	md, ok := out.(*metadata)
+	if !ok {
+		return errors.New("response is not valid JSON")
+	}
+	return parseTextMetadata(body, md)
+}
+
+// parseTextMetadata parses omnitruck's plain text metadata format
+func parseTextMetadata(body []byte, md *metadata) error {
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "url":
+			md.URL = fields[1]
+		case "sha256":
+			md.SHA256 = fields[1]
+		case "version":
+			md.Version = fields[1]
+		}
+	}
+	if md.URL == "" {
+		return errors.New("response is neither JSON nor text metadata")
+	}
+	return nil
+}
+
+// Platform maps host facts to omnitruck's platform and platform version
+// names, i.e. "el" and "8" for Rocky Linux 8.9
+func Platform(f *facts.Facts) (string, string) {
+	major := strings.SplitN(f.PlatformVersion, ".", 2)[0]
+	switch {
+	case f.Platform == "ubuntu":
+		return "ubuntu", f.PlatformVersion
+	case f.Platform == "debian":
+		return "debian", major
+	case f.Platform == "amzn":
+		return "amazon", major
+	case f.Platform == "fedora":
+		// checked before the EL family, which all list fedora in ID_LIKE
+		return "fedora", major
+	case f.Platform == "mac_os_x":
+		// macOS 11 and later are versioned by major release alone
+		if major == "10" {
+			parts := strings.SplitN(f.PlatformVersion, ".", 3)
+			if len(parts) > 1 {
+				return "mac_os_x", parts[0] + "." + parts[1]
+			}
+		}
+		return "mac_os_x", major
+	case f.Platform == "windows":
+		return "windows", windowsVersion(f.PlatformVersion)
+	case f.IsLike("rhel", "centos", "fedora"):
+		return "el", major
+	case f.IsLike("suse", "sles", "opensuse"):
+		return "sles", major
+	}
+	return f.Platform, major
+}
+
+// windowsVersion maps a Windows kernel version to the server release name
+// omnitruck expects
+func windowsVersion(v string) string {
+	switch {
+	case strings.HasPrefix(v, "6.1"):
+		return "2008r2"
+	case strings.HasPrefix(v, "6.2"):
+		return "2012"
+	case strings.HasPrefix(v, "6.3"):
+		return "2012r2"
+	}
+	return "2016"
+}
+
+// Loader implements SourceLoader for plugin registration
+func Loader(config map[string]interface{}) (go2chef.Source, error) {
+	s := &Source{
+		logger:                go2chef.GetGlobalLogger(),
+		Endpoint:              DefaultEndpoint,
+		Product:               "chef",
+		Channel:               "stable",
+		Version:               "latest",
+		Retries:               go2chef.HTTP.Retries,
+		RetryDelaySeconds:     go2chef.HTTP.RetryDelaySeconds,
+		ConnectTimeoutSeconds: go2chef.HTTP.ConnectTimeoutSeconds,
+		ReadTimeoutSeconds:    go2chef.HTTP.ReadTimeoutSeconds,
+	}
+	if err := mapstructure.Decode(config, s); err != nil {
+		return nil, err
+	}
+	if s.SourceName == "" {
+		s.SourceName = TypeName
+	}
+	if err := s.Limit.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	if _, err := url.Parse(s.Endpoint); err != nil {
+		return nil, fmt.Errorf("%s: invalid endpoint: %s", TypeName, err)
+	}
+	if version.IsConstraint(s.Version) {
+		c, err := version.ParseConstraint(s.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", TypeName, err)
+		}
+		s.constraint = c
+	}
+
+	if s.Platform == "" || s.PlatformVersion == "" {
+		p, pv := Platform(facts.Get())
+		if s.Platform == "" {
+			s.Platform = p
+		}
+		if s.PlatformVersion == "" {
+			s.PlatformVersion = pv
+		}
+	}
+	if s.Arch == "" {
+		s.Arch = facts.Get().Machine
+	}
+	// accept Go architecture names too
+	s.Arch = facts.Machine(s.Arch)
+	if s.Platform == "" || s.PlatformVersion == "" {
+		return nil, fmt.Errorf("%s: couldn't detect the platform, set platform and platform_version", TypeName)
+	}
+	return s, nil
+}
+
+var _ go2chef.Source = &Source{}
+var _ go2chef.SourceLoader = Loader
+
+func init() {
+	go2chef.RegisterSource(TypeName, Loader)
+}
@@ -0,0 +1,212 @@
+package omnitruck
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/facebookincubator/go2chef/plugin/lib/facts"
+)
+
+// omnitruckServer fakes the omnitruck API for the stable chef channel. The
+// package content is its filename; if corrupt is set the advertised sha256
+// doesn't match.
+func omnitruckServer(corrupt bool) *httptest.Server {
+	var ts *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stable/chef/versions/all", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]string{"17.9.59", "17.10.3", "18.0.185"})
+	})
+	mux.HandleFunc("/stable/chef/metadata", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("p") != "el" || q.Get("pv") != "8" || q.Get("m") != "x86_64" {
+			http.Error(w, "unknown platform", http.StatusNotFound)
+			return
+		}
+		v := q.Get("v")
+		if v == "latest" {
+			v = "18.0.185"
+		}
+		name := fmt.Sprintf("chef-%s-1.el8.x86_64.rpm", v)
+		sum := sha256.Sum256([]byte(name))
+		if corrupt {
+			sum[0]++
+		}
+		md := map[string]string{"url": ts.URL + "/files/" + name, "sha256": hex.EncodeToString(sum[:]), "version": v}
+		if r.Header.Get("Accept") != "application/json" {
+			for k, v := range md {
+				_, _ = fmt.Fprintf(w, "%s\t%s\n", k, v)
+			}
+			return
+		}
+		_ = json.NewEncoder(w).Encode(md)
+	})
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, filepath.Base(r.URL.Path))
+	})
+	ts = httptest.NewServer(mux)
+	return ts
+}
+
+func TestSource_DownloadToPath(t *testing.T) {
+	ts := omnitruckServer(false)
+	defer ts.Close()
+
+	for version, want := range map[string]string{
+		"latest":     "chef-18.0.185-1.el8.x86_64.rpm",
+		"17.9.59":    "chef-17.9.59-1.el8.x86_64.rpm",
+		"~> 17.9":    "chef-17.10.3-1.el8.x86_64.rpm",
+		">= 17, <18": "chef-17.10.3-1.el8.x86_64.rpm",
+	} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		s, err := Loader(map[string]interface{}{
+			"endpoint":         ts.URL + "/",
+			"version":          version,
+			"platform":         "el",
+			"platform_version": "8",
+			"arch":             "amd64",
+		})
+		if err != nil {
+			t.Fatalf("failed to load source: %s", err)
+		}
+		if err := s.DownloadToPath(dir); err != nil {
+			t.Errorf("%s: download failed: %s", version, err)
+			continue
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(dir, want)); err != nil || string(data) != want {
+			t.Errorf("%s: expected %s to be downloaded: %q, %v", version, want, data, err)
+		}
+	}
+}
+
+func TestSource_DownloadToPathFailures(t *testing.T) {
+	corrupt := omnitruckServer(true)
+	defer corrupt.Close()
+	ts := omnitruckServer(false)
+	defer ts.Close()
+
+	for name, config := range map[string]map[string]interface{}{
+		"bad checksum":     {"endpoint": corrupt.URL},
+		"no such version":  {"endpoint": ts.URL, "version": "~> 19"},
+		"unknown platform": {"endpoint": ts.URL, "platform": "solaris2"},
+	} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		config["arch"] = "x86_64"
+		if config["platform"] == nil {
+			config["platform"] = "el"
+		}
+		config["platform_version"] = "8"
+		s, err := Loader(config)
+		if err != nil {
+			t.Fatalf("%s: failed to load source: %s", name, err)
+		}
+		if err := s.DownloadToPath(dir); err == nil {
+			t.Errorf("%s: expected download to fail", name)
+		}
+	}
+
+	if _, err := Loader(map[string]interface{}{"version": ">= banana", "platform": "el", "platform_version": "8"}); err == nil {
+		t.Errorf("expected invalid constraint to fail to load")
+	}
+}
+
+// Test that download options reach the HTTP source
+func TestSource_DownloadToPathHTTPOptions(t *testing.T) {
+	const name = "chef-18.0.185-1.el8.x86_64.rpm"
+	attempts := 0
+	pkg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprint(w, name)
+	}))
+	defer pkg.Close()
+	sum := sha256.Sum256([]byte(name))
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"url": pkg.URL + "/" + name, "sha256": hex.EncodeToString(sum[:])})
+	}))
+	defer api.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	config := map[string]interface{}{
+		"endpoint":            api.URL,
+		"platform":            "el",
+		"platform_version":    "8",
+		"arch":                "x86_64",
+		"retries":             1,
+		"retry_delay_seconds": 0,
+		"rate_limit":          "10MiB",
+	}
+	s, err := Loader(config)
+	if err != nil {
+		t.Fatalf("failed to load source: %s", err)
+	}
+	if err := s.DownloadToPath(dir); err != nil || attempts != 2 {
+		t.Errorf("expected the download to be retried once: %d attempts, %v", attempts, err)
+	}
+
+	config["rate_limit"] = "fast"
+	if _, err := Loader(config); err == nil {
+		t.Errorf("expected invalid rate limit to fail to load")
+	}
+}
+
+func TestParseTextMetadata(t *testing.T) {
+	md := &metadata{}
+	err := parseTextMetadata([]byte("sha1\tabc\nsha256\tdef\nurl\thttps://example.com/chef.rpm\nversion\t17.10.3\n"), md)
+	if err != nil || md.URL != "https://example.com/chef.rpm" || md.SHA256 != "def" || md.Version != "17.10.3" {
+		t.Errorf("unexpected metadata %+v: %v", md, err)
+	}
+	if err := parseTextMetadata([]byte("<html>"), &metadata{}); err == nil {
+		t.Errorf("expected garbage to fail to parse")
+	}
+}
+
+func TestPlatform(t *testing.T) {
+	for _, tc := range []struct {
+		f     facts.Facts
+		p, pv string
+	}{
+		{facts.Facts{Platform: "ubuntu", PlatformVersion: "22.04"}, "ubuntu", "22.04"},
+		{facts.Facts{Platform: "debian", PlatformVersion: "12"}, "debian", "12"},
+		{facts.Facts{Platform: "rocky", PlatformVersion: "8.9", PlatformLike: []string{"rhel", "centos", "fedora"}}, "el", "8"},
+		{facts.Facts{Platform: "rhel", PlatformVersion: "9.3", PlatformLike: []string{"fedora"}}, "el", "9"},
+		{facts.Facts{Platform: "fedora", PlatformVersion: "39"}, "fedora", "39"},
+		{facts.Facts{Platform: "amzn", PlatformVersion: "2", PlatformLike: []string{"centos", "rhel", "fedora"}}, "amazon", "2"},
+		{facts.Facts{Platform: "sles", PlatformVersion: "15.5", PlatformLike: []string{"suse"}}, "sles", "15"},
+		{facts.Facts{Platform: "mac_os_x", PlatformVersion: "10.15.7"}, "mac_os_x", "10.15"},
+		{facts.Facts{Platform: "mac_os_x", PlatformVersion: "13.6.1"}, "mac_os_x", "13"},
+		{facts.Facts{Platform: "windows", PlatformVersion: "6.3.9600"}, "windows", "2012r2"},
+		{facts.Facts{Platform: "windows", PlatformVersion: "10.0.20348.2113"}, "windows", "2016"},
+	} {
+		if p, pv := Platform(&tc.f); p != tc.p || pv != tc.pv {
+			t.Errorf("%s %s: got %s %s, want %s %s", tc.f.Platform, tc.f.PlatformVersion, p, pv, tc.p, tc.pv)
+		}
+	}
+}
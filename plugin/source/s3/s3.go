@@ -5,27 +5,43 @@ package s3
 */
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 
 	"github.com/aws/aws-sdk-go/service/s3"
 
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/facebookincubator/go2chef"
-	"github.com/mholt/archiver/v3"
-	"github.com/mitchellh/mapstructure"
+	"github.com/facebookincubator/go2chef/plugin/lib/archive"
+	"github.com/facebookincubator/go2chef/plugin/lib/cache"
+	"github.com/facebookincubator/go2chef/plugin/lib/signature"
+	"github.com/facebookincubator/go2chef/plugin/lib/transfer"
 	"github.com/facebookincubator/go2chef/util"
+	"github.com/mitchellh/mapstructure"
 )
 
 // TypeName is the name of this source plugin
 const TypeName = "go2chef.source.s3"
 
+// defaultRoleSessionName is used when assuming role_arn without a
+// role_session_name
+const defaultRoleSessionName = "go2chef"
+
 // Source implements an AWS s3 source plugin that copies files
 // from a remote s3 bucket for use.
 type Source struct {
@@ -40,7 +56,29 @@ type Source struct {
 		SecretAccessKey string `mapstructure:"secret_access_key"`
 		Token           string `mapstructure:"token"`
 	}
-	Archive bool `mapstructure:"archive"`
+	Archive         bool `mapstructure:"archive"`
+	archive.Options `mapstructure:",squash"`
+	transfer.Limit  `mapstructure:",squash"`
+
+	// Prefix treats Key as a prefix and downloads every object under it,
+	// preserving paths relative to the prefix
+	Prefix    bool   `mapstructure:"prefix"`
+	VersionID string `mapstructure:"version_id"`
+
+	// Endpoint and ForcePathStyle allow S3-compatible stores (i.e. MinIO)
+	Endpoint       string `mapstructure:"endpoint"`
+	ForcePathStyle bool   `mapstructure:"force_path_style"`
+	// Profile selects a profile from the shared AWS config/credentials files
+	Profile string `mapstructure:"profile"`
+	// RoleARN is assumed using the otherwise-configured credentials
+	RoleARN         string `mapstructure:"role_arn"`
+	RoleSessionName string `mapstructure:"role_session_name"`
+	RoleExternalID  string `mapstructure:"role_external_id"`
+
+	checksums go2chef.ChecksumVerifiers
+
+	Signature map[string]interface{} `mapstructure:"signature"`
+	verifier  *signature.Verifier
 }
 
 func (s *Source) String() string {
@@ -80,20 +118,20 @@ func (s *Source) DownloadToPath(dlPath string) error {
 		- rename temporary file to output file
 		- if archive: decompress to dlPath
 	*/
-	cfg := aws.NewConfig().WithRegion(s.Region)
-	if s.Credentials.AccessKeyID != "" && s.Credentials.SecretAccessKey != "" {
-		cfg = cfg.WithCredentials(
-			credentials.NewStaticCredentials(s.Credentials.AccessKeyID, s.Credentials.SecretAccessKey, ""),
-		)
-	}
-	sess, err := session.NewSession(cfg)
+	svc, err := s.client()
 	if err != nil {
 		s.logger.Debugf(0, "failed to create AWS session: %s", err)
 		return err
 	}
-	dl := s3manager.NewDownloader(sess)
+	dl := s3manager.NewDownloaderWithClient(svc)
+
+	if s.Prefix {
+		if len(s.checksums) > 0 {
+			return fmt.Errorf("%s: `checksum` can't verify a prefix, use `checksums` instead", s.Name())
+		}
+		return s.downloadPrefix(svc, dl, dlPath)
+	}
 
-	outfn := filepath.Join(dlPath, filepath.Base(s.Key))
 	// create tmpfile in dlPath to store S3 contents before Renaming to final location
 	tmpfh, err := ioutil.TempFile(dlPath, "")
 	if err != nil {
@@ -101,25 +139,73 @@ func (s *Source) DownloadToPath(dlPath string) error {
 		return err
 	}
 	defer tmpfh.Close()
-	n, err := dl.Download(tmpfh, &s3.GetObjectInput{
-		Bucket: &s.Bucket,
-		Key:    &s.Key,
-	})
-	if err != nil {
-		s.logger.Debugf(0, "failed to download data from S3: %s", err)
-		return err
+	etag, cached := s.fromCache(svc, tmpfh)
+	if !cached {
+		input := &s3.GetObjectInput{
+			Bucket: &s.Bucket,
+			Key:    &s.Key,
+		}
+		if s.VersionID != "" {
+			input.VersionId = aws.String(s.VersionID)
+		}
+		if etag != "" {
+			// make sure the object we cache is the one the ETag describes
+			input.IfMatch = aws.String(etag)
+		}
+		n, err := s.download(dl, tmpfh, input)
+		if err != nil {
+			s.logger.Debugf(0, "failed to download data from S3: %s", err)
+			return err
+		}
+		s.logger.Debugf(0, "downloaded %d bytes for %s from S3", n, s.location())
 	}
-	s.logger.Debugf(0, "downloaded %d bytes for %s:%s from S3", n, s.Bucket, s.Key)
 	tmpfh.Close()
 
-	if err := util.MoveFile(tmpfh.Name(), outfn); err != nil {
-		s.logger.Errorf("failed to relocate", outfn, dlPath)
+	if err := s.checksums.VerifyChecksum(filepath.Base(s.Key), tmpfh.Name()); err != nil {
+		_ = os.Remove(tmpfh.Name())
+		return err
+	}
+	if s.verifier != nil {
+		sigKey := s.verifier.SignatureLocation(s.Key)
+		sig := aws.NewWriteAtBuffer(nil)
+		if _, err := dl.Download(sig, &s3.GetObjectInput{Bucket: &s.Bucket, Key: &sigKey}); err != nil {
+			_ = os.Remove(tmpfh.Name())
+			s.logger.Debugf(0, "failed to download signature %s from S3: %s", sigKey, err)
+			return err
+		}
+		if err := s.verifier.Verify(s, tmpfh.Name(), sig.Bytes()); err != nil {
+			_ = os.Remove(tmpfh.Name())
+			return err
+		}
+	}
+
+	if !cached {
+		s.cachePut(tmpfh.Name(), etag)
+	}
+	return s.install(tmpfh.Name(), dlPath)
+}
+
+// InstallFile moves or extracts a file fetched earlier, such as from the
+// download cache, into dlPath
+func (s *Source) InstallFile(filename, path, dlPath string) error {
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
 		return err
 	}
+	return s.install(path, dlPath)
+}
 
-	s.logger.Debugf(0, "relocated downloaded file from %s to %s", tmpfh.Name(), outfn)
+// install moves a verified file into dlPath under the key's base name,
+// then extracts it there in archive mode
+func (s *Source) install(tmpPath, dlPath string) error {
+	outfn := filepath.Join(dlPath, filepath.Base(s.Key))
+	if err := util.MoveFile(tmpPath, outfn); err != nil {
+		s.logger.Errorf("failed to relocate %s to %s", tmpPath, outfn)
+		return err
+	}
+
+	s.logger.Debugf(0, "relocated downloaded file from %s to %s", tmpPath, outfn)
 	if s.Archive {
-		if err := archiver.Unarchive(outfn, dlPath); err != nil {
+		if err := s.Extract(outfn, dlPath); err != nil {
 			s.logger.Errorf("failed to unarchive %s to dir %s", outfn, dlPath)
 			return err
 		}
@@ -128,11 +214,204 @@ func (s *Source) DownloadToPath(dlPath string) error {
 	return nil
 }
 
+// downloadPrefix downloads every object under the Key prefix into dlPath
+func (s *Source) downloadPrefix(svc *s3.S3, dl *s3manager.Downloader, dlPath string) error {
+	prefix := strings.TrimSuffix(s.Key, "/") + "/"
+	if s.Key == "" {
+		prefix = ""
+	}
+	count := 0
+	var ferr error
+	err := svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: &s.Bucket,
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+			if strings.HasSuffix(key, "/") {
+				// "directory" placeholder objects
+				continue
+			}
+			rel := path.Clean("/" + strings.TrimPrefix(key, prefix))
+			if rel == "/" {
+				continue
+			}
+			outfn := filepath.Join(dlPath, filepath.FromSlash(rel))
+			if ferr = s.downloadObject(dl, key, outfn); ferr != nil {
+				return false
+			}
+			count++
+		}
+		return true
+	})
+	if err == nil {
+		err = ferr
+	}
+	if err != nil {
+		s.logger.Debugf(0, "failed to download prefix %s from S3: %s", s.location(), err)
+		return err
+	}
+	s.logger.Debugf(0, "downloaded %d objects under %s from S3", count, s.location())
+	return nil
+}
+
+// downloadObject downloads a single object to outfn via a temp file
+func (s *Source) downloadObject(dl *s3manager.Downloader, key, outfn string) error {
+	if err := os.MkdirAll(filepath.Dir(outfn), 0755); err != nil {
+		return err
+	}
+	tmpfh, err := ioutil.TempFile(filepath.Dir(outfn), ".go2chef-s3-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpfh.Name())
+	n, err := s.download(dl, tmpfh, &s3.GetObjectInput{Bucket: &s.Bucket, Key: &key})
+	if cerr := tmpfh.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf(1, "downloaded %d bytes for s3://%s/%s", n, s.Bucket, key)
+	return util.MoveFile(tmpfh.Name(), outfn)
+}
+
+// download fetches an object into w, throttling it and reporting progress.
+// The object's size is learned from the Content-Range of the downloader's
+// ranged GETs.
+func (s *Source) download(dl *s3manager.Downloader, w io.WriterAt, input *s3.GetObjectInput) (int64, error) {
+	location := "s3://" + aws.StringValue(input.Bucket) + "/" + aws.StringValue(input.Key)
+	progress := s.NewProgress(TypeName, location, -1)
+	total := func(r *request.Request) {
+		if r.HTTPResponse == nil {
+			return
+		}
+		cr := r.HTTPResponse.Header.Get("Content-Range")
+		if i := strings.LastIndex(cr, "/"); i >= 0 {
+			if n, err := strconv.ParseInt(cr[i+1:], 10, 64); err == nil {
+				progress.SetTotal(n)
+			}
+		}
+	}
+	return dl.Download(progress.WriterAt(w), input, func(d *s3manager.Downloader) {
+		d.RequestOptions = append(d.RequestOptions, func(r *request.Request) {
+			r.Handlers.Complete.PushBack(total)
+		})
+	})
+}
+
+// client builds an S3 client from the configured credentials, profile,
+// assumed role and endpoint. Without explicit credentials the default AWS
+// credential chain applies.
+func (s *Source) client() (*s3.S3, error) {
+	hc, err := go2chef.HTTPClientForSDK()
+	if err != nil {
+		return nil, err
+	}
+	cfg := aws.NewConfig().WithHTTPClient(hc)
+	if s.Region != "" {
+		cfg = cfg.WithRegion(s.Region)
+	}
+	if s.Credentials.AccessKeyID != "" && s.Credentials.SecretAccessKey != "" {
+		go2chef.RegisterRedaction(s.Credentials.SecretAccessKey)
+		go2chef.RegisterRedaction(s.Credentials.Token)
+		cfg = cfg.WithCredentials(
+			credentials.NewStaticCredentials(s.Credentials.AccessKeyID, s.Credentials.SecretAccessKey, s.Credentials.Token),
+		)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		Profile:           s.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the endpoint only applies to S3, so STS is reached normally
+	s3cfg := aws.NewConfig().WithS3ForcePathStyle(s.ForcePathStyle)
+	if s.Endpoint != "" {
+		s3cfg = s3cfg.WithEndpoint(s.Endpoint)
+	}
+	if s.RoleARN != "" {
+		s3cfg = s3cfg.WithCredentials(stscreds.NewCredentials(sess, s.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = s.RoleSessionName
+			if s.RoleExternalID != "" {
+				p.ExternalID = aws.String(s.RoleExternalID)
+			}
+		}))
+	}
+	return s3.New(sess, s3cfg), nil
+}
+
+// location returns the s3:// URL of the object, used as its cache identity
+func (s *Source) location() string {
+	q := url.Values{}
+	if s.Endpoint != "" {
+		q.Set("endpoint", s.Endpoint)
+	}
+	if s.VersionID != "" {
+		q.Set("versionId", s.VersionID)
+	}
+	u := url.URL{Scheme: "s3", Host: s.Bucket, Path: "/" + s.Key, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// fromCache copies the object from the persistent cache into w if it's
+// there and its ETag is current. The ETag is returned so the download and
+// cache entry can be tied to it. Objects with a known checksum are cached
+// under it by go2chef.GetSource instead.
+func (s *Source) fromCache(svc *s3.S3, w *os.File) (string, bool) {
+	if cache.Global == nil || go2chef.KnownChecksum(s.checksums) != nil {
+		return "", false
+	}
+	input := &s3.HeadObjectInput{Bucket: &s.Bucket, Key: &s.Key}
+	if s.VersionID != "" {
+		input.VersionId = aws.String(s.VersionID)
+	}
+	head, err := svc.HeadObject(input)
+	if err != nil || head.ETag == nil {
+		return "", false
+	}
+	etag, key := *head.ETag, ""
+	if e, ok := cache.Global.Get(cache.URLKey(s.location())); ok && e.ETag == etag {
+		key = e.Key
+	}
+	if key == "" {
+		return etag, false
+	}
+	if _, err := cache.Global.CopyTo(key, w); err != nil {
+		_ = w.Truncate(0)
+		return etag, false
+	}
+	s.logger.Debugf(0, "using cached %s for %s", key, s.location())
+	return etag, true
+}
+
+// cachePut stores a verified download in the persistent cache by location
+// and ETag
+func (s *Source) cachePut(path, etag string) {
+	if cache.Global == nil || etag == "" {
+		return
+	}
+	meta := cache.Meta{Source: s.location(), ETag: etag, Filename: filepath.Base(s.Key)}
+	if err := cache.Global.Put(cache.URLKey(s.location()), path, meta); err != nil {
+		s.logger.Errorf("failed to cache %s: %s", s.location(), err)
+	}
+}
+
+// AddChecksumVerifier adds a verifier run against the downloaded object
+// before it's extracted or moved into place
+func (s *Source) AddChecksumVerifier(v go2chef.ChecksumVerifier) {
+	s.checksums = append(s.checksums, v)
+}
+
 // Loader provides an instantiation function for this source
 func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	s := &Source{
-		logger:     go2chef.GetGlobalLogger(),
-		SourceName: "",
+		logger:          go2chef.GetGlobalLogger(),
+		SourceName:      "",
+		RoleSessionName: defaultRoleSessionName,
 	}
 	if err := mapstructure.Decode(config, s); err != nil {
 		return nil, err
@@ -140,10 +419,28 @@ func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	if s.SourceName == "" {
 		s.SourceName = TypeName
 	}
+	if s.Bucket == "" {
+		return nil, errors.New(TypeName + ": bucket is required")
+	}
+	if err := s.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	if err := s.Limit.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	if s.Prefix && (s.Archive || s.VersionID != "" || s.Signature != nil) {
+		return nil, errors.New(TypeName + ": archive, version_id and signature can't be used with prefix")
+	}
+	verifier, err := signature.Load(s.Signature)
+	if err != nil {
+		return nil, err
+	}
+	s.verifier = verifier
 	return s, nil
 }
 
-var _ go2chef.Source = &Source{}
+var _ go2chef.ChecksumSource = &Source{}
+var _ go2chef.FileInstaller = &Source{}
 var _ go2chef.SourceLoader = Loader
 
 func init() {
@@ -0,0 +1,174 @@
+package s3
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal path-style S3 stand-in serving a single bucket
+type fakeS3 struct {
+	*httptest.Server
+	objects  map[string]string
+	versions map[string]string
+	tokens   []string
+}
+
+func newFakeS3() *fakeS3 {
+	f := &fakeS3{objects: map[string]string{}, versions: map[string]string{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	f.tokens = append(f.tokens, r.Header.Get("X-Amz-Security-Token"))
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != "bucket" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		f.list(w, r.URL.Query().Get("prefix"))
+		return
+	}
+
+	content, ok := f.objects[parts[1]]
+	if v := r.URL.Query().Get("versionId"); v != "" {
+		content, ok = f.versions[parts[1]+"@"+v]
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", `"etag-`+parts[1]+`"`)
+	http.ServeContent(w, r, parts[1], time.Time{}, strings.NewReader(content))
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: "bucket", Prefix: prefix}
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		result.Contents = append(result.Contents, content{Key: k, Size: len(f.objects[k])})
+	}
+	result.KeyCount = len(keys)
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func download(t *testing.T, f *fakeS3, config map[string]interface{}) (string, error) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	config["region"] = "us-east-1"
+	config["bucket"] = "bucket"
+	config["endpoint"] = f.URL
+	config["force_path_style"] = true
+	config["credentials"] = map[string]interface{}{
+		"access_key_id":     "AKIAEXAMPLE",
+		"secret_access_key": "secret",
+		"token":             "session-token",
+	}
+	s, err := Loader(config)
+	if err != nil {
+		t.Fatalf("failed to load source: %s", err)
+	}
+	return dir, s.DownloadToPath(dir)
+}
+
+func readFile(t *testing.T, fn string) string {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Errorf("failed to read %s: %s", fn, err)
+	}
+	return string(data)
+}
+
+func TestSource_DownloadToPath(t *testing.T) {
+	f := newFakeS3()
+	defer f.Close()
+	f.objects["chef/chef.rpm"] = "current"
+	f.versions["chef/chef.rpm@v1"] = "old"
+
+	dir, err := download(t, f, map[string]interface{}{"key": "chef/chef.rpm"})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("download failed: %s", err)
+	}
+	if c := readFile(t, filepath.Join(dir, "chef.rpm")); c != "current" {
+		t.Errorf("unexpected content %q", c)
+	}
+	for _, tok := range f.tokens {
+		if tok != "session-token" {
+			t.Errorf("session token not sent with request: %q", tok)
+		}
+	}
+
+	dir, err = download(t, f, map[string]interface{}{"key": "chef/chef.rpm", "version_id": "v1"})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("versioned download failed: %s", err)
+	}
+	if c := readFile(t, filepath.Join(dir, "chef.rpm")); c != "old" {
+		t.Errorf("unexpected versioned content %q", c)
+	}
+}
+
+func TestSource_DownloadToPathPrefix(t *testing.T) {
+	f := newFakeS3()
+	defer f.Close()
+	f.objects["cookbooks/"] = ""
+	f.objects["cookbooks/base/metadata.rb"] = "name 'base'"
+	f.objects["cookbooks/base/recipes/default.rb"] = "# default"
+	f.objects["cookbooks-other/x"] = "not included"
+
+	dir, err := download(t, f, map[string]interface{}{"key": "cookbooks", "prefix": true})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("prefix download failed: %s", err)
+	}
+	if c := readFile(t, filepath.Join(dir, "base", "recipes", "default.rb")); c != "# default" {
+		t.Errorf("unexpected content %q", c)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x")); err == nil {
+		t.Errorf("object outside the prefix was downloaded")
+	}
+}
+
+func TestLoader(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"key": "a"},
+		{"bucket": "b", "key": "a", "prefix": true, "version_id": "v1"},
+	} {
+		if _, err := Loader(config); err == nil {
+			t.Errorf("expected config %v to fail to load", config)
+		}
+	}
+}
@@ -5,8 +5,9 @@ package secretsmanager
 */
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -14,12 +15,17 @@ import (
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 
 	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/outfile"
+	"github.com/facebookincubator/go2chef/plugin/lib/secret"
 	"github.com/mitchellh/mapstructure"
 )
 
 // TypeName is the name of this source plugin
 const TypeName = "go2chef.source.secretsmanager"
 
+// defaultMode is the file mode secrets are written with
+const defaultMode = 0400
+
 // Source implements an AWS secretsmananger source plugin that
 // copies data stored in AWS secrets mananger into a file.
 type Source struct {
@@ -34,6 +40,22 @@ type Source struct {
 		SecretAccessKey string `mapstructure:"secret_access_key"`
 		Token           string `mapstructure:"token"`
 	}
+
+	// VersionStage and VersionID select a secret version, by default
+	// AWSCURRENT
+	VersionStage string `mapstructure:"version_stage"`
+	VersionID    string `mapstructure:"version_id"`
+	// JSONKey writes only this key of a JSON secret to FileName
+	JSONKey string `mapstructure:"json_key"`
+	// Files maps keys of a JSON secret to the files they're written to
+	Files map[string]string `mapstructure:"files"`
+	// Mode is the octal file mode for written secrets, i.e. "0440"
+	Mode string `mapstructure:"mode"`
+	// Owner is the `user[:group]` (names or IDs) to own written secrets
+	Owner    string `mapstructure:"owner"`
+	Endpoint string `mapstructure:"endpoint"`
+
+	mode os.FileMode
 }
 
 func (s *Source) String() string {
@@ -55,8 +77,8 @@ func (s *Source) SetName(name string) {
 	s.SourceName = name
 }
 
-// DownloadToPath reads the SecretString from secretsmanager and
-// delivers it to the specified file at the download path.
+// DownloadToPath reads the secret from secretsmanager and delivers it, or
+// the selected keys of a JSON secret, to files at the download path.
 func (s *Source) DownloadToPath(dlPath string) error {
 
 	s.logger.Debugf(0, "dlPath is: %s", dlPath)
@@ -65,10 +87,19 @@ func (s *Source) DownloadToPath(dlPath string) error {
 	}
 	s.logger.Debugf(0, "copy directory %s is ready", dlPath)
 
-	cfg := aws.NewConfig().WithRegion(s.Region)
+	client, err := go2chef.HTTPClientForSDK()
+	if err != nil {
+		return err
+	}
+	cfg := aws.NewConfig().WithRegion(s.Region).WithHTTPClient(client)
+	if s.Endpoint != "" {
+		cfg = cfg.WithEndpoint(s.Endpoint)
+	}
 	if s.Credentials.AccessKeyID != "" && s.Credentials.SecretAccessKey != "" {
+		go2chef.RegisterRedaction(s.Credentials.SecretAccessKey)
+		go2chef.RegisterRedaction(s.Credentials.Token)
 		cfg = cfg.WithCredentials(
-			credentials.NewStaticCredentials(s.Credentials.AccessKeyID, s.Credentials.SecretAccessKey, ""),
+			credentials.NewStaticCredentials(s.Credentials.AccessKeyID, s.Credentials.SecretAccessKey, s.Credentials.Token),
 		)
 	}
 	sess, err := session.NewSession(cfg)
@@ -80,7 +111,12 @@ func (s *Source) DownloadToPath(dlPath string) error {
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId: aws.String(s.SecretId),
 	}
-	outpath := filepath.Join(dlPath, s.FileName)
+	if s.VersionStage != "" {
+		input.VersionStage = aws.String(s.VersionStage)
+	}
+	if s.VersionID != "" {
+		input.VersionId = aws.String(s.VersionID)
+	}
 
 	result, err := svc.GetSecretValue(input)
 	if err != nil {
@@ -88,25 +124,61 @@ func (s *Source) DownloadToPath(dlPath string) error {
 		return err
 	}
 
-	// Create the output file if it doesn't exist
-	fh, err := os.OpenFile(outpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0400)
-	if err != nil {
-		s.logger.Debugf(0, "failed to create target (%s): %s", outpath, err)
-		return err
+	// binary secrets have no SecretString
+	var data []byte
+	if result.SecretString != nil {
+		data = []byte(*result.SecretString)
+		go2chef.RegisterRedaction(*result.SecretString)
+	} else {
+		data = result.SecretBinary
 	}
-	defer fh.Close()
 
-	_, err = fh.WriteString(*result.SecretString)
-	if err != nil {
-		s.logger.Debugf(0, "failed to write secret data: %s", err)
-		return err
+	files := map[string][]byte{s.FileName: data}
+	if s.JSONKey != "" || len(s.Files) > 0 {
+		if files, err = s.splitJSON(data); err != nil {
+			return err
+		}
+	}
+	for name, content := range files {
+		outpath, err := outfile.Path(dlPath, name)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s.Name(), err)
+		}
+		if err := outfile.Write(outpath, content, s.mode, s.Owner); err != nil {
+			s.logger.Debugf(0, "failed to write secret data to %s: %s", outpath, err)
+			return fmt.Errorf("%s: %s", s.Name(), err)
+		}
+		s.logger.Debugf(0, "Wrote secret (%s) to: %s", s.SecretId, outpath)
 	}
-	fh.Close()
-
-	s.logger.Debugf(0, "Wrote secret (%s) to: %s", s.SecretId, outpath)
 	return nil
 }
 
+// splitJSON extracts the configured keys from a JSON secret, mapped to
+// their output filenames
+func (s *Source) splitJSON(data []byte) (map[string][]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s: secret %s is not a JSON object: %s", s.Name(), s.SecretId, err)
+	}
+	keys := make(map[string]string, len(s.Files)+1)
+	for k, fn := range s.Files {
+		keys[k] = fn
+	}
+	if s.JSONKey != "" {
+		keys[s.JSONKey] = s.FileName
+	}
+
+	files := make(map[string][]byte, len(keys))
+	for k, fn := range keys {
+		raw, ok := fields[k]
+		if !ok {
+			return nil, fmt.Errorf("%s: secret %s has no key %q", s.Name(), s.SecretId, k)
+		}
+		files[fn] = secret.FieldValue(raw)
+	}
+	return files, nil
+}
+
 // Loader provides an instantiation function for this source
 func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	s := &Source{
@@ -123,6 +195,14 @@ func Loader(config map[string]interface{}) (go2chef.Source, error) {
 	if s.FileName == "" {
 		s.FileName = s.SecretId
 	}
+
+	var err error
+	if s.mode, err = outfile.ParseMode(s.Mode, defaultMode); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	if err := outfile.ValidateOwner(s.Owner); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
 	return s, nil
 }
 
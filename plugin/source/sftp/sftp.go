@@ -0,0 +1,410 @@
+package sftp
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/archive"
+	"github.com/facebookincubator/go2chef/plugin/lib/secret"
+	"github.com/facebookincubator/go2chef/plugin/lib/transfer"
+	"github.com/facebookincubator/go2chef/util"
+	"github.com/facebookincubator/go2chef/util/temp"
+	"github.com/mitchellh/mapstructure"
+)
+
+// TypeName is the name of this source plugin
+const TypeName = "go2chef.source.sftp"
+
+// Source implements an SFTP source which downloads a file or directory
+// tree from an SSH server.
+type Source struct {
+	logger go2chef.Logger
+
+	SourceName string `mapstructure:"name"`
+	Host       string `mapstructure:"host"`
+	Port       int    `mapstructure:"port"`
+	User       string `mapstructure:"user"`
+	// Path is the remote file or directory to download
+	Path    string `mapstructure:"path"`
+	Archive bool   `mapstructure:"archive"`
+
+	archive.Options `mapstructure:",squash"`
+	transfer.Limit  `mapstructure:",squash"`
+
+	// KnownHostsFile lists trusted host keys in OpenSSH known_hosts format,
+	// defaulting to ~/.ssh/known_hosts unless HostKeys is set
+	KnownHostsFile string `mapstructure:"known_hosts_file"`
+	// HostKeys are trusted host public keys in authorized_keys format,
+	// i.e. "ssh-ed25519 AAAA..."
+	HostKeys []string `mapstructure:"host_keys"`
+
+	// PrivateKey, PrivateKeyPassphrase and Password are secret specs
+	PrivateKey           interface{} `mapstructure:"private_key"`
+	PrivateKeyPassphrase interface{} `mapstructure:"private_key_passphrase"`
+	Password             interface{} `mapstructure:"password"`
+	// Agent authenticates with the keys in the agent at $SSH_AUTH_SOCK
+	Agent bool `mapstructure:"agent"`
+
+	ConnectTimeoutSeconds int `mapstructure:"connect_timeout_seconds"`
+
+	checksums go2chef.ChecksumVerifiers
+}
+
+func (s *Source) String() string {
+	return "<" + TypeName + ":" + s.SourceName + ">"
+}
+
+// Name returns the name of this source instance
+func (s *Source) Name() string {
+	return s.SourceName
+}
+
+// Type returns the type of this source
+func (s *Source) Type() string {
+	return TypeName
+}
+
+// SetName sets the name of this source instance
+func (s *Source) SetName(name string) {
+	s.SourceName = name
+}
+
+// AddChecksumVerifier adds a verifier run against the downloaded file
+// before it's extracted or moved into place
+func (s *Source) AddChecksumVerifier(v go2chef.ChecksumVerifier) {
+	s.checksums = append(s.checksums, v)
+}
+
+func (s *Source) location() string {
+	return "sftp://" + net.JoinHostPort(s.Host, strconv.Itoa(s.Port)) + "/" + strings.TrimPrefix(s.Path, "/")
+}
+
+// DownloadToPath connects to the server and downloads Path into dlPath
+func (s *Source) DownloadToPath(dlPath string) (err error) {
+	s.logger.WriteEvent(go2chef.NewEvent("SFTP_DOWNLOAD_STARTED", TypeName, s.location()))
+	defer func() {
+		event := "SFTP_DOWNLOAD_COMPLETE"
+		if err != nil {
+			event = "SFTP_DOWNLOAD_FAILURE"
+		}
+		s.logger.WriteEvent(go2chef.NewEvent(event, TypeName, s.location()))
+	}()
+
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		return err
+	}
+	config, cleanup, err := s.clientConfig()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(s.Host, strconv.Itoa(s.Port)), config)
+	if err != nil {
+		return fmt.Errorf("%s: %s", s.Name(), err)
+	}
+	defer conn.Close()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	st, err := client.Stat(s.Path)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %s", s.Name(), s.Path, err)
+	}
+	if st.IsDir() {
+		if s.Archive || len(s.checksums) > 0 {
+			return fmt.Errorf("%s: `archive` and `checksum` can't be used with directory %s, use `checksums` instead", s.Name(), s.Path)
+		}
+		return s.downloadDir(client, dlPath)
+	}
+	return s.downloadFile(client, dlPath, st)
+}
+
+// downloadFile downloads a single file to a temp directory, verifies it,
+// then extracts it or moves it into dlPath
+func (s *Source) downloadFile(client *sftp.Client, dlPath string, st os.FileInfo) error {
+	tmpDir, err := temp.Dir("", "go2chef-sftp-")
+	if err != nil {
+		return err
+	}
+	defer temp.Remove(tmpDir)
+
+	// keep the remote filename, archive format detection needs it
+	filename := path.Base(s.Path)
+	tmp := filepath.Join(tmpDir, filename)
+	fh, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := s.fetch(client, s.Path, fh); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+
+	if err := s.checksums.VerifyChecksum(filename, tmp); err != nil {
+		return err
+	}
+	return s.install(tmp, dlPath, st.Mode().Perm())
+}
+
+// InstallFile moves or extracts a file fetched earlier, such as from the
+// download cache, into dlPath
+func (s *Source) InstallFile(filename, p, dlPath string) error {
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		return err
+	}
+	tmpDir, err := temp.Dir("", "go2chef-sftp-")
+	if err != nil {
+		return err
+	}
+	defer temp.Remove(tmpDir)
+
+	// keep the remote filename, archive format detection needs it
+	tmp := filepath.Join(tmpDir, path.Base(s.Path))
+	if err := util.MoveFile(p, tmp); err != nil {
+		return err
+	}
+	return s.install(tmp, dlPath, 0644)
+}
+
+// install extracts the verified file at tmp into dlPath, or moves it there
+// with the given mode. tmp must be named after the remote file.
+func (s *Source) install(tmp, dlPath string, mode os.FileMode) error {
+	filename := filepath.Base(tmp)
+	if s.Archive {
+		s.logger.Debugf(1, "%s: extracting %s to %s", s.Name(), filename, dlPath)
+		return s.Extract(tmp, dlPath)
+	}
+	out := filepath.Join(dlPath, filename)
+	if err := util.MoveFile(tmp, out); err != nil {
+		return err
+	}
+	return os.Chmod(out, mode)
+}
+
+// downloadDir downloads the directory tree at Path, preserving file modes.
+// Symlinks and special files are skipped.
+func (s *Source) downloadDir(client *sftp.Client, dlPath string) error {
+	root := path.Clean(s.Path)
+	walker := client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/")
+		if rel == "" {
+			continue
+		}
+		for _, elem := range strings.Split(rel, "/") {
+			if elem == ".." {
+				return fmt.Errorf("%s: remote path %s escapes the download path", s.Name(), walker.Path())
+			}
+		}
+		local := filepath.Join(dlPath, filepath.FromSlash(rel))
+		st := walker.Stat()
+		switch {
+		case st.IsDir():
+			if err := os.MkdirAll(local, st.Mode().Perm()|0700); err != nil {
+				return err
+			}
+		case st.Mode().IsRegular():
+			fh, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, st.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if err := s.fetch(client, walker.Path(), fh); err != nil {
+				fh.Close()
+				return err
+			}
+			if err := fh.Close(); err != nil {
+				return err
+			}
+			if err := os.Chmod(local, st.Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			s.logger.Debugf(1, "%s: skipping %s (%s)", s.Name(), walker.Path(), st.Mode())
+		}
+	}
+	return nil
+}
+
+// fetch copies a remote file to w, throttling it and reporting progress
+func (s *Source) fetch(client *sftp.Client, remote string, w io.Writer) error {
+	fh, err := client.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	total := int64(-1)
+	if st, err := fh.Stat(); err == nil {
+		total = st.Size()
+	}
+	progress := s.NewProgress(TypeName, s.Host+":"+remote, total)
+	n, err := fh.WriteTo(progress.Writer(w))
+	if err != nil {
+		return fmt.Errorf("%s: failed to download %s: %s", s.Name(), remote, err)
+	}
+	s.logger.Debugf(1, "%s: downloaded %s (%d bytes)", s.Name(), remote, n)
+	return nil
+}
+
+// clientConfig builds the SSH client configuration. The returned cleanup
+// function closes the agent connection, if any.
+func (s *Source) clientConfig() (*ssh.ClientConfig, func(), error) {
+	cleanup := func() {}
+	hostKeyCallback, err := s.hostKeyCallback()
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	var auth []ssh.AuthMethod
+	if s.PrivateKey != nil {
+		key, err := secret.Resolve(s.PrivateKey)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("%s: private_key: %s", s.Name(), err)
+		}
+		var signer ssh.Signer
+		if s.PrivateKeyPassphrase != nil {
+			pass, err := secret.Resolve(s.PrivateKeyPassphrase)
+			if err != nil {
+				return nil, cleanup, fmt.Errorf("%s: private_key_passphrase: %s", s.Name(), err)
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(key), []byte(pass))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(key))
+		}
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("%s: private_key: %s", s.Name(), err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if s.Agent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, cleanup, fmt.Errorf("%s: agent auth requires SSH_AUTH_SOCK", s.Name())
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("%s: failed to connect to ssh agent: %s", s.Name(), err)
+		}
+		cleanup = func() { conn.Close() }
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if s.Password != nil {
+		pass, err := secret.Resolve(s.Password)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("%s: password: %s", s.Name(), err)
+		}
+		auth = append(auth, ssh.Password(pass))
+	}
+
+	return &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         time.Duration(s.ConnectTimeoutSeconds) * time.Second,
+	}, cleanup, nil
+}
+
+// hostKeyCallback verifies host keys against HostKeys if set, otherwise
+// against KnownHostsFile
+func (s *Source) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if len(s.HostKeys) == 0 {
+		cb, err := knownhosts.New(s.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to load known hosts: %s", s.Name(), err)
+		}
+		return cb, nil
+	}
+
+	var keys []ssh.PublicKey
+	for _, k := range s.HostKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid host key %q: %s", s.Name(), k, err)
+		}
+		keys = append(keys, key)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, k := range keys {
+			if k.Type() == key.Type() && string(k.Marshal()) == string(key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host key %s for %s isn't trusted", ssh.FingerprintSHA256(key), hostname)
+	}, nil
+}
+
+// Loader provides an instantiation function for this source
+func Loader(config map[string]interface{}) (go2chef.Source, error) {
+	s := &Source{
+		logger:                go2chef.GetGlobalLogger(),
+		SourceName:            "",
+		Port:                  22,
+		ConnectTimeoutSeconds: go2chef.HTTP.ConnectTimeoutSeconds,
+	}
+	if err := mapstructure.Decode(config, s); err != nil {
+		return nil, err
+	}
+	if s.SourceName == "" {
+		s.SourceName = TypeName
+	}
+	if s.Host == "" || s.Path == "" {
+		return nil, errors.New(TypeName + ": host and path are required")
+	}
+	if s.PrivateKey == nil && s.Password == nil && !s.Agent {
+		return nil, errors.New(TypeName + ": one of private_key, password or agent is required")
+	}
+	if err := s.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	if err := s.Limit.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	if s.User == "" || (s.KnownHostsFile == "" && len(s.HostKeys) == 0) {
+		u, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		if s.User == "" {
+			s.User = u.Username
+		}
+		if s.KnownHostsFile == "" && len(s.HostKeys) == 0 {
+			s.KnownHostsFile = filepath.Join(u.HomeDir, ".ssh", "known_hosts")
+		}
+	}
+	return s, nil
+}
+
+var _ go2chef.ChecksumSource = &Source{}
+var _ go2chef.FileInstaller = &Source{}
+var _ go2chef.SourceLoader = Loader
+
+func init() {
+	go2chef.RegisterSource(TypeName, Loader)
+}
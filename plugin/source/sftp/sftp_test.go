@@ -0,0 +1,330 @@
+package sftp
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/cache"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshServer is an in-process SSH server with an sftp subsystem serving the
+// local filesystem
+type sshServer struct {
+	listener net.Listener
+	hostKey  ssh.PublicKey
+	port     int
+}
+
+func newSSHServer(t *testing.T, password string, clientKey ssh.PublicKey) *sshServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("failed to create host key signer: %s", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) == password {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	s := &sshServer{listener: l, hostKey: signer.PublicKey(), port: l.Addr().(*net.TCPAddr).Port}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *sshServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			_ = nc.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(ch)
+					if err == nil {
+						_ = server.Serve()
+					}
+					ch.Close()
+				}
+			}
+		}()
+	}
+}
+
+func (s *sshServer) Close() {
+	s.listener.Close()
+}
+
+func (s *sshServer) knownHosts(t *testing.T, dir string) string {
+	fn := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{"127.0.0.1:" + strconv.Itoa(s.port)}, s.hostKey)
+	if err := ioutil.WriteFile(fn, []byte(line+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write known_hosts: %s", err)
+	}
+	return fn
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	return dir
+}
+
+func download(t *testing.T, srv *sshServer, config map[string]interface{}) (string, error) {
+	dir := tempDir(t)
+	config["host"] = "127.0.0.1"
+	config["port"] = srv.port
+	config["user"] = "go2chef"
+	config["type"] = TypeName
+	s, err := go2chef.GetSource(TypeName, config)
+	if err != nil {
+		t.Fatalf("failed to load source: %s", err)
+	}
+	return dir, s.DownloadToPath(dir)
+}
+
+func TestSource_DownloadToPath(t *testing.T) {
+	clientPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %s", err)
+	}
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		t.Fatalf("failed to create client key signer: %s", err)
+	}
+	der, err := x509.MarshalECPrivateKey(clientPriv)
+	if err != nil {
+		t.Fatalf("failed to marshal client key: %s", err)
+	}
+	clientKey := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+
+	srv := newSSHServer(t, "hunter2", clientSigner.PublicKey())
+	defer srv.Close()
+
+	remote := tempDir(t)
+	defer os.RemoveAll(remote)
+	if err := os.MkdirAll(filepath.Join(remote, "bundle", "bin"), 0755); err != nil {
+		t.Fatalf("failed to create remote tree: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(remote, "bundle", "bin", "chefctl"), []byte("#!/bin/sh"), 0750); err != nil {
+		t.Fatalf("failed to write remote file: %s", err)
+	}
+	rpm := []byte("chef rpm")
+	if err := ioutil.WriteFile(filepath.Join(remote, "chef.rpm"), rpm, 0644); err != nil {
+		t.Fatalf("failed to write remote file: %s", err)
+	}
+	sum := sha256.Sum256(rpm)
+	knownHosts := srv.knownHosts(t, remote)
+
+	// single file with key auth and a checksum
+	dir, err := download(t, srv, map[string]interface{}{
+		"path":             filepath.Join(remote, "chef.rpm"),
+		"known_hosts_file": knownHosts,
+		"private_key":      clientKey,
+		"checksum":         "sha256:" + hex.EncodeToString(sum[:]),
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("download failed: %s", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "chef.rpm")); err != nil || !bytes.Equal(data, rpm) {
+		t.Errorf("unexpected content %q: %v", data, err)
+	}
+
+	// directory with password auth and a pinned host key
+	dir, err = download(t, srv, map[string]interface{}{
+		"path":      filepath.Join(remote, "bundle"),
+		"host_keys": []string{string(ssh.MarshalAuthorizedKey(srv.hostKey))},
+		"password":  "hunter2",
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("directory download failed: %s", err)
+	}
+	st, err := os.Stat(filepath.Join(dir, "bin", "chefctl"))
+	if err != nil {
+		t.Fatalf("chefctl wasn't downloaded: %s", err)
+	}
+	if st.Mode().Perm() != 0750 {
+		t.Errorf("unexpected mode %o", st.Mode().Perm())
+	}
+
+	// bad checksum
+	dir, err = download(t, srv, map[string]interface{}{
+		"path":             filepath.Join(remote, "chef.rpm"),
+		"known_hosts_file": knownHosts,
+		"password":         "hunter2",
+		"checksum":         "sha256:" + hex.EncodeToString(make([]byte, 32)),
+	})
+	defer os.RemoveAll(dir)
+	if err == nil {
+		t.Errorf("expected checksum mismatch to fail")
+	}
+
+	// untrusted host key
+	other := tempDir(t)
+	defer os.RemoveAll(other)
+	empty := filepath.Join(other, "known_hosts")
+	_ = ioutil.WriteFile(empty, nil, 0644)
+	dir, err = download(t, srv, map[string]interface{}{
+		"path":             filepath.Join(remote, "chef.rpm"),
+		"known_hosts_file": empty,
+		"password":         "hunter2",
+	})
+	defer os.RemoveAll(dir)
+	if err == nil {
+		t.Errorf("expected unknown host key to fail")
+	}
+}
+
+func TestSource_DownloadToPathArchive(t *testing.T) {
+	srv := newSSHServer(t, "hunter2", nil)
+	defer srv.Close()
+
+	remote := tempDir(t)
+	defer os.RemoveAll(remote)
+	fh, err := os.Create(filepath.Join(remote, "bundle.zip"))
+	if err != nil {
+		t.Fatalf("failed to create archive: %s", err)
+	}
+	zw := zip.NewWriter(fh)
+	w, _ := zw.Create("bundle-1.0/chefctl.rb")
+	_, _ = w.Write([]byte("config"))
+	zw.Close()
+	fh.Close()
+
+	dir, err := download(t, srv, map[string]interface{}{
+		"path":             filepath.Join(remote, "bundle.zip"),
+		"known_hosts_file": srv.knownHosts(t, remote),
+		"password":         "hunter2",
+		"archive":          true,
+		"strip_components": 1,
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("download failed: %s", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "chefctl.rb")); err != nil || string(data) != "config" {
+		t.Errorf("unexpected content %q: %v", data, err)
+	}
+}
+
+// Test that an archive with a known checksum is installed from the
+// download cache once the server is gone
+func TestSource_DownloadToPathCache(t *testing.T) {
+	cacheDir := tempDir(t)
+	defer os.RemoveAll(cacheDir)
+	go2chef.SetDownloadCache(cache.New(cacheDir, 0))
+	defer go2chef.SetDownloadCache(nil)
+
+	srv := newSSHServer(t, "hunter2", nil)
+	defer srv.Close()
+
+	remote := tempDir(t)
+	defer os.RemoveAll(remote)
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, _ := zw.Create("chefctl.rb")
+	_, _ = w.Write([]byte("config"))
+	zw.Close()
+	if err := ioutil.WriteFile(filepath.Join(remote, "bundle.zip"), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write archive: %s", err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	config := func() map[string]interface{} {
+		return map[string]interface{}{
+			"path":             filepath.Join(remote, "bundle.zip"),
+			"known_hosts_file": srv.knownHosts(t, remote),
+			"password":         "hunter2",
+			"archive":          true,
+			"checksum":         "sha256:" + hex.EncodeToString(sum[:]),
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		dir, err := download(t, srv, config())
+		defer os.RemoveAll(dir)
+		if err != nil {
+			t.Fatalf("download %d failed: %s", i, err)
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(dir, "chefctl.rb")); err != nil || string(data) != "config" {
+			t.Errorf("unexpected content %q on download %d: %v", data, i, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestLoader(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"path": "/a", "password": "x"},
+		{"host": "h", "password": "x"},
+		{"host": "h", "path": "/a"},
+		{"host": "h", "path": "/a", "password": "x", "archive_format": "docx"},
+		{"host": "h", "path": "/a", "password": "x", "rate_limit": "fast"},
+	} {
+		if _, err := Loader(config); err == nil {
+			t.Errorf("expected config %v to fail to load", config)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package vault
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/facebookincubator/go2chef"
+	"github.com/facebookincubator/go2chef/plugin/lib/outfile"
+	"github.com/facebookincubator/go2chef/plugin/lib/secret"
+	"github.com/mitchellh/mapstructure"
+)
+
+// TypeName is the name of this source plugin
+const TypeName = "go2chef.source.vault"
+
+// defaultMode is the file mode secrets are written with
+const defaultMode = 0400
+
+// Auth methods supported by this source
+const (
+	AuthToken   = "token"
+	AuthAppRole = "approle"
+	AuthCert    = "cert"
+)
+
+// Source implements a HashiCorp Vault source which reads a KV secret and
+// writes selected fields of it to files in the download path.
+type Source struct {
+	logger go2chef.Logger
+
+	SourceName string `mapstructure:"name"`
+	// Address is the Vault server URL, defaulting to $VAULT_ADDR
+	Address string `mapstructure:"address"`
+	// Namespace is the Vault Enterprise namespace, defaulting to
+	// $VAULT_NAMESPACE
+	Namespace string `mapstructure:"namespace"`
+
+	// Mount is the path the KV engine is mounted at, "secret" by default
+	Mount     string `mapstructure:"mount"`
+	Path      string `mapstructure:"path"`
+	KVVersion int    `mapstructure:"kv_version"`
+	// Version pins a KV v2 secret version; 0 reads the latest
+	Version int `mapstructure:"version"`
+
+	// Field writes just this field of the secret to Filename. Without
+	// Field or Files the whole secret is written as JSON.
+	Field    string `mapstructure:"field"`
+	Filename string `mapstructure:"filename"`
+	// Files maps secret fields to the files they're written to
+	Files map[string]string `mapstructure:"files"`
+	// Mode is the octal file mode for written secrets, i.e. "0440"
+	Mode string `mapstructure:"mode"`
+	// Owner is the `user[:group]` (names or IDs) to own written secrets
+	Owner string `mapstructure:"owner"`
+
+	Auth struct {
+		Method string `mapstructure:"method"`
+		// Mount is the auth method mount path, defaulting to the method
+		Mount string `mapstructure:"mount"`
+		// Token is a secret spec for token auth, defaulting to $VAULT_TOKEN
+		Token interface{} `mapstructure:"token"`
+		// RoleID and SecretID are secret specs for AppRole auth
+		RoleID   interface{} `mapstructure:"role_id"`
+		SecretID interface{} `mapstructure:"secret_id"`
+		// Role is the certificate role name for cert auth; if empty Vault
+		// tries all roles matching the client certificate
+		Role string `mapstructure:"role"`
+	} `mapstructure:"auth"`
+
+	mode  os.FileMode
+	token string
+}
+
+func (s *Source) String() string {
+	return "<" + TypeName + ":" + s.SourceName + ">"
+}
+
+// Name returns the name of this source instance
+func (s *Source) Name() string {
+	return s.SourceName
+}
+
+// Type returns the type of this source
+func (s *Source) Type() string {
+	return TypeName
+}
+
+// SetName sets the name of this source instance
+func (s *Source) SetName(name string) {
+	s.SourceName = name
+}
+
+// DownloadToPath logs in to Vault, reads the secret and writes the
+// configured fields to dlPath
+func (s *Source) DownloadToPath(dlPath string) (err error) {
+	s.logger.WriteEvent(go2chef.NewEvent("VAULT_READ_STARTED", TypeName, s.secretPath()))
+	defer func() {
+		event := "VAULT_READ_COMPLETE"
+		if err != nil {
+			event = "VAULT_READ_FAILURE"
+		}
+		s.logger.WriteEvent(go2chef.NewEvent(event, TypeName, s.secretPath()))
+	}()
+
+	if err := os.MkdirAll(dlPath, 0755); err != nil {
+		return err
+	}
+	if err := s.login(); err != nil {
+		return err
+	}
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+	files, err := s.render(data)
+	if err != nil {
+		return err
+	}
+	for name, content := range files {
+		outpath, err := outfile.Path(dlPath, name)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s.Name(), err)
+		}
+		if err := outfile.Write(outpath, content, s.mode, s.Owner); err != nil {
+			return fmt.Errorf("%s: %s", s.Name(), err)
+		}
+		s.logger.Debugf(0, "%s: wrote %s", s.Name(), outpath)
+	}
+	return nil
+}
+
+// login obtains a client token using the configured auth method
+func (s *Source) login() error {
+	var body map[string]string
+	switch s.Auth.Method {
+	case AuthToken:
+		spec := s.Auth.Token
+		if spec == nil {
+			spec = map[string]interface{}{"env": "VAULT_TOKEN"}
+		}
+		token, err := secret.Resolve(spec)
+		if err != nil {
+			return fmt.Errorf("%s: token: %s", s.Name(), err)
+		}
+		s.token = token
+		return nil
+	case AuthAppRole:
+		roleID, err := secret.Resolve(s.Auth.RoleID)
+		if err != nil {
+			return fmt.Errorf("%s: role_id: %s", s.Name(), err)
+		}
+		secretID, err := secret.Resolve(s.Auth.SecretID)
+		if err != nil {
+			return fmt.Errorf("%s: secret_id: %s", s.Name(), err)
+		}
+		body = map[string]string{"role_id": roleID, "secret_id": secretID}
+	case AuthCert:
+		// the client certificate comes from the global TLS configuration
+		// used by go2chef.HTTPClient()
+		body = map[string]string{}
+		if s.Auth.Role != "" {
+			body["name"] = s.Auth.Role
+		}
+	}
+
+	mount := s.Auth.Mount
+	if mount == "" {
+		mount = s.Auth.Method
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := s.request(http.MethodPost, path.Join("auth", mount, "login"), nil, body, &resp); err != nil {
+		return fmt.Errorf("%s: %s login failed: %s", s.Name(), s.Auth.Method, err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return fmt.Errorf("%s: %s login returned no token", s.Name(), s.Auth.Method)
+	}
+	go2chef.RegisterRedaction(resp.Auth.ClientToken)
+	s.token = resp.Auth.ClientToken
+	return nil
+}
+
+// secretPath returns the API path of the secret for the KV version
+func (s *Source) secretPath() string {
+	if s.KVVersion == 1 {
+		return path.Join(s.Mount, s.Path)
+	}
+	return path.Join(s.Mount, "data", s.Path)
+}
+
+// read returns the fields of the secret
+func (s *Source) read() (map[string]json.RawMessage, error) {
+	query := url.Values{}
+	if s.Version > 0 {
+		query.Set("version", strconv.Itoa(s.Version))
+	}
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := s.request(http.MethodGet, s.secretPath(), query, nil, &resp); err != nil {
+		return nil, fmt.Errorf("%s: failed to read %s: %s", s.Name(), s.secretPath(), err)
+	}
+
+	data := resp.Data
+	if s.KVVersion != 1 {
+		// KV v2 wraps the secret with its metadata
+		var v2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, err
+		}
+		data = v2.Data
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil, fmt.Errorf("%s: secret %s has no data", s.Name(), s.secretPath())
+	}
+	return fields, nil
+}
+
+// render maps output filenames to their content
+func (s *Source) render(fields map[string]json.RawMessage) (map[string][]byte, error) {
+	if s.Field == "" && len(s.Files) == 0 {
+		// the fields' values are still secrets when written as a whole
+		for _, raw := range fields {
+			secret.FieldValue(raw)
+		}
+		data, err := json.MarshalIndent(fields, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{s.Filename: data}, nil
+	}
+
+	keys := make(map[string]string, len(s.Files)+1)
+	for k, fn := range s.Files {
+		keys[k] = fn
+	}
+	if s.Field != "" {
+		keys[s.Field] = s.Filename
+	}
+	files := make(map[string][]byte, len(keys))
+	for k, fn := range keys {
+		raw, ok := fields[k]
+		if !ok {
+			return nil, fmt.Errorf("%s: secret %s has no field %q", s.Name(), s.secretPath(), k)
+		}
+		files[fn] = secret.FieldValue(raw)
+	}
+	return files, nil
+}
+
+// request calls the Vault HTTP API, decoding the JSON response into out
+func (s *Source) request(method, apiPath string, query url.Values, body interface{}, out interface{}) error {
+	u, err := url.Parse(strings.TrimRight(s.Address, "/") + "/v1/" + apiPath)
+	if err != nil {
+		return err
+	}
+	u.RawQuery = query.Encode()
+
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u.String(), rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Request", "true")
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	if s.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.Namespace)
+	}
+
+	client, err := go2chef.HTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var verr struct {
+			Errors []string `json:"errors"`
+		}
+		msg := resp.Status
+		if json.NewDecoder(resp.Body).Decode(&verr) == nil && len(verr.Errors) > 0 {
+			msg += ": " + strings.Join(verr.Errors, "; ")
+		}
+		return errors.New(msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Loader provides an instantiation function for this source
+func Loader(config map[string]interface{}) (go2chef.Source, error) {
+	s := &Source{
+		logger:     go2chef.GetGlobalLogger(),
+		SourceName: "",
+		Address:    os.Getenv("VAULT_ADDR"),
+		Namespace:  os.Getenv("VAULT_NAMESPACE"),
+		Mount:      "secret",
+		KVVersion:  2,
+	}
+	if err := mapstructure.Decode(config, s); err != nil {
+		return nil, err
+	}
+	if s.SourceName == "" {
+		s.SourceName = TypeName
+	}
+	if s.Address == "" {
+		return nil, errors.New(TypeName + ": address is required if VAULT_ADDR isn't set")
+	}
+	if s.Path == "" {
+		return nil, errors.New(TypeName + ": path is required")
+	}
+	if s.KVVersion != 1 && s.KVVersion != 2 {
+		return nil, fmt.Errorf("%s: unsupported kv_version %d", TypeName, s.KVVersion)
+	}
+	if s.Version > 0 && s.KVVersion == 1 {
+		return nil, errors.New(TypeName + ": version requires kv_version 2")
+	}
+	if s.Filename == "" {
+		s.Filename = path.Base(s.Path)
+	}
+
+	switch s.Auth.Method {
+	case "":
+		s.Auth.Method = AuthToken
+	case AuthToken, AuthAppRole, AuthCert:
+	default:
+		return nil, fmt.Errorf("%s: unsupported auth method %q", TypeName, s.Auth.Method)
+	}
+	if s.Auth.Method == AuthAppRole && (s.Auth.RoleID == nil || s.Auth.SecretID == nil) {
+		return nil, errors.New(TypeName + ": approle auth requires role_id and secret_id")
+	}
+
+	var err error
+	if s.mode, err = outfile.ParseMode(s.Mode, defaultMode); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	if err := outfile.ValidateOwner(s.Owner); err != nil {
+		return nil, fmt.Errorf("%s: %s", TypeName, err)
+	}
+	return s, nil
+}
+
+var _ go2chef.Source = &Source{}
+var _ go2chef.SourceLoader = Loader
+
+func init() {
+	go2chef.RegisterSource(TypeName, Loader)
+}
@@ -0,0 +1,234 @@
+package vault
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/facebookincubator/go2chef"
+)
+
+// fakeVault is a minimal Vault stand-in with a KV v1 mount at "kv", a KV v2
+// mount at "secret" and AppRole and cert auth
+type fakeVault struct {
+	*httptest.Server
+	namespaces []string
+	certRole   string
+}
+
+const (
+	rootToken    = "s.root"
+	appRoleToken = "s.approle"
+	certToken    = "s.cert"
+)
+
+func newFakeVault() *fakeVault {
+	f := &fakeVault{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.namespaces = append(f.namespaces, r.Header.Get("X-Vault-Namespace"))
+	fail := func(code int, msg string) {
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {msg}})
+	}
+	reply := func(v interface{}) {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	var body map[string]string
+	if r.Method == http.MethodPost {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		if body["role_id"] != "role" || body["secret_id"] != "sekrit" {
+			fail(http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+		reply(map[string]interface{}{"auth": map[string]string{"client_token": appRoleToken}})
+		return
+	case "/v1/auth/cert/login":
+		f.certRole = body["name"]
+		reply(map[string]interface{}{"auth": map[string]string{"client_token": certToken}})
+		return
+	}
+
+	switch r.Header.Get("X-Vault-Token") {
+	case rootToken, appRoleToken, certToken:
+	default:
+		fail(http.StatusForbidden, "permission denied")
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/kv/chef":
+		reply(map[string]interface{}{"data": map[string]string{"validator": "V1KEY"}})
+	case "/v1/secret/data/chef":
+		version := r.URL.Query().Get("version")
+		key := "LATEST"
+		if version == "1" {
+			key = "OLD"
+		}
+		reply(map[string]interface{}{"data": map[string]interface{}{
+			"data":     map[string]interface{}{"validator": key, "client": map[string]string{"name": "web01"}},
+			"metadata": map[string]interface{}{"version": 2},
+		}})
+	default:
+		fail(http.StatusNotFound, "")
+	}
+}
+
+func download(t *testing.T, config map[string]interface{}) (string, error) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	s, err := Loader(config)
+	if err != nil {
+		t.Fatalf("failed to load source: %s", err)
+	}
+	return dir, s.DownloadToPath(dir)
+}
+
+func checkFile(t *testing.T, fn, content string) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Errorf("failed to read %s: %s", fn, err)
+		return
+	}
+	if string(data) != content {
+		t.Errorf("unexpected content in %s: %q", fn, data)
+	}
+	st, err := os.Stat(fn)
+	if err != nil {
+		t.Errorf("failed to stat %s: %s", fn, err)
+	} else if st.Mode().Perm() != defaultMode {
+		t.Errorf("unexpected mode for %s: %o", fn, st.Mode().Perm())
+	}
+}
+
+func TestSource_DownloadToPath(t *testing.T) {
+	f := newFakeVault()
+	defer f.Close()
+	os.Setenv("VAULT_TOKEN", rootToken)
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	dir, err := download(t, map[string]interface{}{
+		"address":   f.URL,
+		"namespace": "infra",
+		"path":      "chef",
+		"field":     "validator",
+		"filename":  "validation.pem",
+		"files":     map[string]interface{}{"client": "client.json"},
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("download failed: %s", err)
+	}
+	checkFile(t, filepath.Join(dir, "validation.pem"), "LATEST")
+	checkFile(t, filepath.Join(dir, "client.json"), `{"name":"web01"}`)
+	for _, ns := range f.namespaces {
+		if ns != "infra" {
+			t.Errorf("namespace not sent with request: %q", ns)
+		}
+	}
+
+	dir, err = download(t, map[string]interface{}{
+		"address": f.URL, "path": "chef", "field": "validator", "version": 1,
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("versioned download failed: %s", err)
+	}
+	checkFile(t, filepath.Join(dir, "chef"), "OLD")
+
+	dir, err = download(t, map[string]interface{}{
+		"address": f.URL, "mount": "kv", "kv_version": 1, "path": "chef",
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("KV v1 download failed: %s", err)
+	}
+	checkFile(t, filepath.Join(dir, "chef"), "{\n  \"validator\": \"V1KEY\"\n}")
+	if out := go2chef.Redact("key V1KEY"); out != "key "+go2chef.RedactedPlaceholder {
+		t.Errorf("whole secret values not redacted: %s", out)
+	}
+
+	dir, err = download(t, map[string]interface{}{
+		"address": f.URL, "path": "chef", "field": "missing",
+	})
+	defer os.RemoveAll(dir)
+	if err == nil {
+		t.Errorf("expected missing field to fail")
+	}
+}
+
+func TestSource_DownloadToPathAuth(t *testing.T) {
+	f := newFakeVault()
+	defer f.Close()
+
+	dir, err := download(t, map[string]interface{}{
+		"address": f.URL,
+		"path":    "chef",
+		"field":   "validator",
+		"auth": map[string]interface{}{
+			"method":    "approle",
+			"role_id":   "role",
+			"secret_id": map[string]interface{}{"value": "sekrit"},
+		},
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("approle download failed: %s", err)
+	}
+	checkFile(t, filepath.Join(dir, "chef"), "LATEST")
+
+	dir, err = download(t, map[string]interface{}{
+		"address": f.URL,
+		"path":    "chef",
+		"field":   "validator",
+		"auth":    map[string]interface{}{"method": "cert", "role": "web"},
+	})
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("cert download failed: %s", err)
+	}
+	if f.certRole != "web" {
+		t.Errorf("cert role not sent: %q", f.certRole)
+	}
+
+	dir, err = download(t, map[string]interface{}{
+		"address": f.URL,
+		"path":    "chef",
+		"auth":    map[string]interface{}{"method": "approle", "role_id": "role", "secret_id": "wrong"},
+	})
+	defer os.RemoveAll(dir)
+	if err == nil {
+		t.Errorf("expected bad approle credentials to fail")
+	}
+}
+
+func TestLoader(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"address": "http://vault:8200"},
+		{"address": "http://vault:8200", "path": "a", "kv_version": 3},
+		{"address": "http://vault:8200", "path": "a", "kv_version": 1, "version": 2},
+		{"address": "http://vault:8200", "path": "a", "auth": map[string]interface{}{"method": "ldap"}},
+		{"address": "http://vault:8200", "path": "a", "auth": map[string]interface{}{"method": "approle"}},
+		{"address": "http://vault:8200", "path": "a", "mode": "rw"},
+	} {
+		if _, err := Loader(config); err == nil {
+			t.Errorf("expected config %v to fail to load", config)
+		}
+	}
+}
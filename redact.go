@@ -0,0 +1,54 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedPlaceholder replaces redacted values in log output
+const RedactedPlaceholder = "[REDACTED]"
+
+// MinRedactionLength is the shortest value which will be registered for
+// redaction. Shorter values would mangle unrelated log output.
+const MinRedactionLength = 4
+
+var redactions = struct {
+	sync.RWMutex
+	values map[string]struct{}
+	// sorted holds the values longest first, so a secret containing
+	// another is masked before the shorter one can mangle it
+	sorted []string
+}{values: make(map[string]struct{})}
+
+// RegisterRedaction registers a secret value to be masked in messages and
+// events written through the global logger.
+func RegisterRedaction(secret string) {
+	if len(secret) < MinRedactionLength {
+		return
+	}
+	redactions.Lock()
+	defer redactions.Unlock()
+	if _, ok := redactions.values[secret]; ok {
+		return
+	}
+	redactions.values[secret] = struct{}{}
+	redactions.sorted = append(redactions.sorted, secret)
+	sort.SliceStable(redactions.sorted, func(i, j int) bool {
+		return len(redactions.sorted[i]) > len(redactions.sorted[j])
+	})
+}
+
+// Redact masks all registered secret values in s
+func Redact(s string) string {
+	redactions.RLock()
+	defer redactions.RUnlock()
+	for _, secret := range redactions.sorted {
+		s = strings.ReplaceAll(s, secret, RedactedPlaceholder)
+	}
+	return s
+}
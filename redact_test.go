@@ -0,0 +1,60 @@
+package go2chef
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import "testing"
+
+// eventRecorder is a Logger which records the events written to it
+type eventRecorder struct {
+	events []*Event
+}
+
+func (r *eventRecorder) String() string                     { return "recorder" }
+func (r *eventRecorder) Name() string                       { return "recorder" }
+func (r *eventRecorder) Type() string                       { return "recorder" }
+func (r *eventRecorder) SetName(string)                     {}
+func (r *eventRecorder) SetLevel(int)                       {}
+func (r *eventRecorder) SetDebug(int)                       {}
+func (r *eventRecorder) Debugf(int, string, ...interface{}) {}
+func (r *eventRecorder) Infof(string, ...interface{})       {}
+func (r *eventRecorder) Errorf(string, ...interface{})      {}
+func (r *eventRecorder) WriteEvent(e *Event)                { r.events = append(r.events, e) }
+func (r *eventRecorder) Shutdown()                          {}
+
+func TestRedactOverlapping(t *testing.T) {
+	// register the shorter secret first so insertion order can't mask bugs
+	RegisterRedaction("abcd")
+	RegisterRedaction("abcdefgh")
+	RegisterRedaction("ab")
+
+	for in, want := range map[string]string{
+		"token abcdefgh":      "token [REDACTED]",
+		"token abcd, abcdefg": "token [REDACTED], [REDACTED]efg",
+		"ab is too short":     "ab is too short",
+	} {
+		if got := Redact(in); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMultiLogger_WriteEventRedacts(t *testing.T) {
+	RegisterRedaction("hunter2-secret")
+	r := &eventRecorder{}
+	m := NewMultiLogger([]Logger{r})
+
+	extra := &ExtraLoggingFields{StepName: "step hunter2-secret", StepType: "type"}
+	m.WriteEvent(NewEventWithExtraFields("EVENT", "test", "message hunter2-secret", extra))
+	if len(r.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(r.events))
+	}
+	e := r.events[0]
+	if e.Message != "message [REDACTED]" || e.ExtraFields.StepName != "step [REDACTED]" {
+		t.Errorf("event not redacted: %s, %#v", e.Message, e.ExtraFields)
+	}
+	if extra.StepName != "step hunter2-secret" {
+		t.Errorf("original event fields were modified")
+	}
+}
@@ -4,4 +4,6 @@ set -eux
 
 source scripts/common.sh
 
-go build -o "$go2chef_output" ./bin
+go2chef_version="${GO2CHEF_VERSION:-$(git describe --tags --always 2>/dev/null || echo dev)}"
+
+go build -ldflags "-X github.com/facebookincubator/go2chef.Version=$go2chef_version" -o "$go2chef_output" ./bin
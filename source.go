@@ -25,10 +25,16 @@ func RegisterSource(name string, s SourceLoader) {
 	sourceRegistry[name] = s
 }
 
-// GetSource gets the specified source plugin configured with the provided config map
+// GetSource gets the specified source plugin configured with the provided
+// config map, applying the `checksum` and `checksums` options
 func GetSource(name string, config map[string]interface{}) (Source, error) {
-	if s, ok := sourceRegistry[name]; ok {
-		return s(config)
+	s, ok := sourceRegistry[name]
+	if !ok {
+		return nil, &ErrComponentDoesNotExist{Component: name}
 	}
-	return nil, &ErrComponentDoesNotExist{Component: name}
+	src, err := s(config)
+	if err != nil {
+		return nil, err
+	}
+	return applySourceChecksums(name, src, config)
 }
@@ -6,20 +6,82 @@ package hashfile
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"fmt"
+	"hash"
 	"io"
 	"os"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Supported hash algorithm names
+const (
+	AlgorithmSHA256  = "sha256"
+	AlgorithmSHA512  = "sha512"
+	AlgorithmBlake2b = "blake2b"
 )
 
+// algorithms maps algorithm names to hash constructors
+var algorithms = map[string]func() hash.Hash{
+	AlgorithmSHA256: sha256.New,
+	AlgorithmSHA512: sha512.New,
+	AlgorithmBlake2b: func() hash.Hash {
+		// blake2b.New512 only fails for keys longer than 64 bytes
+		h, _ := blake2b.New512(nil)
+		return h
+	},
+}
+
+// Supported returns whether the named algorithm is supported by Sum
+func Supported(algorithm string) bool {
+	_, ok := algorithms[algorithm]
+	return ok
+}
+
+// Size returns the digest length in bytes of the named algorithm, or 0 if
+// it isn't supported
+func Size(algorithm string) int {
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return 0
+	}
+	return newHash().Size()
+}
+
+// Sum returns a hex-encoded hash of the file at the given filepath using
+// the named algorithm (sha256, sha512 or blake2b).
+func Sum(algorithm, filePath string) (string, error) {
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash algorithm %q", algorithm)
+	}
+	return hashFile(newHash(), filePath)
+}
+
 // SHA256 returns a sha256 hash of the file at the given filepath.
 func SHA256(filePath string) (string, error) {
+	return hashFile(sha256.New(), filePath)
+}
+
+// SHA512 returns a sha512 hash of the file at the given filepath.
+func SHA512(filePath string) (string, error) {
+	return hashFile(sha512.New(), filePath)
+}
+
+// Blake2b returns a blake2b-512 hash of the file at the given filepath.
+func Blake2b(filePath string) (string, error) {
+	return Sum(AlgorithmBlake2b, filePath)
+}
+
+func hashFile(h hash.Hash, filePath string) (string, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 
-	h := sha256.New()
 	if _, err := io.Copy(h, f); err != nil {
 		return "", err
 	}
@@ -0,0 +1,60 @@
+package signature
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+const armorHeader = "-----BEGIN "
+
+// OpenPGPKeyRing is a set of trusted OpenPGP public keys
+type OpenPGPKeyRing openpgp.EntityList
+
+// IsOpenPGPKey returns whether s looks like an armored OpenPGP key, as
+// opposed to an ed25519 or minisign public key
+func IsOpenPGPKey(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), armorHeader+"PGP ")
+}
+
+// ReadOpenPGPKeyRing reads an armored or binary OpenPGP keyring
+func ReadOpenPGPKeyRing(r io.Reader) (OpenPGPKeyRing, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var el openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader)) {
+		el, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		el, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	return OpenPGPKeyRing(el), err
+}
+
+// Verify checks that sig, an armored or binary detached OpenPGP signature,
+// is a valid signature over data by any key in the key ring
+func (k OpenPGPKeyRing) Verify(data, sig []byte) error {
+	return k.VerifyReader(bytes.NewReader(data), sig)
+}
+
+// VerifyReader is like Verify, but streams the signed data from r
+func (k OpenPGPKeyRing) VerifyReader(r io.Reader, sig []byte) error {
+	if len(k) == 0 {
+		return ErrNoTrustedKeys
+	}
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte(armorHeader)) {
+		_, err = openpgp.CheckArmoredDetachedSignature(openpgp.EntityList(k), r, bytes.NewReader(sig))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(openpgp.EntityList(k), r, bytes.NewReader(sig))
+	}
+	return err
+}
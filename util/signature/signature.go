@@ -0,0 +1,263 @@
+// Package signature implements verification of detached ed25519, minisign
+// and OpenPGP signatures.
+package signature
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+var (
+	// ErrNoTrustedKeys is returned when verification is attempted against an
+	// empty key ring.
+	ErrNoTrustedKeys = errors.New("no trusted keys configured")
+	// ErrInvalidSignature is returned when a signature doesn't verify against
+	// any of the trusted keys.
+	ErrInvalidSignature = errors.New("signature is not valid for any trusted key")
+)
+
+const (
+	minisignAlgPure     = "Ed"
+	minisignAlgPrehash  = "ED"
+	minisignKeyIDLen    = 8
+	minisignCommentHead = "untrusted comment:"
+	minisignTrustedHead = "trusted comment: "
+)
+
+// PublicKey is an ed25519 public key. Keys loaded from minisign public key
+// files also carry the minisign key ID.
+type PublicKey struct {
+	KeyID []byte
+	Key   ed25519.PublicKey
+}
+
+// KeyRing is a set of trusted public keys
+type KeyRing []*PublicKey
+
+// Signature is a parsed detached signature. Raw ed25519 signatures only
+// set Sig; minisign signatures set all fields.
+type Signature struct {
+	Algorithm      string
+	KeyID          []byte
+	Sig            []byte
+	TrustedComment string
+	GlobalSig      []byte
+}
+
+// ParsePublicKey parses either a base64-encoded raw ed25519 public key or
+// a minisign public key (with or without its `untrusted comment:` line).
+func ParsePublicKey(s string) (*PublicKey, error) {
+	line := ""
+	for _, l := range strings.Split(strings.TrimSpace(s), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, minisignCommentHead) {
+			continue
+		}
+		line = l
+		break
+	}
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %s", err)
+	}
+	switch {
+	case len(raw) == ed25519.PublicKeySize:
+		return &PublicKey{Key: ed25519.PublicKey(raw)}, nil
+	case len(raw) == 2+minisignKeyIDLen+ed25519.PublicKeySize && string(raw[:2]) == minisignAlgPure:
+		return &PublicKey{
+			KeyID: raw[2 : 2+minisignKeyIDLen],
+			Key:   ed25519.PublicKey(raw[2+minisignKeyIDLen:]),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unrecognized public key format (%d bytes)", len(raw))
+	}
+}
+
+// ParsePublicKeys parses a list of public keys into a KeyRing
+func ParsePublicKeys(keys []string) (KeyRing, error) {
+	kr := make(KeyRing, 0, len(keys))
+	for i, k := range keys {
+		pk, err := ParsePublicKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("public key %d: %s", i, err)
+		}
+		kr = append(kr, pk)
+	}
+	return kr, nil
+}
+
+// Verifier checks detached signatures against a set of trusted keys
+type Verifier interface {
+	Verify(data, sig []byte) error
+	VerifyReader(r io.Reader, sig []byte) error
+}
+
+var _ Verifier = KeyRing{}
+var _ Verifier = OpenPGPKeyRing{}
+
+// ParseTrustedKeys parses a list of trusted keys, which must either all be
+// armored OpenPGP public keys or all be ed25519/minisign public keys
+func ParseTrustedKeys(keys []string) (Verifier, error) {
+	pgp := 0
+	for _, k := range keys {
+		if IsOpenPGPKey(k) {
+			pgp++
+		}
+	}
+	switch {
+	case pgp == 0:
+		return ParsePublicKeys(keys)
+	case pgp != len(keys):
+		return nil, errors.New("OpenPGP keys can't be mixed with ed25519 or minisign keys")
+	}
+	var kr OpenPGPKeyRing
+	for i, k := range keys {
+		el, err := ReadOpenPGPKeyRing(strings.NewReader(k))
+		if err != nil {
+			return nil, fmt.Errorf("public key %d: %s", i, err)
+		}
+		kr = append(kr, el...)
+	}
+	return kr, nil
+}
+
+// ParseSignature parses a detached signature. Accepted formats are a raw
+// 64-byte ed25519 signature, the same base64-encoded, or a minisign
+// signature file.
+func ParseSignature(data []byte) (*Signature, error) {
+	if len(data) == ed25519.SignatureSize {
+		return &Signature{Sig: data}, nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+
+	if !strings.HasPrefix(lines[0], minisignCommentHead) {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[0]))
+		if err != nil || len(raw) != ed25519.SignatureSize || len(lines) != 1 {
+			return nil, errors.New("unrecognized signature format")
+		}
+		return &Signature{Sig: raw}, nil
+	}
+
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], minisignTrustedHead) {
+		return nil, errors.New("malformed minisign signature")
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode minisign signature: %s", err)
+	}
+	if len(raw) != 2+minisignKeyIDLen+ed25519.SignatureSize {
+		return nil, errors.New("malformed minisign signature")
+	}
+	alg := string(raw[:2])
+	if alg != minisignAlgPure && alg != minisignAlgPrehash {
+		return nil, fmt.Errorf("unsupported minisign signature algorithm %q", alg)
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return nil, errors.New("malformed minisign global signature")
+	}
+	return &Signature{
+		Algorithm:      alg,
+		KeyID:          raw[2 : 2+minisignKeyIDLen],
+		Sig:            raw[2+minisignKeyIDLen:],
+		TrustedComment: strings.TrimPrefix(lines[2], minisignTrustedHead),
+		GlobalSig:      global,
+	}, nil
+}
+
+// Verify checks that sig is a valid signature over data by any key in the
+// key ring.
+func (k KeyRing) Verify(data, sig []byte) error {
+	if len(k) == 0 {
+		return ErrNoTrustedKeys
+	}
+	s, err := ParseSignature(sig)
+	if err != nil {
+		return err
+	}
+	return k.verify(s, s.message(data))
+}
+
+// VerifyReader is like Verify, but reads the signed data from r. Prehashed
+// minisign signatures are checked by streaming r through the hash; other
+// signatures cover the whole message, so r is read into memory.
+func (k KeyRing) VerifyReader(r io.Reader, sig []byte) error {
+	if len(k) == 0 {
+		return ErrNoTrustedKeys
+	}
+	s, err := ParseSignature(sig)
+	if err != nil {
+		return err
+	}
+	if s.Algorithm != minisignAlgPrehash {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return k.verify(s, data)
+	}
+	h, err := blake2b.New512(nil)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	return k.verify(s, h.Sum(nil))
+}
+
+// verify checks s over the signed message by each key in turn
+func (k KeyRing) verify(s *Signature, msg []byte) error {
+	for _, key := range k {
+		if s.verifiedByMessage(key, msg) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// VerifiedBy returns whether this signature is a valid signature over data
+// made by key.
+func (s *Signature) VerifiedBy(key *PublicKey, data []byte) bool {
+	return s.verifiedByMessage(key, s.message(data))
+}
+
+// message returns what was actually signed for data: the data itself, or
+// its blake2b-512 hash for prehashed minisign signatures
+func (s *Signature) message(data []byte) []byte {
+	if s.Algorithm == minisignAlgPrehash {
+		h := blake2b.Sum512(data)
+		return h[:]
+	}
+	return data
+}
+
+func (s *Signature) verifiedByMessage(key *PublicKey, msg []byte) bool {
+	if s.Algorithm == "" {
+		return ed25519.Verify(key.Key, msg, s.Sig)
+	}
+	if key.KeyID != nil && !bytes.Equal(key.KeyID, s.KeyID) {
+		return false
+	}
+	if !ed25519.Verify(key.Key, msg, s.Sig) {
+		return false
+	}
+	// the global signature covers the trusted comment
+	global := append(append([]byte{}, s.Sig...), []byte(s.TrustedComment)...)
+	return ed25519.Verify(key.Key, global, s.GlobalSig)
+}
@@ -0,0 +1,123 @@
+package signature
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	return pub, priv
+}
+
+func minisignPublicKey(keyID []byte, pub ed25519.PublicKey) string {
+	raw := append(append([]byte("Ed"), keyID...), pub...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+func minisignSign(keyID []byte, priv ed25519.PrivateKey, data []byte, prehash bool) []byte {
+	alg, msg := "Ed", data
+	if prehash {
+		h := blake2b.Sum512(data)
+		alg, msg = "ED", h[:]
+	}
+	sig := ed25519.Sign(priv, msg)
+	comment := "timestamp:0"
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), []byte(comment)...))
+	raw := append(append([]byte(alg), keyID...), sig...)
+	return []byte("untrusted comment: signature\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		"trusted comment: " + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func TestKeyRing_VerifyEd25519(t *testing.T) {
+	pub, priv := newKey(t)
+	data := []byte(`{"steps":[]}`)
+
+	kr, err := ParsePublicKeys([]string{base64.StdEncoding.EncodeToString(pub)})
+	if err != nil {
+		t.Fatalf("failed to parse public key: %s", err)
+	}
+
+	sig := ed25519.Sign(priv, data)
+	if err := kr.Verify(data, sig); err != nil {
+		t.Errorf("raw signature failed to verify: %s", err)
+	}
+	if err := kr.Verify(data, []byte(base64.StdEncoding.EncodeToString(sig))); err != nil {
+		t.Errorf("base64 signature failed to verify: %s", err)
+	}
+	if err := kr.Verify([]byte(`{"steps":[1]}`), sig); err != ErrInvalidSignature {
+		t.Errorf("tampered data should fail verification, got %v", err)
+	}
+}
+
+func TestKeyRing_VerifyMinisign(t *testing.T) {
+	pub, priv := newKey(t)
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	data := []byte(`{"steps":[]}`)
+
+	pk, err := ParsePublicKey(minisignPublicKey(keyID, pub))
+	if err != nil {
+		t.Fatalf("failed to parse minisign public key: %s", err)
+	}
+	kr := KeyRing{pk}
+
+	for _, prehash := range []bool{false, true} {
+		sig := minisignSign(keyID, priv, data, prehash)
+		if err := kr.Verify(data, sig); err != nil {
+			t.Errorf("minisign signature (prehash=%t) failed to verify: %s", prehash, err)
+		}
+		if err := kr.Verify(append(data, ' '), sig); err != ErrInvalidSignature {
+			t.Errorf("tampered data should fail verification (prehash=%t), got %v", prehash, err)
+		}
+	}
+
+	otherID := []byte{8, 7, 6, 5, 4, 3, 2, 1}
+	if err := kr.Verify(data, minisignSign(otherID, priv, data, true)); err != ErrInvalidSignature {
+		t.Errorf("signature with mismatched key id should fail verification, got %v", err)
+	}
+}
+
+func TestKeyRing_VerifyReader(t *testing.T) {
+	pub, priv := newKey(t)
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	data := bytes.Repeat([]byte("chef"), 1<<16)
+
+	pk, err := ParsePublicKey(minisignPublicKey(keyID, pub))
+	if err != nil {
+		t.Fatalf("failed to parse minisign public key: %s", err)
+	}
+	kr := KeyRing{pk}
+
+	for _, prehash := range []bool{false, true} {
+		sig := minisignSign(keyID, priv, data, prehash)
+		if err := kr.VerifyReader(bytes.NewReader(data), sig); err != nil {
+			t.Errorf("minisign signature (prehash=%t) failed to verify: %s", prehash, err)
+		}
+		if err := kr.VerifyReader(bytes.NewReader(data[1:]), sig); err != ErrInvalidSignature {
+			t.Errorf("tampered data should fail verification (prehash=%t), got %v", prehash, err)
+		}
+	}
+	if err := kr.VerifyReader(bytes.NewReader(data), ed25519.Sign(priv, data)); err != nil {
+		t.Errorf("raw signature failed to verify: %s", err)
+	}
+}
+
+func TestKeyRing_VerifyEmpty(t *testing.T) {
+	if err := (KeyRing{}).Verify([]byte("x"), []byte("y")); err != ErrNoTrustedKeys {
+		t.Errorf("expected ErrNoTrustedKeys, got %v", err)
+	}
+}
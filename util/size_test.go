@@ -0,0 +1,20 @@
+package util
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for in, exp := range map[string]int64{"100": 100, "10K": 10 << 10, "5MB": 5 << 20, "1 GiB": 1 << 30, "2t": 2 << 40} {
+		if n, err := ParseSize(in); err != nil || n != exp {
+			t.Errorf("ParseSize(%q) = %d, %v; expected %d", in, n, err, exp)
+		}
+	}
+	for _, in := range []string{"", "lots", "-1K", "1.5G"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("expected ParseSize(%q) to fail", in)
+		}
+	}
+}
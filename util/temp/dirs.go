@@ -11,16 +11,31 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 )
 
-var tmps = make(map[string]string)
+var (
+	tmpsMu sync.Mutex
+	tmps   = make(map[string]string)
+)
+
+// Preserve keeps paths passed to Remove registered rather than deleting
+// them, so Cleanup(true) can report them for debugging
+var Preserve bool
+
+// register records a temp path for cleanup along with its creator
+func register(name string) {
+	_, fn, ln, _ := runtime.Caller(2)
+	tmpsMu.Lock()
+	defer tmpsMu.Unlock()
+	tmps[name] = fmt.Sprintf("%s:%d", fn, ln)
+}
 
 // Dir creates a temporary directory registered for cleanup
 func Dir(dir, prefix string) (name string, err error) {
 	name, err = ioutil.TempDir(dir, prefix)
 	if err == nil {
-		_, fn, ln, _ := runtime.Caller(1)
-		tmps[name] = fmt.Sprintf("%s:%d", fn, ln)
+		register(name)
 	}
 	return
 }
@@ -29,15 +44,28 @@ func Dir(dir, prefix string) (name string, err error) {
 func File(dir string, prefix string) (f *os.File, err error) {
 	f, err = ioutil.TempFile(dir, prefix)
 	if err == nil {
-		_, fn, ln, _ := runtime.Caller(1)
-		tmps[f.Name()] = fmt.Sprintf("%s:%d", fn, ln)
+		register(f.Name())
 	}
 	return
 }
 
+// Remove deletes a temp path early, once it's no longer needed, and drops
+// it from cleanup. If Preserve is set the path is left for Cleanup instead.
+func Remove(name string) error {
+	if Preserve {
+		return nil
+	}
+	tmpsMu.Lock()
+	delete(tmps, name)
+	tmpsMu.Unlock()
+	return os.RemoveAll(name)
+}
+
 // Cleanup performs the cleanup of paths unless preserve is true, in which
 // case it just prints the paths without deleting them (for debugging).
 func Cleanup(preserve bool) {
+	tmpsMu.Lock()
+	defer tmpsMu.Unlock()
 	var errs []error
 	for tmp, caller := range tmps {
 		if preserve {
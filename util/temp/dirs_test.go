@@ -0,0 +1,36 @@
+package temp
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+	defer func() { Preserve = false }()
+
+	for _, preserve := range []bool{false, true} {
+		Preserve = preserve
+		dir, err := Dir("", "go2chef-test-")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %s", err)
+		}
+		if err := Remove(dir); err != nil {
+			t.Errorf("failed to remove %s: %s", dir, err)
+		}
+		_, err = os.Stat(dir)
+		if exists := err == nil; exists != preserve {
+			t.Errorf("preserve=%t: %s exists: %t", preserve, dir, exists)
+		}
+		tmpsMu.Lock()
+		_, registered := tmps[dir]
+		tmpsMu.Unlock()
+		if registered != preserve {
+			t.Errorf("preserve=%t: %s registered for cleanup: %t", preserve, dir, registered)
+		}
+	}
+	Cleanup(false)
+}
@@ -0,0 +1,123 @@
+package version
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of comma-separated semantic version requirements
+// which must all hold, written as in RubyGems: i.e. ">= 17.1, < 18" or
+// "~> 17.10". The operators are =, !=, >, >=, <, <= and ~> (pessimistic:
+// "~> 17.10" allows 17.10 and later 17.x, "~> 17.10.3" allows later
+// 17.10.x).
+type Constraint struct {
+	clauses []clause
+}
+
+type clause struct {
+	op string
+	v  *Semver
+}
+
+// constraintOps are the supported operators, longest first so that ">="
+// isn't taken as ">"
+var constraintOps = []string{"~>", ">=", "<=", "!=", ">", "<", "="}
+
+// IsConstraint reports whether s uses constraint operators, as opposed to
+// being a plain (possibly partial) version
+func IsConstraint(s string) bool {
+	return strings.ContainsAny(s, "<>=!~,")
+}
+
+// ParseConstraint parses a version constraint
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		op := "="
+		for _, o := range constraintOps {
+			if strings.HasPrefix(part, o) {
+				op = o
+				part = strings.TrimSpace(part[len(o):])
+				break
+			}
+		}
+		v, err := ParseSemver(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %s", s, err)
+		}
+		c.clauses = append(c.clauses, clause{op: op, v: v})
+	}
+	return c, nil
+}
+
+// Check reports whether the semantic version v satisfies the constraint.
+// Unparseable versions never do.
+func (c *Constraint) Check(v string) bool {
+	sv, err := ParseSemver(v)
+	if err != nil {
+		return false
+	}
+	for _, cl := range c.clauses {
+		if !cl.check(sv) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cl clause) check(v *Semver) bool {
+	cmp := v.Compare(cl.v)
+	switch cl.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "~>":
+		return cmp >= 0 && v.Compare(cl.v.bump()) < 0
+	}
+	return false
+}
+
+// bump returns the exclusive upper bound of a pessimistic constraint: the
+// last component is dropped and the one before it incremented
+func (v *Semver) bump() *Semver {
+	n := len(v.Numbers) - 1
+	if n < 1 {
+		n = 1
+	}
+	up := &Semver{Numbers: append([]int64{}, v.Numbers[:n]...)}
+	up.Numbers[n-1]++
+	// any prerelease of the bound is still out of range
+	up.Prerelease = []string{"0"}
+	return up
+}
+
+// Latest returns the highest of versions satisfying the constraint, or ""
+// if none do
+func (c *Constraint) Latest(versions []string) string {
+	var best *Semver
+	latest := ""
+	for _, v := range versions {
+		if !c.Check(v) {
+			continue
+		}
+		sv, _ := ParseSemver(v)
+		if best == nil || sv.Compare(best) > 0 {
+			best, latest = sv, v
+		}
+	}
+	return latest
+}
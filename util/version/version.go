@@ -0,0 +1,353 @@
+// Package version compares version strings using semantic versioning, RPM
+// (rpmvercmp) or Debian (dpkg) ordering rules, and matches semantic
+// versions against RubyGems-style constraints.
+package version
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version schemes
+const (
+	SchemeSemver = "semver"
+	SchemeRPM    = "rpm"
+	SchemeDebian = "deb"
+)
+
+// Supported reports whether scheme is a known version scheme
+func Supported(scheme string) bool {
+	switch scheme {
+	case SchemeSemver, SchemeRPM, SchemeDebian:
+		return true
+	}
+	return false
+}
+
+// Validate checks that v is a version under scheme. Any string is a valid
+// RPM or Debian version, but semantic versions have to parse.
+func Validate(scheme, v string) error {
+	switch scheme {
+	case SchemeSemver:
+		_, err := ParseSemver(v)
+		return err
+	case SchemeRPM, SchemeDebian:
+		return nil
+	}
+	return fmt.Errorf("unknown version scheme %q", scheme)
+}
+
+// Compare compares a and b using scheme, returning -1, 0 or 1 if a is
+// older than, equal to or newer than b
+func Compare(scheme, a, b string) (int, error) {
+	switch scheme {
+	case SchemeSemver:
+		return CompareSemver(a, b)
+	case SchemeRPM:
+		return CompareRPM(a, b), nil
+	case SchemeDebian:
+		return CompareDebian(a, b), nil
+	}
+	return 0, fmt.Errorf("unknown version scheme %q", scheme)
+}
+
+// Semver is a parsed semantic version. Versions with fewer than three
+// numeric components (i.e. "17.10") are accepted, with the missing ones
+// treated as zero.
+type Semver struct {
+	Numbers    []int64
+	Prerelease []string
+}
+
+// ParseSemver parses a semantic version, with an optional "v" prefix. Build
+// metadata is ignored.
+func ParseSemver(s string) (*Semver, error) {
+	orig := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	v := &Semver{}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if s[i+1:] == "" {
+			return nil, fmt.Errorf("invalid semantic version %q", orig)
+		}
+		v.Prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid semantic version %q", orig)
+		}
+		v.Numbers = append(v.Numbers, n)
+	}
+	return v, nil
+}
+
+// Compare compares two semantic versions by precedence
+func (v *Semver) Compare(o *Semver) int {
+	n := len(v.Numbers)
+	if len(o.Numbers) > n {
+		n = len(o.Numbers)
+	}
+	for i := 0; i < n; i++ {
+		var a, b int64
+		if i < len(v.Numbers) {
+			a = v.Numbers[i]
+		}
+		if i < len(o.Numbers) {
+			b = o.Numbers[i]
+		}
+		if a != b {
+			return sign(a - b)
+		}
+	}
+
+	// a prerelease has lower precedence than the release itself
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		a, b := v.Prerelease[i], o.Prerelease[i]
+		an, aerr := strconv.ParseInt(a, 10, 64)
+		bn, berr := strconv.ParseInt(b, 10, 64)
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aerr == nil:
+			// numeric identifiers sort before alphanumeric ones
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(int64(len(v.Prerelease) - len(o.Prerelease)))
+}
+
+// CompareSemver compares two semantic version strings
+func CompareSemver(a, b string) (int, error) {
+	av, err := ParseSemver(a)
+	if err != nil {
+		return 0, err
+	}
+	bv, err := ParseSemver(b)
+	if err != nil {
+		return 0, err
+	}
+	return av.Compare(bv), nil
+}
+
+// splitEpoch splits an optional numeric "epoch:" prefix from a version
+func splitEpoch(s string) (int64, string) {
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		if e, err := strconv.ParseInt(s[:i], 10, 64); err == nil {
+			return e, s[i+1:]
+		}
+	}
+	return 0, s
+}
+
+// splitRelease splits a version at its last hyphen into version and
+// release (RPM) or upstream version and revision (Debian)
+func splitRelease(s string) (string, string) {
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// CompareRPM compares two `[epoch:]version[-release]` strings as RPM does.
+// The release is only compared if both versions have one.
+func CompareRPM(a, b string) int {
+	ae, a := splitEpoch(a)
+	be, b := splitEpoch(b)
+	if ae != be {
+		return sign(ae - be)
+	}
+	av, ar := splitRelease(a)
+	bv, br := splitRelease(b)
+	if c := rpmvercmp(av, bv); c != 0 || ar == "" || br == "" {
+		return c
+	}
+	return rpmvercmp(ar, br)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// rpmvercmp is a port of rpm's version segment comparison
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	for {
+		a = strings.TrimLeftFunc(a, isSeparator)
+		b = strings.TrimLeftFunc(b, isSeparator)
+
+		// tilde sorts before everything, even the end of the version
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		// caret sorts after the end of the version, but before anything else
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			switch {
+			case a == "":
+				return -1
+			case b == "":
+				return 1
+			case !strings.HasPrefix(a, "^"):
+				return 1
+			case !strings.HasPrefix(b, "^"):
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		numeric := isDigit(a[0])
+		segment := isAlpha
+		if numeric {
+			segment = isDigit
+		}
+		as, bs := leading(a, segment), leading(b, segment)
+		a, b = a[len(as):], b[len(bs):]
+		if bs == "" {
+			// numeric segments are newer than alpha ones
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			as, bs = strings.TrimLeft(as, "0"), strings.TrimLeft(bs, "0")
+			if len(as) != len(bs) {
+				return sign(int64(len(as) - len(bs)))
+			}
+		}
+		if c := strings.Compare(as, bs); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	}
+	return 1
+}
+
+func isSeparator(r rune) bool {
+	return r < 128 && !isDigit(byte(r)) && !isAlpha(byte(r)) && r != '~' && r != '^'
+}
+
+// leading returns the prefix of s whose bytes all satisfy f
+func leading(s string, f func(byte) bool) string {
+	i := 0
+	for i < len(s) && f(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+// CompareDebian compares two `[epoch:]upstream[-revision]` strings as dpkg
+// does
+func CompareDebian(a, b string) int {
+	ae, a := splitEpoch(a)
+	be, b := splitEpoch(b)
+	if ae != be {
+		return sign(ae - be)
+	}
+	av, ar := splitRelease(a)
+	bv, br := splitRelease(b)
+	if c := verrevcmp(av, bv); c != 0 {
+		return c
+	}
+	return verrevcmp(ar, br)
+}
+
+// debOrder is the dpkg sort weight of a non-digit character; 0 is the end
+// of the string
+func debOrder(s string) int {
+	switch {
+	case s == "":
+		return 0
+	case isDigit(s[0]):
+		return 0
+	case isAlpha(s[0]):
+		return int(s[0])
+	case s[0] == '~':
+		return -1
+	}
+	return int(s[0]) + 256
+}
+
+// verrevcmp is a port of dpkg's version part comparison
+func verrevcmp(a, b string) int {
+	for a != "" || b != "" {
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			ac, bc := debOrder(a), debOrder(b)
+			if ac != bc {
+				return sign(int64(ac - bc))
+			}
+			if a != "" {
+				a = a[1:]
+			}
+			if b != "" {
+				b = b[1:]
+			}
+		}
+		an, bn := leading(a, isDigit), leading(b, isDigit)
+		a, b = a[len(an):], b[len(bn):]
+		an, bn = strings.TrimLeft(an, "0"), strings.TrimLeft(bn, "0")
+		if len(an) != len(bn) {
+			return sign(int64(len(an) - len(bn)))
+		}
+		if c := strings.Compare(an, bn); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func sign(n int64) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
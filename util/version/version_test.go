@@ -0,0 +1,116 @@
+package version
+
+/*
+	Copyright (c) Facebook, Inc. and its affiliates. All Rights Reserved
+*/
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		scheme, a, b string
+		want         int
+	}{
+		{SchemeSemver, "1.0.0", "1.0.0", 0},
+		{SchemeSemver, "v17.10.3", "17.9.59", 1},
+		{SchemeSemver, "17.10", "17.10.0", 0},
+		{SchemeSemver, "1.0.0-rc.1", "1.0.0", -1},
+		{SchemeSemver, "1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{SchemeSemver, "1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{SchemeSemver, "1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{SchemeSemver, "1.0.0-1", "1.0.0-alpha", -1},
+		{SchemeSemver, "1.0.0+build.5", "1.0.0", 0},
+
+		{SchemeRPM, "17.10.3-1.el8", "17.10.3-1.el8", 0},
+		{SchemeRPM, "17.10.3-1.el8", "17.9.59-1.el8", 1},
+		{SchemeRPM, "1.0-2", "1.0-10", -1},
+		{SchemeRPM, "1.0a", "1.0", 1},
+		{SchemeRPM, "1.0", "1.0.1", -1},
+		{SchemeRPM, "1.0~rc1", "1.0", -1},
+		{SchemeRPM, "1.0^git1", "1.0", 1},
+		{SchemeRPM, "1.0^git1", "1.0.1", -1},
+		{SchemeRPM, "1.001", "1.1", 0},
+		{SchemeRPM, "1:1.0", "2.0", 1},
+		{SchemeRPM, "1.0", "1.0-5", 0},
+		{SchemeRPM, "1.0a", "1.0.1", -1},
+
+		{SchemeDebian, "17.10.3-1", "17.10.3-1", 0},
+		{SchemeDebian, "17.10.3-1", "17.9.59-1", 1},
+		{SchemeDebian, "1.0~rc1-1", "1.0-1", -1},
+		{SchemeDebian, "1.0-1", "1.0-1ubuntu1", -1},
+		{SchemeDebian, "1.0", "1.0-0", 0},
+		{SchemeDebian, "1:0.9", "2.0", 1},
+		{SchemeDebian, "1.0a", "1.0+", -1},
+		{SchemeDebian, "1.0", "1.0.1", -1},
+	} {
+		got, err := Compare(tc.scheme, tc.a, tc.b)
+		if err != nil {
+			t.Errorf("%s: %s vs %s: unexpected error %s", tc.scheme, tc.a, tc.b, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: %s vs %s = %d, want %d", tc.scheme, tc.a, tc.b, got, tc.want)
+		}
+		if rev, _ := Compare(tc.scheme, tc.b, tc.a); rev != -tc.want {
+			t.Errorf("%s: %s vs %s = %d, want %d", tc.scheme, tc.b, tc.a, rev, -tc.want)
+		}
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	if _, err := Compare("calver", "1", "2"); err == nil {
+		t.Errorf("expected unknown scheme to fail")
+	}
+	for _, v := range []string{"", "1.x", "1.0-", "latest"} {
+		if _, err := CompareSemver(v, "1.0.0"); err == nil {
+			t.Errorf("expected %q to be an invalid semantic version", v)
+		}
+		if err := Validate(SchemeSemver, v); err == nil {
+			t.Errorf("expected %q to fail semver validation", v)
+		}
+	}
+	if err := Validate(SchemeSemver, "v17.10.3-rc.1"); err != nil {
+		t.Errorf("expected a valid semantic version: %s", err)
+	}
+	if err := Validate(SchemeRPM, "latest"); err != nil {
+		t.Errorf("expected any RPM version to be valid: %s", err)
+	}
+	if err := Validate("calver", "2024.01"); err == nil {
+		t.Errorf("expected unknown scheme to fail validation")
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	versions := []string{"16.17.51", "17.9.59", "17.10.0", "17.10.3", "18.0.185", "18.1.0-rc.1"}
+	for _, tc := range []struct {
+		constraint string
+		want       string
+	}{
+		{"~> 17.10", "17.10.3"},
+		{"~> 17.9.0", "17.9.59"},
+		{"~> 17", "17.10.3"},
+		{">= 17, < 18", "17.10.3"},
+		{"> 17.10.3", "18.1.0-rc.1"},
+		{"< 18, != 17.10.3", "17.10.0"},
+		{"= 16.17.51", "16.17.51"},
+		{"~> 19", ""},
+	} {
+		c, err := ParseConstraint(tc.constraint)
+		if err != nil {
+			t.Errorf("failed to parse %q: %s", tc.constraint, err)
+			continue
+		}
+		if got := c.Latest(versions); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.constraint, got, tc.want)
+		}
+	}
+
+	for _, s := range []string{">= latest", "~>", ">= 17,"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("expected %q to be an invalid constraint", s)
+		}
+	}
+	if IsConstraint("17.10") || !IsConstraint("~> 17.10") {
+		t.Errorf("unexpected IsConstraint result")
+	}
+}